@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"kubectm/pkg/kubeconfig"
+)
+
+// printBackupsUsage prints the usage message for the backups command.
+func printBackupsUsage() {
+	color.Cyan(`kubectm backups - Browse and restore kubeconfig backups.
+
+Usage: kubectm backups <command> [options]
+
+Commands:
+  list                 List backups, newest first.
+  show <id>            Print a backup with credentials redacted.
+  diff <a> [b]         Diff two backups; b defaults to "current", the live kubeconfig.
+  restore <id>         Replace the kubeconfig with a backup, backing up the current one first.
+
+A backup's id is its timestamp as shown by list, or "latest".
+
+Options:
+  --backup-count <n>   Number of kubeconfig backups to keep when restoring (default: 5).
+  --kubeconfig <path>  Kubeconfig whose backups to use (default: as for kubectm).
+`)
+}
+
+// runBackups implements `kubectm backups`.
+func runBackups(args []string) {
+	if len(args) == 0 {
+		printBackupsUsage()
+		os.Exit(2)
+	}
+	if args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		printBackupsUsage()
+		os.Exit(0)
+	}
+	command, args := args[0], args[1:]
+
+	flags := flag.NewFlagSet("backups "+command, flag.ExitOnError)
+	flags.Usage = printBackupsUsage
+	backupCount := flags.Int("backup-count", kubeconfig.DefaultBackupCount, "Number of kubeconfig backups to keep")
+	flags.StringVar(&kubeconfig.KubeconfigPath, "kubeconfig", "", "Kubeconfig whose backups to use")
+	flags.Parse(args)
+	args = flags.Args()
+
+	switch {
+	case command == "list" && len(args) == 0:
+		listBackups()
+	case command == "show" && len(args) == 1:
+		content, err := kubeconfig.ShowBackup(args[0])
+		if err != nil {
+			errorLogger.Fatalf("%s Failed to show backup: %v", iso8601Time(), err)
+		}
+		fmt.Print(content)
+	case command == "diff" && (len(args) == 1 || len(args) == 2):
+		b := kubeconfig.CurrentBackupID
+		if len(args) == 2 {
+			b = args[1]
+		}
+		diff, err := kubeconfig.DiffBackups(args[0], b)
+		if err != nil {
+			errorLogger.Fatalf("%s Failed to diff backups: %v", iso8601Time(), err)
+		}
+		if diff == "" {
+			infoLogger.Printf("%s No differences.", iso8601Time())
+		} else {
+			fmt.Print(diff)
+		}
+	case command == "restore" && len(args) == 1:
+		safety, err := kubeconfig.RestoreBackup(args[0], *backupCount)
+		if err != nil {
+			errorLogger.Fatalf("%s Failed to restore backup: %v", iso8601Time(), err)
+		}
+		if safety != "" {
+			infoLogger.Printf("%s The previous kubeconfig is saved as %s", iso8601Time(), safety)
+		}
+	default:
+		printBackupsUsage()
+		os.Exit(2)
+	}
+}
+
+// listBackups prints a table of the kubeconfig backups.
+func listBackups() {
+	backups, err := kubeconfig.ListBackups()
+	if err != nil {
+		errorLogger.Fatalf("%s Failed to list backups: %v", iso8601Time(), err)
+	}
+	if len(backups) == 0 {
+		infoLogger.Printf("%s No kubeconfig backups found.", iso8601Time())
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tCREATED\tCONTEXTS\tPROVIDERS\tVERSION")
+	for _, backup := range backups {
+		contexts, providers, version := "-", "-", "-"
+		if m := backup.Metadata; m != nil {
+			contexts = fmt.Sprint(m.Contexts)
+			if len(m.Providers) > 0 {
+				providers = strings.Join(m.Providers, ",")
+			}
+			if m.Version != "" {
+				version = m.Version
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", backup.ID, backup.Time.Local().Format(time.RFC3339), contexts, providers, version)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+)
+
+// command is a kubectm subcommand. Each parses its own flags and prints its
+// own help for --help.
+type command struct {
+	name string
+	// synopsis follows the command name in the usage message.
+	synopsis string
+	summary  string
+	run      func(args []string)
+}
+
+// defaultCommand runs when kubectm is given no command, so `kubectm` and
+// `kubectm --dry-run` keep syncing as they always have.
+const defaultCommand = "sync"
+
+// commands lists the subcommands in the order the usage message shows them.
+// A run function must not print the top-level usage, which is built from
+// this table.
+var commands = []command{
+	{name: "sync", synopsis: "[options]", summary: "Download kubeconfigs from the selected providers and merge them (default).", run: runSync},
+	{name: "list", synopsis: "[options]", summary: "List the clusters of the selected providers without touching the kubeconfig.", run: runList},
+	{name: "providers", synopsis: "[list|select [providers]]", summary: "Show the providers and their credentials, or select them again.", run: runProviders},
+	{name: "backups", synopsis: "<command> [options]", summary: "List, show, diff and restore kubeconfig backups.", run: runBackups},
+	{name: "prune", synopsis: "[options]", summary: "Remove contexts whose cluster was deleted, without downloading kubeconfigs.", run: runPrune},
+	{name: "rename", synopsis: "[options]", summary: "Rename contexts with regex or template rules.", run: runRename},
+	{name: "pin", synopsis: "<command> [options]", summary: "Pin contexts so kubectm never touches them.", run: runPin},
+	{name: "doctor", synopsis: "[options]", summary: "Check settings, state, kubeconfig and provider credentials.", run: runDoctor},
+	{name: "config", synopsis: "<command>", summary: "Show and change the settings in ~/.kubectm/config.json.", run: runConfig},
+}
+
+// lookupCommand returns the subcommand with the given name.
+func lookupCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// printUsage prints the usage message for the kubectm command, generated
+// from the commands table.
+func printUsage() {
+	var b strings.Builder
+	b.WriteString("kubectm - A tool to download and integrate Kubernetes configurations across multiple cloud providers.\n\n")
+	b.WriteString("Usage: kubectm [command] [options]\n\nCommands:\n")
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", cmd.name, cmd.synopsis, cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintf(&b, `
+Options:
+  -h, --help     Show this help message and exit.
+  -v, --version  Show the version of kubectm.
+
+Run kubectm <command> --help for the options of a command. Without a command,
+kubectm runs %s, so kubectm [options] takes the options of kubectm %s.
+
+For more information and source code, visit:
+https://github.com/johnybradshaw/kubectm
+`, defaultCommand, defaultCommand)
+	color.New(color.FgCyan).Print(b.String())
+}
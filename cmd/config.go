@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"kubectm/pkg/kubeconfig"
+)
+
+// printConfigUsage prints the usage message for the config command.
+func printConfigUsage() {
+	color.New(color.FgCyan).Printf(`kubectm config - Show and change the settings in ~/.kubectm/config.json.
+
+Usage: kubectm config <command>
+
+Commands:
+  path                 Print the path of the settings file.
+  show                 Print the settings file.
+  get <name>           Print a setting as JSON.
+  set <name> <value>   Change a setting; aws_regions takes a comma-separated list.
+  unset <name>         Remove a setting so its default applies.
+
+Settings: %s.
+Naming and rename rules are edited in the file; pins with kubectm pin.
+`, strings.Join(kubeconfig.SettingNames(), ", "))
+}
+
+// runConfig implements `kubectm config`.
+func runConfig(args []string) {
+	if len(args) == 0 {
+		printConfigUsage()
+		os.Exit(2)
+	}
+	if args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		printConfigUsage()
+		os.Exit(0)
+	}
+	command, args := args[0], args[1:]
+
+	flags := flag.NewFlagSet("config "+command, flag.ExitOnError)
+	flags.Usage = printConfigUsage
+	flags.Parse(args)
+	args = flags.Args()
+
+	switch {
+	case command == "path" && len(args) == 0:
+		path, err := kubeconfig.ConfigPath()
+		if err != nil {
+			errorLogger.Fatalf("%s Failed to locate the settings file: %v", iso8601Time(), err)
+		}
+		fmt.Println(path)
+	case command == "show" && len(args) == 0:
+		showConfig()
+	case command == "get" && len(args) == 1:
+		value, err := kubeconfig.GetSetting(args[0])
+		if err != nil {
+			errorLogger.Fatalf("%s Failed to read setting: %v", iso8601Time(), err)
+		}
+		if value == "" {
+			infoLogger.Printf("%s %s is not set.", iso8601Time(), args[0])
+			return
+		}
+		fmt.Println(value)
+	case command == "set" && len(args) == 2:
+		if err := kubeconfig.SetSetting(args[0], args[1]); err != nil {
+			errorLogger.Fatalf("%s Failed to change setting: %v", iso8601Time(), err)
+		}
+		actionLogger.Printf("%s Set %s to %s", iso8601Time(), args[0], args[1])
+	case command == "unset" && len(args) == 1:
+		if err := kubeconfig.UnsetSetting(args[0]); err != nil {
+			errorLogger.Fatalf("%s Failed to change setting: %v", iso8601Time(), err)
+		}
+		actionLogger.Printf("%s Unset %s", iso8601Time(), args[0])
+	default:
+		printConfigUsage()
+		os.Exit(2)
+	}
+}
+
+// showConfig prints the settings file as written.
+func showConfig() {
+	path, err := kubeconfig.ConfigPath()
+	if err != nil {
+		errorLogger.Fatalf("%s Failed to locate the settings file: %v", iso8601Time(), err)
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		infoLogger.Printf("%s %s does not exist; every setting has its default.", iso8601Time(), path)
+		return
+	}
+	if err != nil {
+		errorLogger.Fatalf("%s Failed to read the settings file: %v", iso8601Time(), err)
+	}
+	fmt.Print(string(data))
+}
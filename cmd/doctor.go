@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"kubectm/pkg/kubeconfig"
+	"kubectm/pkg/provider"
+)
+
+// printDoctorUsage prints the usage message for the doctor command.
+func printDoctorUsage() {
+	color.Cyan(`kubectm doctor - Check kubectm's settings, state, kubeconfig and provider credentials.
+
+Usage: kubectm doctor [options]
+
+Nothing is written. The exit status is 1 if any check fails.
+
+Options:
+  --kubeconfig <path>  Kubeconfig to check (default: as for kubectm sync).
+`)
+}
+
+// runDoctor implements `kubectm doctor`.
+func runDoctor(args []string) {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	flags.Usage = printDoctorUsage
+	flags.StringVar(&kubeconfig.KubeconfigPath, "kubeconfig", "", "Kubeconfig to check")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		printDoctorUsage()
+		os.Exit(2)
+	}
+
+	checks := kubeconfig.Diagnose()
+	checks = append(checks, checkProviders()...)
+	checks = append(checks, checkKubectl())
+
+	failed := false
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, check := range checks {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", checkSymbol(check.Status), check.Name, check.Detail)
+		failed = failed || check.Status == kubeconfig.CheckFail
+	}
+	tw.Flush()
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// checkProviders checks the provider selection and looks for the
+// credentials of every provider, built in or plugin.
+func checkProviders() []kubeconfig.Check {
+	provider.RegisterPlugins()
+
+	var checks []kubeconfig.Check
+	selected, err := LoadSelectedCredentialProviders()
+	source := ""
+	if os.Getenv(providersEnv) != "" {
+		// The environment overrides the stored selection.
+		source = " (from " + providersEnv + ")"
+		selected, err = (&selectionOptions{}).givenProviders()
+	}
+	switch {
+	case os.IsNotExist(err):
+		checks = append(checks, kubeconfig.Check{Name: "selection", Status: kubeconfig.CheckWarn, Detail: "no providers selected yet; a sync prompts for them"})
+	case err != nil:
+		checks = append(checks, kubeconfig.Check{Name: "selection", Status: kubeconfig.CheckFail, Detail: err.Error()})
+	default:
+		check := kubeconfig.Check{Name: "selection", Status: kubeconfig.CheckOK, Detail: strings.Join(selected, ", ") + source}
+		for _, name := range selected {
+			if _, ok := provider.Get(name); !ok {
+				check.Status, check.Detail = kubeconfig.CheckFail, check.Detail+"; "+name+" is not registered, so a sync reports it as failed"
+			}
+		}
+		checks = append(checks, check)
+	}
+
+	for _, p := range provider.All() {
+		check := kubeconfig.Check{Name: "provider " + p.Name(), Status: kubeconfig.CheckOK, Detail: "credentials found"}
+		isSelected := false
+		for _, name := range selected {
+			isSelected = isSelected || name == p.Name()
+		}
+		cred, err := p.Discover(context.Background())
+		switch {
+		case err != nil && isSelected:
+			check.Status, check.Detail = kubeconfig.CheckFail, err.Error()
+		case err != nil:
+			check.Status, check.Detail = kubeconfig.CheckWarn, err.Error()
+		case cred == nil && isSelected:
+			check.Status, check.Detail = kubeconfig.CheckFail, "selected, but no credentials found"
+		case cred == nil:
+			check.Detail = "no credentials found"
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// checkKubectl looks for kubectl on $PATH, which kubectm does not need but
+// the kubeconfig is written for.
+func checkKubectl() kubeconfig.Check {
+	path, err := exec.LookPath("kubectl")
+	if err != nil {
+		return kubeconfig.Check{Name: "kubectl", Status: kubeconfig.CheckWarn, Detail: "not found on $PATH"}
+	}
+	return kubeconfig.Check{Name: "kubectl", Status: kubeconfig.CheckOK, Detail: path}
+}
+
+func checkSymbol(status kubeconfig.CheckStatus) string {
+	switch status {
+	case kubeconfig.CheckOK:
+		return color.GreenString("✓")
+	case kubeconfig.CheckWarn:
+		return color.YellowString("!")
+	default:
+		return color.RedString("✗")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"go.yaml.in/yaml/v3"
+	"kubectm/pkg/kubeconfig"
+	"kubectm/pkg/utils"
+)
+
+// printListUsage prints the usage message for the list command.
+func printListUsage() {
+	color.Cyan(`kubectm list - List the clusters of the selected providers.
+
+Usage: kubectm list [options]
+
+Lists every cluster with its provider, name, region, Kubernetes version,
+status and API endpoint, and the context it has if it is already in the
+kubeconfig. No kubeconfig is downloaded and nothing is written.
+
+Options:
+  --format <f>         Output format: table, json or yaml (default: table). With
+                       json and yaml, log messages go to stderr.
+  --reset-creds        Prompt for the providers to use again, and save the selection.
+  --providers <list>   Comma-separated providers to list instead of the stored selection
+                       (default: $KUBECTM_PROVIDERS).
+  --non-interactive    Never prompt; fail if no providers are selected.
+  --kubeconfig <path>  Kubeconfig to look the clusters up in (default: as for kubectm sync).
+`)
+}
+
+// runList implements `kubectm list`.
+func runList(args []string) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	flags.Usage = printListUsage
+	format := flags.String("format", "table", "Output format: table, json or yaml")
+	selection := addSelectionFlags(flags)
+	flags.StringVar(&kubeconfig.KubeconfigPath, "kubeconfig", "", "Kubeconfig to look the clusters up in")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		printListUsage()
+		os.Exit(2)
+	}
+
+	var write func(io.Writer, []kubeconfig.InventoryEntry) error
+	switch *format {
+	case "table":
+		write = writeInventoryTable
+	case "json":
+		write = writeInventoryJSON
+	case "yaml":
+		write = writeInventoryYAML
+	default:
+		errorLogger.Fatalf("%s Invalid format %q (want table, json or yaml)", iso8601Time(), *format)
+	}
+	if *format != "table" {
+		// Keep stdout parseable.
+		logToStderr()
+	}
+
+	creds, unavailable := selectedCredentials(selection, false)
+	warnUnavailable(unavailable)
+	entries, err := kubeconfig.Inventory(creds)
+	if err != nil {
+		errorLogger.Fatalf("%s Failed to list clusters: %v", iso8601Time(), err)
+	}
+	if err := write(os.Stdout, entries); err != nil {
+		errorLogger.Fatalf("%s Failed to write the cluster list: %v", iso8601Time(), err)
+	}
+}
+
+// logToStderr sends every log message to stderr.
+func logToStderr() {
+	for _, logger := range []interface{ SetOutput(io.Writer) }{
+		infoLogger, warnLogger, actionLogger,
+		utils.InfoLogger, utils.WarnLogger, utils.ActionLogger,
+	} {
+		logger.SetOutput(os.Stderr)
+	}
+}
+
+// writeInventoryTable writes the clusters as a table.
+func writeInventoryTable(w io.Writer, entries []kubeconfig.InventoryEntry) error {
+	if len(entries) == 0 {
+		infoLogger.Printf("%s No clusters found.", iso8601Time())
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\tNAME\tREGION\tVERSION\tSTATUS\tENDPOINT\tIN KUBECONFIG")
+	for _, e := range entries {
+		inKubeconfig := "no"
+		if e.InKubeconfig {
+			inKubeconfig = "yes (" + e.Context + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Provider, e.Name, orDash(e.Region), orDash(e.Version), orDash(e.Status), orDash(e.Endpoint), inKubeconfig)
+	}
+	return tw.Flush()
+}
+
+// writeInventoryJSON writes the clusters as a JSON array.
+func writeInventoryJSON(w io.Writer, entries []kubeconfig.InventoryEntry) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
+}
+
+// writeInventoryYAML writes the clusters as a YAML sequence.
+func writeInventoryYAML(w io.Writer, entries []kubeconfig.InventoryEntry) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(entries); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// orDash returns s, or "-" for an empty table cell.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
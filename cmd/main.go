@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/fatih/color"
 	"kubectm/pkg/credentials"
 	"kubectm/pkg/kubeconfig"
+	"kubectm/pkg/provider"
 	"kubectm/pkg/ui"
 	"log"
 	"os"
@@ -27,6 +29,15 @@ var (
 	actionLogger = log.New(os.Stdout, color.CyanString("[ACTION] "), 0)
 )
 
+// Exit codes. A usage error exits with 2, as the flag package does.
+const (
+	// exitFailure means nothing was synced, including when every provider
+	// failed.
+	exitFailure = 1
+	// exitPartial means some providers failed and the others were synced.
+	exitPartial = 3
+)
+
 // iso8601Time returns the current time in the ISO 8601 format
 func iso8601Time() string {
 	// Format the current time according to the ISO 8601 standard
@@ -34,24 +45,6 @@ func iso8601Time() string {
 	return time.Now().Format(time.RFC3339)
 }
 
-// printUsage prints the usage message for the kubectm command.
-func printUsage() {
-	// Print the usage message
-	color.Cyan(`kubectm - A tool to download and integrate Kubernetes configurations across multiple cloud providers.
-
-Usage: kubectm [options]
-
-Options:
-  -h, --help          Show this help message and exit.
-  -v, --version       Show the version of kubectm.
-  --reset-creds       Reset the stored credentials and prompt for new ones.
-  --backup-count <n>  Number of kubeconfig backups to keep (default: 5).
-
-For more information and source code, visit:
-https://github.com/johnybradshaw/kubectm
-`)
-}
-
 // SaveSelectedCredentialProviders saves the selected credential providers to the specified file.
 //
 // It takes a slice of provider names as an argument.
@@ -174,12 +167,20 @@ func resetStoredCredentials() {
 	warnLogger.Printf("%s Stored credentials have been reset. You'll be prompted to select credentials.", iso8601Time())
 }
 
-// promptAndSelectProviders prompts the user to select credential providers and saves their selection
-func promptAndSelectProviders() []string {
-	creds, err := credentials.RetrieveAll()
+// promptAndSelectProviders prompts the user to select credential providers and, if save is set, saves their selection
+func promptAndSelectProviders(save bool) []string {
+	creds, err := provider.DiscoverAll(context.Background())
 	if err != nil {
 		errorLogger.Fatalf("%s Failed to retrieve credentials: %v", iso8601Time(), err)
 	}
+	// A single set of credentials is used without asking.
+	if len(creds) != 1 && !ui.Interactive() {
+		reason := "no terminal to prompt on"
+		if ui.NonInteractive {
+			reason = "prompting is disabled"
+		}
+		errorLogger.Fatalf("%s Cannot select providers: %s. Pass --providers or set %s, or run kubectm providers select in a terminal.", iso8601Time(), reason, providersEnv)
+	}
 
 	selectedCreds := ui.SelectCredentials(creds)
 
@@ -188,82 +189,217 @@ func promptAndSelectProviders() []string {
 		providers = append(providers, cred.Provider)
 	}
 
-	if err := SaveSelectedCredentialProviders(providers); err != nil {
-		errorLogger.Printf("%s Failed to save selected providers: %v", iso8601Time(), err)
+	if save {
+		if err := SaveSelectedCredentialProviders(providers); err != nil {
+			errorLogger.Printf("%s Failed to save selected providers: %v", iso8601Time(), err)
+		}
 	}
 
 	return providers
 }
 
 // getSelectedProviders loads saved providers or prompts the user to select them
-func getSelectedProviders() []string {
+func getSelectedProviders(save bool) []string {
 	selectedProviders, err := LoadSelectedCredentialProviders()
 	if err != nil || len(selectedProviders) == 0 {
 		warnLogger.Printf("%s No previous credential selections found or an error occurred, prompting user to select credentials.", iso8601Time())
-		return promptAndSelectProviders()
+		return promptAndSelectProviders(save)
 	}
 	infoLogger.Printf("%s Using previously selected credential providers.", iso8601Time())
 	return selectedProviders
 }
 
-// downloadAllConfigs downloads kubeconfig files for all provided credentials
-func downloadAllConfigs(creds []credentials.Credential) {
-	for _, cred := range creds {
-		infoLogger.Printf("%s Downloading kubeconfig from %s", iso8601Time(), cred.Provider)
-		if err := kubeconfig.DownloadConfigs([]credentials.Credential{cred}); err != nil {
-			errorLogger.Fatalf("%s Failed to download kubeconfig files from %s: %v", iso8601Time(), cred.Provider, err)
-		}
+// downloadAllConfigs downloads kubeconfigs for all provided credentials,
+// running the providers concurrently until ctx is cancelled. A provider that
+// fails is recorded in the result and the others are still used, and so is
+// every selected provider that was unavailable; if every provider fails there
+// is nothing to sync and kubectm exits with exitFailure.
+func downloadAllConfigs(ctx context.Context, creds []credentials.Credential, unavailable []provider.Unavailable) *kubeconfig.DownloadResult {
+	downloaded := kubeconfig.DownloadAll(ctx, creds)
+	if ctx.Err() != nil {
+		errorLogger.Fatalf("%s Interrupted; nothing was written.", iso8601Time())
+	}
+	for _, u := range unavailable {
+		downloaded.Failed = append(downloaded.Failed, kubeconfig.ProviderError{Provider: u.Name, Err: u.Err})
 	}
+	for _, failure := range downloaded.Failed {
+		errorLogger.Printf("%s Failed to download kubeconfig files from %s: %v", iso8601Time(), failure.Provider, failure.Err)
+	}
+	if len(creds) > 0 && len(downloaded.Failed) == len(creds)+len(unavailable) {
+		errorLogger.Printf("%s Every provider failed; nothing was synced.", iso8601Time())
+		os.Exit(exitFailure)
+	}
+	return downloaded
 }
 
-func main() {
-	var showHelp bool
-	var showVersion bool
-	var resetCreds bool
-	var backupCount int
+// providersEnv selects providers like --providers does.
+const providersEnv = "KUBECTM_PROVIDERS"
 
-	flag.BoolVar(&showHelp, "help", false, "Show help message")
-	flag.BoolVar(&showHelp, "h", false, "Show help message")
-	flag.BoolVar(&showVersion, "version", false, "Show version information")
-	flag.BoolVar(&showVersion, "v", false, "Show version information")
-	flag.BoolVar(&resetCreds, "reset-creds", false, "Reset stored credentials and prompt for new ones")
-	flag.IntVar(&backupCount, "backup-count", kubeconfig.DefaultBackupCount, "Number of kubeconfig backups to keep")
-	flag.Parse()
+// selectionOptions are the flags that choose a command's providers.
+type selectionOptions struct {
+	resetCreds     bool
+	providers      string
+	nonInteractive bool
+}
+
+// addSelectionFlags registers --reset-creds, --providers and --non-interactive.
+func addSelectionFlags(flags *flag.FlagSet) *selectionOptions {
+	opts := &selectionOptions{}
+	flags.BoolVar(&opts.resetCreds, "reset-creds", false, "Reset stored credentials and prompt for new ones")
+	flags.StringVar(&opts.providers, "providers", "", "Comma-separated providers to use instead of the stored selection")
+	flags.BoolVar(&opts.nonInteractive, "non-interactive", false, "Never prompt; fail instead of asking for providers")
+	return opts
+}
+
+// givenProviders returns the providers from --providers, or else from
+// $KUBECTM_PROVIDERS, or nil if neither is set.
+func (opts *selectionOptions) givenProviders() ([]string, error) {
+	source, value := "--providers", opts.providers
+	if value == "" {
+		source, value = providersEnv, os.Getenv(providersEnv)
+	}
+	if value == "" {
+		return nil, nil
+	}
+	names, err := parseProviderList(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	return names, nil
+}
 
-	if showHelp {
-		printUsage()
-		os.Exit(0)
+// parseProviderList parses a comma-separated list of registered providers,
+// ignoring case and duplicates, into their registered names. A name that is
+// neither built in nor a kubectm-provider-<name> plugin on $PATH is an error,
+// so a typo fails an unattended run instead of being skipped.
+func parseProviderList(value string) ([]string, error) {
+	var names []string
+	for _, given := range strings.Split(value, ",") {
+		given = strings.TrimSpace(given)
+		if given == "" {
+			continue
+		}
+		name := ""
+		for _, registered := range provider.Names() {
+			if strings.EqualFold(given, registered) {
+				name = registered
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("unsupported provider %q: not a built-in provider, and no kubectm-provider-%s plugin on $PATH (available: %s)", given, given, strings.Join(provider.Names(), ", "))
+		}
+		if !containsName(names, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no providers in %q", value)
 	}
+	return names, nil
+}
 
-	if showVersion {
-		color.Cyan("kubectm version %s\n", Version)
-		os.Exit(0)
+// containsName reports whether names includes name.
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
 	}
+	return false
+}
 
-	infoLogger.Printf("%s Starting kubectm...\n", iso8601Time())
+// selectedCredentials returns the credentials of the selected providers, and
+// the selected providers that are unavailable: a plugin that failed, or a
+// stored provider that is no longer registered.
+// Providers given with --providers or $KUBECTM_PROVIDERS are used as they
+// are and never saved. Otherwise the stored selection is used, prompting for
+// it first if there is none or --reset-creds is set. Given providers and
+// --non-interactive disable every prompt. Only a provider selection that
+// cannot be prompted for fails the command; prune confirmations decline and
+// conflicts keep the local edits without asking. With dryRun set the stored
+// selection is neither removed nor rewritten.
+func selectedCredentials(opts *selectionOptions, dryRun bool) ([]credentials.Credential, []provider.Unavailable) {
+	// External kubectm-provider-<name> executables on $PATH join the
+	// built-in providers.
+	provider.RegisterPlugins()
+
+	given, err := opts.givenProviders()
+	if err != nil {
+		errorLogger.Printf("%s Invalid providers: %v", iso8601Time(), err)
+		os.Exit(2)
+	}
+	ui.NonInteractive = opts.nonInteractive || given != nil
+	if opts.resetCreds && ui.NonInteractive {
+		errorLogger.Fatalf("%s --reset-creds prompts for the providers and cannot be combined with --non-interactive, --providers or %s", iso8601Time(), providersEnv)
+	}
 
-	if resetCreds {
+	var selectedProviders []string
+	switch {
+	case given != nil:
+		infoLogger.Printf("%s Using providers %s.", iso8601Time(), strings.Join(given, ", "))
+		selectedProviders = given
+	case opts.resetCreds && dryRun:
+		// Prompt again without removing or rewriting the stored selection.
+		selectedProviders = promptAndSelectProviders(false)
+	case opts.resetCreds:
 		resetStoredCredentials()
+		selectedProviders = getSelectedProviders(true)
+	default:
+		selectedProviders = getSelectedProviders(!dryRun && !ui.NonInteractive)
 	}
 
-	selectedProviders := getSelectedProviders()
-
-	creds, err := credentials.RetrieveSelected(selectedProviders)
+	creds, unavailable, err := provider.DiscoverSelected(context.Background(), selectedProviders)
 	if err != nil {
 		errorLogger.Fatalf("%s Failed to retrieve selected credentials: %v", iso8601Time(), err)
 	}
+	if len(creds) == 0 {
+		for _, u := range unavailable {
+			errorLogger.Printf("%s Provider %s is unavailable: %v", iso8601Time(), u.Name, u.Err)
+		}
+		errorLogger.Fatalf("%s None of the selected providers (%s) is available.", iso8601Time(), strings.Join(selectedProviders, ", "))
+	}
+	return creds, unavailable
+}
 
-	downloadAllConfigs(creds)
-
-	// Back up the existing kubeconfig before the merge modifies it, so a bad
-	// merge is always recoverable.
-	if _, err := kubeconfig.BackupConfig(backupCount); err != nil {
-		errorLogger.Fatalf("%s Failed to back up kubeconfig: %v", iso8601Time(), err)
+// warnUnavailable logs the selected providers a command skips because they
+// are unavailable.
+func warnUnavailable(unavailable []provider.Unavailable) {
+	for _, u := range unavailable {
+		warnLogger.Printf("%s Skipping provider %s: %v", iso8601Time(), u.Name, u.Err)
 	}
+}
 
-	if err := kubeconfig.MergeConfigs(); err != nil {
-		errorLogger.Fatalf("%s Failed to merge kubeconfig files: %v", iso8601Time(), err)
+func main() {
+	kubeconfig.Version = Version
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "-h", "--help", "help":
+			if len(args) > 1 {
+				if cmd, ok := lookupCommand(args[1]); ok {
+					cmd.run([]string{"--help"})
+					return
+				}
+			}
+			printUsage()
+			os.Exit(0)
+		case "-v", "--version", "version":
+			color.Cyan("kubectm version %s\n", Version)
+			os.Exit(0)
+		}
+
+		if cmd, ok := lookupCommand(args[0]); ok {
+			cmd.run(args[1:])
+			return
+		}
+		if !strings.HasPrefix(args[0], "-") {
+			errorLogger.Printf("%s Unknown command %q", iso8601Time(), args[0])
+			printUsage()
+			os.Exit(2)
+		}
 	}
 
-	infoLogger.Printf("%s kubectm finished successfully.", iso8601Time())
+	// Without a command, the arguments are options for the default command.
+	cmd, _ := lookupCommand(defaultCommand)
+	cmd.run(args)
 }
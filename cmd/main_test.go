@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseProviderList(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		want      []string
+		expectErr string
+	}{
+		{name: "case and duplicates", value: "linode, AWS,Linode", want: []string{"Linode", "AWS"}},
+		{name: "typo", value: "aws,linod", expectErr: `unsupported provider "linod"`},
+		{name: "empty", value: " , ", expectErr: "no providers"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseProviderList(tt.value)
+			if tt.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("parseProviderList(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
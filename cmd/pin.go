@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"kubectm/pkg/kubeconfig"
+)
+
+// printPinUsage prints the usage message for the pin command.
+func printPinUsage() {
+	color.Cyan(`kubectm pin - Pin contexts so kubectm never modifies, renames or prunes them.
+
+Usage: kubectm pin <command> [options]
+
+Commands:
+  add <name|pattern>...     Pin contexts by name, or by pattern with * and ?.
+  remove <name|pattern>...  Unpin contexts.
+  list                      List pins and the contexts they match.
+
+Pins are kept in the "pinned" list in ~/.kubectm/config.json. A pinned
+context's cluster and user entries are left alone too, and a sync reports
+when upstream differs from them.
+
+Options:
+  --kubeconfig <path>  Kubeconfig whose contexts list matches (default: as for kubectm).
+`)
+}
+
+// runPin implements `kubectm pin`.
+func runPin(args []string) {
+	if len(args) == 0 {
+		printPinUsage()
+		os.Exit(2)
+	}
+	if args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		printPinUsage()
+		os.Exit(0)
+	}
+	command, args := args[0], args[1:]
+
+	flags := flag.NewFlagSet("pin "+command, flag.ExitOnError)
+	flags.Usage = printPinUsage
+	flags.StringVar(&kubeconfig.KubeconfigPath, "kubeconfig", "", "Kubeconfig whose contexts list matches")
+	flags.Parse(args)
+	args = flags.Args()
+
+	switch {
+	case command == "add" && len(args) > 0:
+		if err := kubeconfig.PinContexts(args...); err != nil {
+			errorLogger.Fatalf("%s Failed to pin contexts: %v", iso8601Time(), err)
+		}
+	case command == "remove" && len(args) > 0:
+		if err := kubeconfig.UnpinContexts(args...); err != nil {
+			errorLogger.Fatalf("%s Failed to unpin contexts: %v", iso8601Time(), err)
+		}
+	case command == "list" && len(args) == 0:
+		listPins()
+	default:
+		printPinUsage()
+		os.Exit(2)
+	}
+}
+
+// listPins prints a table of the pins and the contexts they match.
+func listPins() {
+	pins, err := kubeconfig.ListPins()
+	if err != nil {
+		errorLogger.Fatalf("%s Failed to list pins: %v", iso8601Time(), err)
+	}
+	if len(pins) == 0 {
+		infoLogger.Printf("%s No contexts are pinned.", iso8601Time())
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PIN\tCONTEXTS")
+	for _, pin := range pins {
+		contexts := "-"
+		if len(pin.Contexts) > 0 {
+			contexts = strings.Join(pin.Contexts, ",")
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", pin.Pattern, contexts)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"kubectm/pkg/provider"
+)
+
+// printProvidersUsage prints the usage message for the providers command.
+func printProvidersUsage() {
+	color.Cyan(`kubectm providers - Show the providers and their credentials, or select them again.
+
+Usage: kubectm providers [command]
+
+Commands:
+  list            List every provider, built in or plugin, whether credentials
+                  were found for it and whether it is selected (default).
+  select [<list>] Save the providers to use to ~/.kubectm/selected_providers.json:
+                  the comma-separated list, e.g. linode,aws, or else those chosen
+                  at a prompt.
+`)
+}
+
+// runProviders implements `kubectm providers`.
+func runProviders(args []string) {
+	command := "list"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	if command == "-h" || command == "--help" || command == "help" {
+		printProvidersUsage()
+		os.Exit(0)
+	}
+
+	switch {
+	case command == "list" && len(args) == 0:
+		listProviders()
+	case command == "select" && len(args) == 0:
+		provider.RegisterPlugins()
+		selected := promptAndSelectProviders(true)
+		infoLogger.Printf("%s Selected providers: %s", iso8601Time(), strings.Join(selected, ", "))
+	case command == "select" && len(args) == 1:
+		provider.RegisterPlugins()
+		selected, err := parseProviderList(args[0])
+		if err != nil {
+			errorLogger.Fatalf("%s Invalid providers: %v", iso8601Time(), err)
+		}
+		if err := SaveSelectedCredentialProviders(selected); err != nil {
+			errorLogger.Fatalf("%s Failed to save selected providers: %v", iso8601Time(), err)
+		}
+		infoLogger.Printf("%s Selected providers: %s", iso8601Time(), strings.Join(selected, ", "))
+	default:
+		printProvidersUsage()
+		os.Exit(2)
+	}
+}
+
+// listProviders prints a table of the registered providers.
+func listProviders() {
+	provider.RegisterPlugins()
+	selected, _ := LoadSelectedCredentialProviders()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\tTYPE\tCREDENTIALS\tSELECTED")
+	for _, p := range provider.All() {
+		kind := "built-in"
+		if plugin, ok := p.(*provider.Plugin); ok {
+			kind = "plugin " + plugin.Path()
+		}
+		credentials := "found"
+		if cred, err := p.Discover(context.Background()); err != nil {
+			credentials = "error: " + err.Error()
+		} else if cred == nil {
+			credentials = "none"
+		}
+		isSelected := "no"
+		for _, name := range selected {
+			if name == p.Name() {
+				isSelected = "yes"
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", p.Name(), kind, credentials, isSelected)
+	}
+	tw.Flush()
+}
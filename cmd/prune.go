@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/fatih/color"
+	"kubectm/pkg/kubeconfig"
+	"kubectm/pkg/ui"
+)
+
+// printPruneUsage prints the usage message for the prune command.
+func printPruneUsage() {
+	color.Cyan(`kubectm prune - Remove contexts whose cluster was deleted.
+
+Usage: kubectm prune [options]
+
+Lists the clusters of the selected providers, without downloading any
+kubeconfig, and removes the contexts kubectm created for clusters that have
+been missing for the grace period. Pinned contexts are kept.
+
+Options:
+  --policy <policy>    confirm or auto (default: the "prune" setting, or confirm
+                       when it is unset or off).
+  --grace <d>          How long a cluster must be missing before pruning (default: 24h).
+  --dry-run            Show what would be removed without writing any files.
+  --diff               Print a unified diff of the kubeconfig with secrets redacted.
+  --output <mode>      Prune the kubeconfig, or the files in kubectm.d: merge, provider
+                       or cluster (default: merge).
+  --backup-count <n>   Number of kubeconfig backups to keep (default: 5).
+  --reset-creds        Prompt for the providers to use again, and save the selection.
+  --providers <list>   Comma-separated providers to list instead of the stored selection
+                       (default: $KUBECTM_PROVIDERS).
+  --non-interactive    Never prompt: fail if no providers are selected, and prune nothing
+                       under the confirm policy.
+  --kubeconfig <path>  Kubeconfig to prune (default: as for kubectm sync).
+`)
+}
+
+// runPrune implements `kubectm prune`.
+func runPrune(args []string) {
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	flags.Usage = printPruneUsage
+
+	var policy, grace, outputMode string
+	var dryRun, showDiff bool
+	var backupCount int
+	flags.StringVar(&policy, "policy", "", "confirm or auto")
+	flags.StringVar(&grace, "grace", "", "How long a cluster must be missing before pruning")
+	flags.BoolVar(&dryRun, "dry-run", false, "Show what would be removed without writing any files")
+	flags.BoolVar(&showDiff, "diff", false, "Print a unified diff of the kubeconfig with secrets redacted")
+	flags.StringVar(&outputMode, "output", "", "Prune the kubeconfig, or the files in kubectm.d")
+	flags.IntVar(&backupCount, "backup-count", kubeconfig.DefaultBackupCount, "Number of kubeconfig backups to keep")
+	flags.StringVar(&kubeconfig.KubeconfigPath, "kubeconfig", "", "Kubeconfig to prune")
+	selection := addSelectionFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		printPruneUsage()
+		os.Exit(2)
+	}
+
+	pruneOptions, err := kubeconfig.ResolvePruneOptions(policy, grace)
+	if err != nil {
+		errorLogger.Fatalf("%s Invalid prune settings: %v", iso8601Time(), err)
+	}
+	if pruneOptions.Policy == kubeconfig.PruneOff {
+		if policy != "" {
+			errorLogger.Fatalf("%s kubectm prune needs --policy confirm or auto", iso8601Time())
+		}
+		// Asking to prune overrides a "prune": "off" meant for syncs.
+		pruneOptions.Policy = kubeconfig.PruneConfirm
+	}
+	pruneOptions.Confirm = ui.ConfirmPrune
+
+	output, err := kubeconfig.ResolveOutputMode(outputMode)
+	if err != nil {
+		errorLogger.Fatalf("%s Invalid output mode: %v", iso8601Time(), err)
+	}
+
+	creds, unavailable := selectedCredentials(selection, dryRun)
+	warnUnavailable(unavailable)
+	_, listing, err := kubeconfig.ListClusters(creds)
+	if err != nil {
+		errorLogger.Fatalf("%s Failed to list clusters: %v", iso8601Time(), err)
+	}
+	providers := make([]string, 0, len(creds))
+	for _, cred := range creds {
+		providers = append(providers, cred.Provider)
+	}
+
+	// With no configs to merge, a merge only prunes.
+	report, err := kubeconfig.MergeConfigs(listing, kubeconfig.MergeOptions{
+		DryRun:         dryRun,
+		Prune:          pruneOptions,
+		BackupCount:    backupCount,
+		Providers:      providers,
+		Output:         output,
+		CurrentContext: kubeconfig.CurrentContextOptions{Policy: kubeconfig.CurrentContextKeep},
+	})
+	if err != nil {
+		errorLogger.Fatalf("%s Prune failed: %v", iso8601Time(), err)
+	}
+	report.Print(os.Stdout)
+	printDiff(report, showDiff)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"kubectm/pkg/kubeconfig"
+)
+
+// printRenameUsage prints the usage message for the rename command.
+func printRenameUsage() {
+	color.Cyan(`kubectm rename - Rename contexts in a kubeconfig with regex or template rules.
+
+Usage: kubectm rename [options]
+
+Options:
+  --match <regex>      Rename contexts whose name matches the expression.
+  --replace <repl>     Replacement for each match, with $1 or ${name} for submatches.
+  --template <tmpl>    New name as a Go template, e.g. '{{index .Groups 1}}-{{.Namespace}}'.
+  --clusters           Also rename the cluster entries of renamed contexts.
+  --users              Also rename the user entries of renamed contexts.
+  --preview            Show the renames without writing any files.
+  --diff               Print a unified diff of the kubeconfig with secrets redacted.
+  --backup-count <n>   Number of kubeconfig backups to keep (default: 5).
+  --kubeconfig <path>  Kubeconfig to rename contexts in (default: as for kubectm).
+
+Without --match, the "rename" rules in ~/.kubectm/config.json are applied.
+`)
+}
+
+// runRename implements `kubectm rename`.
+func runRename(args []string) {
+	flags := flag.NewFlagSet("rename", flag.ExitOnError)
+	flags.Usage = printRenameUsage
+
+	var rule kubeconfig.RenameRule
+	var opts kubeconfig.RenameOptions
+	var showDiff bool
+	flags.StringVar(&rule.Match, "match", "", "Rename contexts whose name matches the expression")
+	flags.StringVar(&rule.Replace, "replace", "", "Replacement for each match, with $1 or ${name} for submatches")
+	flags.StringVar(&rule.Template, "template", "", "New name as a Go template")
+	flags.BoolVar(&opts.Clusters, "clusters", false, "Also rename the cluster entries of renamed contexts")
+	flags.BoolVar(&opts.Users, "users", false, "Also rename the user entries of renamed contexts")
+	flags.BoolVar(&opts.DryRun, "preview", false, "Show the renames without writing any files")
+	flags.BoolVar(&showDiff, "diff", false, "Print a unified diff of the kubeconfig with secrets redacted")
+	flags.IntVar(&opts.BackupCount, "backup-count", kubeconfig.DefaultBackupCount, "Number of kubeconfig backups to keep")
+	flags.StringVar(&kubeconfig.KubeconfigPath, "kubeconfig", "", "Kubeconfig to rename contexts in")
+	flags.Parse(args)
+
+	switch {
+	case rule.Match != "" && rule.Replace == "" && rule.Template == "":
+		errorLogger.Fatalf("%s --match requires --replace or --template", iso8601Time())
+	case rule.Match != "":
+		opts.Rules = []kubeconfig.RenameRule{rule}
+	case rule.Replace != "" || rule.Template != "":
+		errorLogger.Fatalf("%s --replace and --template require --match", iso8601Time())
+	default:
+		rules, err := kubeconfig.LoadRenameRules()
+		if err != nil {
+			errorLogger.Fatalf("%s Failed to load rename rules: %v", iso8601Time(), err)
+		}
+		if len(rules) == 0 {
+			printRenameUsage()
+			os.Exit(2)
+		}
+		opts.Rules = rules
+	}
+
+	report, err := kubeconfig.RenameContexts(opts)
+	if err != nil {
+		errorLogger.Fatalf("%s Failed to rename contexts: %v", iso8601Time(), err)
+	}
+	report.Print(os.Stdout)
+
+	if showDiff {
+		diff, err := report.Diff()
+		if err != nil {
+			errorLogger.Fatalf("%s Failed to compute kubeconfig diff: %v", iso8601Time(), err)
+		}
+		fmt.Print(diff)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/fatih/color"
+	"kubectm/pkg/kubeconfig"
+	"kubectm/pkg/ui"
+)
+
+// printSyncUsage prints the usage message for the sync command.
+func printSyncUsage() {
+	color.Cyan(`kubectm sync - Download kubeconfigs from the selected providers and merge them.
+
+Usage: kubectm sync [options]
+       kubectm [options]
+
+Options:
+  --reset-creds       Reset the stored credentials and prompt for new ones.
+  --providers <list>  Comma-separated providers to use, e.g. linode,aws, instead of the
+                      stored selection, which is left as it is. Defaults to $KUBECTM_PROVIDERS.
+  --non-interactive   Never prompt. Fails if no providers are selected, and handles
+                      pruning and conflicts as without a terminal. Implied by --providers
+                      and $KUBECTM_PROVIDERS.
+  --backup-count <n>  Number of kubeconfig backups to keep (default: 5).
+  --dry-run           Show what would change without writing any files.
+  --diff              Print a unified diff of the kubeconfig with secrets redacted.
+  --prune <policy>    Contexts whose cluster was deleted: off, confirm or auto (default: confirm).
+  --prune-grace <d>   How long a cluster must be missing before pruning (default: 24h).
+  --conflicts <p>     Local edits to synced entries that conflict with upstream changes:
+                      prefer-local, prefer-remote or prompt (default: prompt).
+  --current-context <c>
+                      Current context after the sync: keep, newest (the last cluster the
+                      sync added) or a context name (default: keep).
+  --output <mode>     merge into the kubeconfig, or write one file per provider or cluster
+                      to kubectm.d next to it: merge, provider or cluster (default: merge).
+  --kubeconfig <path> Kubeconfig to sync into. Defaults to $KUBECTM_KUBECONFIG, then the
+                      file kubectl writes to from $KUBECONFIG, then ~/.kube/config.
+`)
+}
+
+// runSync implements `kubectm sync`, which plain `kubectm` also runs.
+func runSync(args []string) {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	flags.Usage = printSyncUsage
+
+	var backupCount int
+	var dryRun bool
+	var showDiff bool
+	var prunePolicy string
+	var pruneGrace string
+	var outputMode string
+	var conflictPolicy string
+	var currentContext string
+
+	selection := addSelectionFlags(flags)
+	flags.IntVar(&backupCount, "backup-count", kubeconfig.DefaultBackupCount, "Number of kubeconfig backups to keep")
+	flags.BoolVar(&dryRun, "dry-run", false, "Show what would change without writing any files")
+	flags.BoolVar(&showDiff, "diff", false, "Print a unified diff of the kubeconfig with secrets redacted")
+	flags.StringVar(&prunePolicy, "prune", "", "What to do with contexts whose cluster was deleted: off, confirm or auto (default confirm)")
+	flags.StringVar(&pruneGrace, "prune-grace", "", "How long a cluster must be missing before its context is pruned (default 24h)")
+	flags.StringVar(&kubeconfig.KubeconfigPath, "kubeconfig", "", "Kubeconfig to sync into")
+	flags.StringVar(&conflictPolicy, "conflicts", "", "Local edits that conflict with upstream changes: prefer-local, prefer-remote or prompt (default prompt)")
+	flags.StringVar(&currentContext, "current-context", "", "Current context after the sync: keep, newest or a context name (default keep)")
+	flags.StringVar(&outputMode, "output", "", "Where to write clusters: merge, provider or cluster (default merge)")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		printSyncUsage()
+		os.Exit(2)
+	}
+
+	infoLogger.Printf("%s Starting kubectm...\n", iso8601Time())
+
+	pruneOptions, err := kubeconfig.ResolvePruneOptions(prunePolicy, pruneGrace)
+	if err != nil {
+		errorLogger.Fatalf("%s Invalid prune settings: %v", iso8601Time(), err)
+	}
+	pruneOptions.Confirm = ui.ConfirmPrune
+
+	conflictOptions, err := kubeconfig.ResolveConflictOptions(conflictPolicy)
+	if err != nil {
+		errorLogger.Fatalf("%s Invalid conflict policy: %v", iso8601Time(), err)
+	}
+	conflictOptions.Resolve = ui.ResolveConflict
+
+	currentContextOptions, err := kubeconfig.ResolveCurrentContext(currentContext)
+	if err != nil {
+		errorLogger.Fatalf("%s Invalid current context: %v", iso8601Time(), err)
+	}
+
+	output, err := kubeconfig.ResolveOutputMode(outputMode)
+	if err != nil {
+		errorLogger.Fatalf("%s Invalid output mode: %v", iso8601Time(), err)
+	}
+
+	namer, err := kubeconfig.LoadNamer()
+	if err != nil {
+		errorLogger.Fatalf("%s Invalid naming rules: %v", iso8601Time(), err)
+	}
+
+	if dryRun {
+		infoLogger.Printf("%s Dry run: no files will be written.", iso8601Time())
+	}
+
+	creds, unavailable := selectedCredentials(selection, dryRun)
+
+	// Ctrl-C cancels the downloads of every provider; a second one kills kubectm.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	downloaded := downloadAllConfigs(ctx, creds, unavailable)
+	stop()
+
+	kubeconfig.RenameConfigs(downloaded, namer)
+
+	providers := make([]string, 0, len(creds))
+	for _, cred := range creds {
+		if !providerFailed(downloaded, cred.Provider) {
+			providers = append(providers, cred.Provider)
+		}
+	}
+
+	report, err := kubeconfig.MergeConfigs(downloaded, kubeconfig.MergeOptions{
+		DryRun:         dryRun,
+		Prune:          pruneOptions,
+		BackupCount:    backupCount,
+		Providers:      providers,
+		Output:         output,
+		Conflicts:      conflictOptions,
+		CurrentContext: currentContextOptions,
+	})
+	if err != nil {
+		errorLogger.Fatalf("%s Sync failed: %v", iso8601Time(), err)
+	}
+
+	report.Print(os.Stdout)
+	if report.Kubeconfig != "" {
+		infoLogger.Printf("%s To use the split kubeconfigs, set KUBECONFIG=%s or source kubeconfig.env in %s", iso8601Time(), report.Kubeconfig, report.Path)
+	}
+	printDiff(report, showDiff)
+
+	if len(downloaded.Failed) > 0 {
+		failed := make([]string, 0, len(downloaded.Failed))
+		for _, failure := range downloaded.Failed {
+			failed = append(failed, failure.Provider)
+		}
+		warnLogger.Printf("%s kubectm finished with errors: synced %s; failed %s.", iso8601Time(), strings.Join(providers, ", "), strings.Join(failed, ", "))
+		os.Exit(exitPartial)
+	}
+	infoLogger.Printf("%s kubectm finished successfully.", iso8601Time())
+}
+
+// providerFailed reports whether the download of the named provider failed.
+func providerFailed(downloaded *kubeconfig.DownloadResult, name string) bool {
+	for _, failure := range downloaded.Failed {
+		if failure.Provider == name {
+			return true
+		}
+	}
+	return false
+}
+
+// printDiff prints the redacted diff of the kubeconfig a report describes,
+// if show is set.
+func printDiff(report *kubeconfig.Report, show bool) {
+	if !show {
+		return
+	}
+	diff, err := report.Diff()
+	if err != nil {
+		errorLogger.Fatalf("%s Failed to compute kubeconfig diff: %v", iso8601Time(), err)
+	}
+	if diff == "" {
+		infoLogger.Printf("%s No changes to the kubeconfig.", iso8601Time())
+	} else {
+		fmt.Print(diff)
+	}
+}
@@ -132,6 +132,7 @@ func parseAWSCredentialsFile(content []byte, profile string) *Credential {
 	details := map[string]string{
 		"AccessKey": accessKeyID,
 		"SecretKey": secretAccessKey,
+		"Profile":   profile,
 	}
 	if sessionToken != "" {
 		details["SessionToken"] = sessionToken
@@ -1,16 +1,149 @@
 package credentials
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"kubectm/pkg/utils"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// azureProfile is the subset of the Azure CLI's azureProfile.json kubectm reads.
+type azureProfile struct {
+	Subscriptions []struct {
+		ID        string `json:"id"`
+		Name      string `json:"name"`
+		State     string `json:"state"`
+		TenantID  string `json:"tenantId"`
+		IsDefault bool   `json:"isDefault"`
+	} `json:"subscriptions"`
+}
+
+// retrieveAzureCredentials retrieves Azure credentials from the service
+// principal environment variables or the Azure CLI profile in ~/.azure.
+//
+// Service principal credentials are used directly. For the CLI profile only
+// the tenant and subscriptions are recorded; tokens are obtained from the
+// `az` CLI at download time, so kubectm never reads the CLI's token cache.
 func retrieveAzureCredentials() (*Credential, error) {
-    // Logic to retrieve Azure credentials
-    // return &Credential{
-    //     Provider: "Azure",
-    //     Details: map[string]string{
-    //         "ClientID":       "your-client-id",
-    //         "ClientSecret":   "your-client-secret",
-    //         "SubscriptionID": "your-subscription-id",
-    //         "TenantID":       "your-tenant-id",
-    //     },
-    // }, nil
-
-    return nil, nil
-}
\ No newline at end of file
+	clientID := os.Getenv("AZURE_CLIENT_ID")
+	clientSecret := os.Getenv("AZURE_CLIENT_SECRET")
+	tenantID := os.Getenv("AZURE_TENANT_ID")
+
+	if clientID != "" && clientSecret != "" && tenantID != "" {
+		details := map[string]string{
+			"AuthMethod":   "ClientSecret",
+			"ClientID":     clientID,
+			"ClientSecret": clientSecret,
+			"TenantID":     tenantID,
+		}
+		if subscriptionID := os.Getenv("AZURE_SUBSCRIPTION_ID"); subscriptionID != "" {
+			details["SubscriptionIDs"] = subscriptionID
+		}
+
+		utils.InfoLogger.Printf("%s Azure credentials found via environment variables", utils.Iso8601Time())
+
+		return &Credential{
+			Provider: "Azure",
+			Details:  details,
+		}, nil
+	}
+
+	configDir, err := azureConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	profilePath := filepath.Join(configDir, "azureProfile.json")
+
+	utils.InfoLogger.Printf("%s Looking for Azure CLI profile", utils.Iso8601Time())
+
+	content, err := os.ReadFile(profilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			utils.WarnLogger.Printf("%s Azure CLI profile not found", utils.Iso8601Time())
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading Azure CLI profile: %v", err)
+	}
+
+	cred, err := parseAzureProfile(content)
+	if err != nil {
+		return nil, err
+	}
+	if cred == nil {
+		utils.WarnLogger.Printf("%s No enabled subscriptions found in Azure CLI profile", utils.Iso8601Time())
+		return nil, nil
+	}
+
+	utils.InfoLogger.Printf("%s Azure credentials found via Azure CLI profile", utils.Iso8601Time())
+	return cred, nil
+}
+
+// parseAzureProfile returns a credential for the tenant of the default
+// subscription, listing every enabled subscription in that tenant. It returns
+// nil when the profile has no usable subscriptions (e.g. after `az logout`).
+func parseAzureProfile(content []byte) (*Credential, error) {
+	// The Azure CLI writes azureProfile.json with a UTF-8 byte order mark.
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+
+	var profile azureProfile
+	if err := json.Unmarshal(content, &profile); err != nil {
+		return nil, fmt.Errorf("error parsing Azure CLI profile: %v", err)
+	}
+
+	tenantID := ""
+	for _, sub := range profile.Subscriptions {
+		if sub.IsDefault {
+			tenantID = sub.TenantID
+			break
+		}
+	}
+
+	var subscriptionIDs []string
+	for _, sub := range profile.Subscriptions {
+		if sub.State != "Enabled" || sub.ID == "" {
+			continue
+		}
+		if tenantID == "" {
+			tenantID = sub.TenantID
+		}
+		if sub.TenantID == tenantID {
+			subscriptionIDs = append(subscriptionIDs, sub.ID)
+		}
+	}
+
+	if len(subscriptionIDs) == 0 {
+		return nil, nil
+	}
+
+	return &Credential{
+		Provider: "Azure",
+		Details: map[string]string{
+			"AuthMethod":      "AzureCLI",
+			"TenantID":        tenantID,
+			"SubscriptionIDs": strings.Join(subscriptionIDs, ","),
+		},
+	}, nil
+}
+
+// azureConfigDir returns the Azure CLI configuration directory, honouring
+// AZURE_CONFIG_DIR and otherwise defaulting to ~/.azure.
+func azureConfigDir() (string, error) {
+	if dir := os.Getenv("AZURE_CONFIG_DIR"); dir != "" {
+		return filepath.Clean(dir), nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting home directory: %v", err)
+	}
+	homeDir = filepath.Clean(homeDir)
+
+	configDir := filepath.Join(homeDir, ".azure")
+	if !strings.HasPrefix(configDir, homeDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid Azure config path")
+	}
+	return configDir, nil
+}
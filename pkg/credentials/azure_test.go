@@ -0,0 +1,127 @@
+package credentials
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testAzureProfile = "\xef\xbb\xbf" + `{
+  "installationId": "abc",
+  "subscriptions": [
+    {"id": "sub-1", "name": "Production", "state": "Enabled", "tenantId": "tenant-a", "isDefault": true},
+    {"id": "sub-2", "name": "Staging", "state": "Enabled", "tenantId": "tenant-a", "isDefault": false},
+    {"id": "sub-3", "name": "Old", "state": "Disabled", "tenantId": "tenant-a", "isDefault": false},
+    {"id": "sub-4", "name": "Other tenant", "state": "Enabled", "tenantId": "tenant-b", "isDefault": false}
+  ]
+}`
+
+// setupAzureTestEnv clears the Azure environment variables and points HOME at
+// a temp directory, returning the ~/.azure path.
+func setupAzureTestEnv(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, key := range []string{"AZURE_CLIENT_ID", "AZURE_CLIENT_SECRET", "AZURE_TENANT_ID", "AZURE_SUBSCRIPTION_ID", "AZURE_CONFIG_DIR"} {
+		t.Setenv(key, "")
+	}
+	configDir := filepath.Join(home, ".azure")
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		t.Fatalf("failed to create .azure dir: %v", err)
+	}
+	return configDir
+}
+
+func TestRetrieveAzureCredentialsFromEnv(t *testing.T) {
+	setupAzureTestEnv(t)
+	t.Setenv("AZURE_CLIENT_ID", "client-id")
+	t.Setenv("AZURE_CLIENT_SECRET", "client-secret")
+	t.Setenv("AZURE_TENANT_ID", "tenant-id")
+	t.Setenv("AZURE_SUBSCRIPTION_ID", "sub-id")
+
+	cred, err := retrieveAzureCredentials()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cred == nil {
+		t.Fatal("expected credentials, got nil")
+	}
+	if cred.Provider != "Azure" {
+		t.Errorf("expected provider Azure, got %s", cred.Provider)
+	}
+	if cred.Details["AuthMethod"] != "ClientSecret" {
+		t.Errorf("expected ClientSecret auth method, got %q", cred.Details["AuthMethod"])
+	}
+	if cred.Details["SubscriptionIDs"] != "sub-id" {
+		t.Errorf("expected subscription sub-id, got %q", cred.Details["SubscriptionIDs"])
+	}
+}
+
+func TestRetrieveAzureCredentialsFromCLIProfile(t *testing.T) {
+	configDir := setupAzureTestEnv(t)
+	if err := os.WriteFile(filepath.Join(configDir, "azureProfile.json"), []byte(testAzureProfile), 0600); err != nil {
+		t.Fatalf("failed to write profile: %v", err)
+	}
+
+	cred, err := retrieveAzureCredentials()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cred == nil {
+		t.Fatal("expected credentials, got nil")
+	}
+	if cred.Details["AuthMethod"] != "AzureCLI" {
+		t.Errorf("expected AzureCLI auth method, got %q", cred.Details["AuthMethod"])
+	}
+	if cred.Details["TenantID"] != "tenant-a" {
+		t.Errorf("expected default subscription's tenant, got %q", cred.Details["TenantID"])
+	}
+	if cred.Details["SubscriptionIDs"] != "sub-1,sub-2" {
+		t.Errorf("expected enabled subscriptions in tenant-a, got %q", cred.Details["SubscriptionIDs"])
+	}
+}
+
+func TestRetrieveAzureCredentialsIncompleteEnvFallsBackToProfile(t *testing.T) {
+	setupAzureTestEnv(t)
+	t.Setenv("AZURE_CLIENT_ID", "client-id")
+
+	cred, err := retrieveAzureCredentials()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cred != nil {
+		t.Errorf("expected nil credentials without a secret or CLI profile, got %+v", cred)
+	}
+}
+
+func TestParseAzureProfile(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		expectNil bool
+		expectErr bool
+	}{
+		{name: "profile with subscriptions", content: testAzureProfile},
+		{name: "logged out profile", content: `{"subscriptions": []}`, expectNil: true},
+		{name: "only disabled subscriptions", content: `{"subscriptions": [{"id": "s", "state": "Disabled", "tenantId": "t", "isDefault": true}]}`, expectNil: true},
+		{name: "malformed JSON", content: `{`, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cred, err := parseAzureProfile([]byte(tt.content))
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (cred == nil) != tt.expectNil {
+				t.Errorf("expected nil=%v, got %+v", tt.expectNil, cred)
+			}
+		})
+	}
+}
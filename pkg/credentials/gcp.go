@@ -1,15 +1,205 @@
 package credentials
 
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"kubectm/pkg/utils"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gcpCredentialsFile is the subset of a Google credentials JSON file that
+// kubectm understands. Service account keys and gcloud application default
+// credentials (authorized_user) share this layout.
+type gcpCredentialsFile struct {
+	Type           string `json:"type"`
+	ProjectID      string `json:"project_id"`
+	QuotaProjectID string `json:"quota_project_id"`
+	ClientEmail    string `json:"client_email"`
+	PrivateKey     string `json:"private_key"`
+	TokenURI       string `json:"token_uri"`
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+}
+
+// retrieveGCPCredentials retrieves GCP credentials from the file referenced by
+// GOOGLE_APPLICATION_CREDENTIALS or from gcloud's application default
+// credentials. The project is taken from the environment, the credentials
+// file, or the active gcloud configuration's core/project property.
 func retrieveGCPCredentials() (*Credential, error) {
-    // Logic to retrieve GCP credentials
-    // return &Credential{
-    //     Provider: "GCP",
-    //     Details: map[string]string{
-    //         "ProjectID":   "your-project-id",
-    //         "ClientEmail": "your-client-email",
-    //         "PrivateKey":  "your-private-key",
-    //     },
-    // }, nil
-
-    return nil, nil
-}
\ No newline at end of file
+	configDir, err := gcloudConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	credentialsPath := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	source := "GOOGLE_APPLICATION_CREDENTIALS"
+	if credentialsPath == "" {
+		credentialsPath = filepath.Join(configDir, "application_default_credentials.json")
+		source = "gcloud application default credentials"
+	}
+
+	utils.InfoLogger.Printf("%s Looking for GCP credentials via %s", utils.Iso8601Time(), source)
+
+	content, err := os.ReadFile(filepath.Clean(credentialsPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			utils.WarnLogger.Printf("%s GCP credentials file not found", utils.Iso8601Time())
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading GCP credentials file: %v", err)
+	}
+
+	cred, err := parseGCPCredentialsFile(content)
+	if err != nil {
+		return nil, err
+	}
+
+	if cred.Details["ProjectID"] == "" {
+		cred.Details["ProjectID"] = gcpProjectFromEnvironment(configDir)
+	}
+	if cred.Details["ProjectID"] == "" {
+		return nil, fmt.Errorf("GCP credentials found but no project is configured; set core/project with `gcloud config set project`")
+	}
+
+	utils.InfoLogger.Printf("%s GCP credentials found via %s", utils.Iso8601Time(), source)
+	return cred, nil
+}
+
+// parseGCPCredentialsFile parses a service account key or an authorized_user
+// application default credentials file.
+func parseGCPCredentialsFile(content []byte) (*Credential, error) {
+	var file gcpCredentialsFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("error parsing GCP credentials file: %v", err)
+	}
+
+	details := map[string]string{
+		"Type": file.Type,
+	}
+	if file.TokenURI != "" {
+		details["TokenURI"] = file.TokenURI
+	}
+
+	switch file.Type {
+	case "service_account":
+		if file.ClientEmail == "" || file.PrivateKey == "" {
+			return nil, fmt.Errorf("GCP service account key is missing client_email or private_key")
+		}
+		details["ClientEmail"] = file.ClientEmail
+		details["PrivateKey"] = file.PrivateKey
+		details["ProjectID"] = file.ProjectID
+	case "authorized_user":
+		if file.ClientID == "" || file.ClientSecret == "" || file.RefreshToken == "" {
+			return nil, fmt.Errorf("GCP application default credentials are missing client_id, client_secret or refresh_token")
+		}
+		details["ClientID"] = file.ClientID
+		details["ClientSecret"] = file.ClientSecret
+		details["RefreshToken"] = file.RefreshToken
+		details["ProjectID"] = file.QuotaProjectID
+	default:
+		return nil, fmt.Errorf("unsupported GCP credentials type %q", file.Type)
+	}
+
+	return &Credential{
+		Provider: "GCP",
+		Details:  details,
+	}, nil
+}
+
+// gcloudConfigDir returns the gcloud configuration directory, honouring
+// CLOUDSDK_CONFIG and otherwise defaulting to ~/.config/gcloud.
+func gcloudConfigDir() (string, error) {
+	if dir := os.Getenv("CLOUDSDK_CONFIG"); dir != "" {
+		return filepath.Clean(dir), nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting home directory: %v", err)
+	}
+	homeDir = filepath.Clean(homeDir)
+
+	configDir := filepath.Join(homeDir, ".config", "gcloud")
+	if !strings.HasPrefix(configDir, homeDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid gcloud config path")
+	}
+	return configDir, nil
+}
+
+// gcpProjectFromEnvironment returns the project to use when the credentials
+// file does not name one. Environment variables take precedence over the
+// active gcloud configuration.
+func gcpProjectFromEnvironment(configDir string) string {
+	for _, key := range []string{"CLOUDSDK_CORE_PROJECT", "GOOGLE_CLOUD_PROJECT"} {
+		if project := os.Getenv(key); project != "" {
+			return project
+		}
+	}
+
+	activeConfig := "default"
+	if data, err := os.ReadFile(filepath.Join(configDir, "active_config")); err == nil {
+		if name := strings.TrimSpace(string(data)); name != "" {
+			activeConfig = name
+		}
+	}
+	if os.Getenv("CLOUDSDK_ACTIVE_CONFIG_NAME") != "" {
+		activeConfig = os.Getenv("CLOUDSDK_ACTIVE_CONFIG_NAME")
+	}
+
+	// Configuration names are chosen by the user; refuse anything that could
+	// step outside the configurations directory.
+	if strings.ContainsAny(activeConfig, `/\`) || strings.Contains(activeConfig, "..") {
+		utils.WarnLogger.Printf("%s Ignoring invalid gcloud configuration name %q", utils.Iso8601Time(), activeConfig)
+		return ""
+	}
+
+	candidates := []string{
+		filepath.Join(configDir, "configurations", "config_"+activeConfig),
+		filepath.Join(configDir, "properties"),
+	}
+	for _, path := range candidates {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if project := parseGCloudProperties(data, "core", "project"); project != "" {
+			return project
+		}
+	}
+
+	return ""
+}
+
+// parseGCloudProperties returns the value of key in the given section of a
+// gcloud INI-style properties file.
+func parseGCloudProperties(content []byte, section, key string) string {
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	inSection := false
+	sectionHeader := fmt.Sprintf("[%s]", section)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inSection = line == sectionHeader
+			continue
+		}
+
+		if inSection {
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) == 2 && strings.TrimSpace(parts[0]) == key {
+				return strings.TrimSpace(parts[1])
+			}
+		}
+	}
+
+	return ""
+}
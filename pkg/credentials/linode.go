@@ -72,6 +72,7 @@ func retrieveLinodeCredentials() (*Credential, error) {
             Provider: "Linode",
             Details: map[string]string{
                 "AccessToken": accessToken,
+                "Profile":     defaultProfile,
             },
         }, nil
     }
@@ -1,7 +1,6 @@
 package credentials
 
 import (
-	"errors"
 	"fmt"
 	"kubectm/pkg/utils"
 )
@@ -24,86 +23,27 @@ func logCredentialDiscovery(provider string, cred *Credential) {
 	utils.InfoLogger.Printf("%s %s credentials found: %v", utils.Iso8601Time(), provider, obfuscated)
 }
 
-// RetrieveAll retrieves all available credentials from the environment.
-// Credential failures are non-fatal: each provider is attempted independently,
-// errors are logged and skipped. Returns an error only if no credentials are found at all.
-func RetrieveAll() ([]Credential, error) {
-	var credentials []Credential
-
-	// Discover AWS credentials
-	awsCreds, err := retrieveAWSCredentials()
-	if err != nil {
-		utils.ErrorLogger.Printf("%s Error retrieving AWS credentials: %v", utils.Iso8601Time(), err)
-	} else if awsCreds != nil {
-		logCredentialDiscovery("AWS", awsCreds)
-		credentials = append(credentials, *awsCreds)
-	}
-
-	// Discover Azure credentials
-	azureCreds, err := retrieveAzureCredentials()
-	if err != nil {
-		utils.ErrorLogger.Printf("%s Error retrieving Azure credentials: %v", utils.Iso8601Time(), err)
-	} else if azureCreds != nil {
-		logCredentialDiscovery("Azure", azureCreds)
-		credentials = append(credentials, *azureCreds)
-	}
+// retrievers maps each built-in provider name to its credential discovery
+// function.
+var retrievers = map[string]func() (*Credential, error){
+	"AWS":    retrieveAWSCredentials,
+	"Azure":  retrieveAzureCredentials,
+	"GCP":    retrieveGCPCredentials,
+	"Linode": retrieveLinodeCredentials,
+}
 
-	// Discover GCP credentials
-	gcpCreds, err := retrieveGCPCredentials()
-	if err != nil {
-		utils.ErrorLogger.Printf("%s Error retrieving GCP credentials: %v", utils.Iso8601Time(), err)
-	} else if gcpCreds != nil {
-		logCredentialDiscovery("GCP", gcpCreds)
-		credentials = append(credentials, *gcpCreds)
+// Retrieve discovers the credentials for a single built-in provider. It
+// returns nil, nil when the provider has no credentials configured.
+func Retrieve(provider string) (*Credential, error) {
+	retrieve, ok := retrievers[provider]
+	if !ok {
+		return nil, fmt.Errorf("unsupported provider: %s", provider)
 	}
 
-	// Discover Linode credentials
-	linodeCreds, err := retrieveLinodeCredentials()
+	cred, err := retrieve()
 	if err != nil {
-		utils.ErrorLogger.Printf("%s Error retrieving Linode credentials: %v", utils.Iso8601Time(), err)
-	} else if linodeCreds != nil {
-		logCredentialDiscovery("Linode", linodeCreds)
-		credentials = append(credentials, *linodeCreds)
-	}
-
-	if len(credentials) == 0 {
-		return nil, errors.New("no credentials found")
+		return nil, err
 	}
-
-	return credentials, nil
-}
-
-// RetrieveSelected retrieves credentials for the specified providers.
-// All selected providers are required: if any provider fails or is not found,
-// an error is returned immediately. Use this when the user has explicitly chosen providers.
-func RetrieveSelected(selectedProviders []string) ([]Credential, error) {
-	var creds []Credential
-
-	for _, provider := range selectedProviders {
-		var cred *Credential
-		var err error
-
-		switch provider {
-		case "AWS":
-			cred, err = retrieveAWSCredentials()
-		case "Azure":
-			cred, err = retrieveAzureCredentials()
-		case "GCP":
-			cred, err = retrieveGCPCredentials()
-		case "Linode":
-			cred, err = retrieveLinodeCredentials()
-		default:
-			return nil, fmt.Errorf("unsupported provider: %s", provider)
-		}
-
-		if err != nil {
-			return nil, fmt.Errorf("error retrieving %s credentials: %v", provider, err)
-		}
-		if cred == nil {
-			return nil, fmt.Errorf("%s credentials not found", provider)
-		}
-		creds = append(creds, *cred)
-	}
-
-	return creds, nil
+	logCredentialDiscovery(provider, cred)
+	return cred, nil
 }
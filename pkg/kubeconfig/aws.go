@@ -3,17 +3,16 @@ package kubeconfig
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"text/template"
 	"time"
 
 	"kubectm/pkg/credentials"
+	"kubectm/pkg/provider"
 	"kubectm/pkg/utils"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -22,7 +21,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/aws/aws-sdk-go-v2/service/eks"
-	"github.com/fatih/color"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
 )
 
 const (
@@ -30,31 +30,44 @@ const (
 	awsConcurrencyLimit = 5
 )
 
-// kubectmConfig represents the optional ~/.kubectm/config.json file.
-type kubectmConfig struct {
-	AWSRegions []string `json:"aws_regions"`
+// awsProvider lists EKS clusters across all enabled regions and generates
+// kubeconfigs that authenticate with `aws eks get-token`.
+type awsProvider struct{}
+
+func init() {
+	provider.Register(awsProvider{})
+}
+
+// Name returns the provider name used in credentials and selections.
+func (awsProvider) Name() string {
+	return "AWS"
+}
+
+// Discover looks for AWS credentials in the environment or ~/.aws/credentials.
+func (awsProvider) Discover(ctx context.Context) (*credentials.Credential, error) {
+	return credentials.Retrieve("AWS")
 }
 
-// downloadAWSKubeConfig downloads EKS cluster kubeconfigs for all enabled regions.
+// ListClusters lists EKS clusters in all enabled regions.
 // It uses EC2 DescribeRegions to auto-discover regions, with an optional override
 // via ~/.kubectm/config.json. Regions are scanned in parallel with bounded concurrency.
-func downloadAWSKubeConfig(cred credentials.Credential) error {
-	ctx, cancel := context.WithTimeout(context.Background(), awsDownloadTimeout)
+func (awsProvider) ListClusters(ctx context.Context, cred credentials.Credential) ([]provider.Cluster, error) {
+	ctx, cancel := context.WithTimeout(ctx, awsDownloadTimeout)
 	defer cancel()
 
 	cfg, err := newAWSConfig(ctx, cred)
 	if err != nil {
-		return fmt.Errorf("failed to create AWS config: %v", err)
+		return nil, fmt.Errorf("failed to create AWS config: %v", err)
 	}
 
 	regions, err := getAWSRegions(ctx, cfg)
 	if err != nil {
-		return fmt.Errorf("failed to get AWS regions: %v", err)
+		return nil, fmt.Errorf("failed to get AWS regions: %v", err)
 	}
 
 	if len(regions) == 0 {
 		utils.WarnLogger.Printf("%s No AWS regions found to scan for EKS clusters", utils.Iso8601Time())
-		return nil
+		return nil, nil
 	}
 
 	utils.InfoLogger.Printf("%s Scanning %d AWS regions for EKS clusters", utils.Iso8601Time(), len(regions))
@@ -62,6 +75,26 @@ func downloadAWSKubeConfig(cred credentials.Credential) error {
 	return scanRegionsForClusters(ctx, cfg, regions)
 }
 
+// Kubeconfig generates the kubeconfig for an EKS cluster from the endpoint and
+// CA certificate reported when it was listed. Only a cluster that could not
+// be described while listing is described again.
+func (awsProvider) Kubeconfig(ctx context.Context, cred credentials.Credential, cluster provider.Cluster) (*api.Config, error) {
+	if caData := cluster.Details["CAData"]; cluster.Endpoint != "" && caData != "" {
+		return eksKubeconfig(cluster.Name, cluster.Region, cluster.Endpoint, caData)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, awsDownloadTimeout)
+	defer cancel()
+
+	cfg, err := newAWSConfig(ctx, cred)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS config: %v", err)
+	}
+	cfg.Region = cluster.Region
+
+	return processEKSCluster(ctx, eks.NewFromConfig(cfg), cluster.Name, cluster.Region)
+}
+
 // newAWSConfig creates an AWS SDK config from the discovered credentials.
 func newAWSConfig(ctx context.Context, cred credentials.Credential) (aws.Config, error) {
 	accessKey := cred.Details["AccessKey"]
@@ -104,30 +137,10 @@ func getAWSRegions(ctx context.Context, cfg aws.Config) ([]string, error) {
 
 // loadRegionOverride reads the optional ~/.kubectm/config.json for an aws_regions override.
 func loadRegionOverride() ([]string, error) {
-	homeDir, err := os.UserHomeDir()
+	config, err := loadKubectmConfig()
 	if err != nil {
 		return nil, err
 	}
-	homeDir = filepath.Clean(homeDir)
-
-	configPath := filepath.Clean(filepath.Join(homeDir, ".kubectm", "config.json"))
-	if !strings.HasPrefix(configPath, homeDir+string(filepath.Separator)) {
-		return nil, fmt.Errorf("invalid config path outside user home")
-	}
-
-	data, err := os.ReadFile(configPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("error reading config file: %v", err)
-	}
-
-	var config kubectmConfig
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("error parsing config file: %v", err)
-	}
-
 	return config.AWSRegions, nil
 }
 
@@ -156,12 +169,13 @@ func discoverEnabledRegions(ctx context.Context, cfg aws.Config) ([]string, erro
 	return regions, nil
 }
 
-// scanRegionsForClusters scans all given regions for EKS clusters in parallel
+// scanRegionsForClusters lists EKS clusters in all given regions in parallel
 // with bounded concurrency. Per-region errors are logged and skipped.
-func scanRegionsForClusters(ctx context.Context, cfg aws.Config, regions []string) error {
+func scanRegionsForClusters(ctx context.Context, cfg aws.Config, regions []string) ([]provider.Cluster, error) {
 	sem := make(chan struct{}, awsConcurrencyLimit)
 	var mu sync.Mutex
 	var errs []string
+	var clusters []provider.Cluster
 
 	var wg sync.WaitGroup
 	for _, region := range regions {
@@ -171,53 +185,104 @@ func scanRegionsForClusters(ctx context.Context, cfg aws.Config, regions []strin
 			sem <- struct{}{}
 			defer func() { <-sem }()
 
-			if err := processRegion(ctx, cfg, region); err != nil {
-				mu.Lock()
+			found, err := processRegion(ctx, cfg, region)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
 				errs = append(errs, fmt.Sprintf("%s: %v", region, err))
-				mu.Unlock()
 				utils.WarnLogger.Printf("%s Failed to scan region %s: %v", utils.Iso8601Time(), region, err)
+				return
 			}
+			clusters = append(clusters, found...)
 		}(region)
 	}
 	wg.Wait()
 
 	if len(errs) == len(regions) {
-		return fmt.Errorf("all regions failed: %s", strings.Join(errs, "; "))
+		return nil, fmt.Errorf("all regions failed: %s", strings.Join(errs, "; "))
 	}
 
+	// Regions finish in any order; sort so downloads and merges are deterministic.
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].ID < clusters[j].ID })
+
 	if len(errs) > 0 {
 		utils.WarnLogger.Printf("%s %d/%d regions had errors", utils.Iso8601Time(), len(errs), len(regions))
+		sort.Strings(errs)
+		return clusters, &provider.PartialListError{Failures: errs}
 	}
 
-	return nil
+	return clusters, nil
 }
 
-// processRegion lists EKS clusters in a single region and downloads kubeconfigs for each.
-func processRegion(ctx context.Context, cfg aws.Config, region string) error {
+// processRegion lists the EKS clusters in a single region.
+func processRegion(ctx context.Context, cfg aws.Config, region string) ([]provider.Cluster, error) {
 	regionalCfg := cfg.Copy()
 	regionalCfg.Region = region
 
 	eksClient := eks.NewFromConfig(regionalCfg)
 
-	clusters, err := listEKSClusters(ctx, eksClient)
+	names, err := listEKSClusters(ctx, eksClient)
 	if err != nil {
-		return fmt.Errorf("failed to list clusters: %v", err)
+		return nil, fmt.Errorf("failed to list clusters: %v", err)
 	}
 
-	if len(clusters) == 0 {
-		return nil
+	if len(names) == 0 {
+		return nil, nil
 	}
 
-	utils.InfoLogger.Printf("%s Found %d EKS cluster(s) in %s", utils.Iso8601Time(), len(clusters), region)
-
-	for _, clusterName := range clusters {
-		if err := processEKSCluster(ctx, eksClient, clusterName, region); err != nil {
-			utils.WarnLogger.Printf("%s Failed to process cluster %s in %s: %v", utils.Iso8601Time(), clusterName, region, err)
-			continue
+	utils.InfoLogger.Printf("%s Found %d EKS cluster(s) in %s", utils.Iso8601Time(), len(names), region)
+
+	clusters := make([]provider.Cluster, 0, len(names))
+	for _, name := range names {
+		metadata := describeEKSMetadata(ctx, eksClient, name)
+		cluster := provider.Cluster{
+			ID:          fmt.Sprintf("%s/%s", region, name),
+			Name:        name,
+			Region:      region,
+			ContextName: fmt.Sprintf("%s@%s", name, region),
+			Version:     metadata.version,
+			Status:      metadata.status,
+			Endpoint:    metadata.endpoint,
+			Tags:        metadata.tags,
+		}
+		if metadata.caData != "" {
+			// Kept so Kubeconfig need not describe the cluster again.
+			cluster.Details = map[string]string{"CAData": metadata.caData}
 		}
+		clusters = append(clusters, cluster)
 	}
 
-	return nil
+	return clusters, nil
+}
+
+// eksMetadata is what DescribeCluster adds to an EKS cluster's name.
+type eksMetadata struct {
+	version, status, endpoint, caData string
+	tags                              map[string]string
+}
+
+// describeEKSMetadata returns the Kubernetes version, status, endpoint, CA
+// certificate and tags of an EKS cluster, which ListClusters does not report.
+// Failures are logged and leave them empty; Kubeconfig then describes the
+// cluster itself.
+func describeEKSMetadata(ctx context.Context, client *eks.Client, name string) eksMetadata {
+	output, err := client.DescribeCluster(ctx, &eks.DescribeClusterInput{
+		Name: aws.String(name),
+	})
+	if err != nil || output.Cluster == nil {
+		utils.WarnLogger.Printf("%s Failed to describe EKS cluster %s: %v", utils.Iso8601Time(), name, err)
+		return eksMetadata{}
+	}
+	metadata := eksMetadata{
+		version:  aws.ToString(output.Cluster.Version),
+		status:   string(output.Cluster.Status),
+		endpoint: aws.ToString(output.Cluster.Endpoint),
+		tags:     output.Cluster.Tags,
+	}
+	if ca := output.Cluster.CertificateAuthority; ca != nil {
+		metadata.caData = aws.ToString(ca.Data)
+	}
+	return metadata
 }
 
 // listEKSClusters lists all EKS cluster names in the region, handling pagination.
@@ -244,43 +309,48 @@ func listEKSClusters(ctx context.Context, client *eks.Client) ([]string, error)
 	return allClusters, nil
 }
 
-// processEKSCluster describes a single EKS cluster and generates + saves a kubeconfig for it.
-func processEKSCluster(ctx context.Context, client *eks.Client, clusterName, region string) error {
+// processEKSCluster describes a single EKS cluster and generates a kubeconfig for it.
+func processEKSCluster(ctx context.Context, client *eks.Client, clusterName, region string) (*api.Config, error) {
 	output, err := client.DescribeCluster(ctx, &eks.DescribeClusterInput{
 		Name: aws.String(clusterName),
 	})
 	if err != nil {
-		return fmt.Errorf("DescribeCluster failed: %v", err)
+		return nil, fmt.Errorf("DescribeCluster failed: %v", err)
 	}
 
 	cluster := output.Cluster
 	if cluster == nil || cluster.Endpoint == nil || cluster.CertificateAuthority == nil || cluster.CertificateAuthority.Data == nil {
-		return fmt.Errorf("cluster %s has incomplete data", clusterName)
+		return nil, fmt.Errorf("cluster %s has incomplete data", clusterName)
 	}
+	return eksKubeconfig(clusterName, region, *cluster.Endpoint, *cluster.CertificateAuthority.Data)
+}
 
+// eksKubeconfig generates a kubeconfig for an EKS cluster from its endpoint
+// and CA certificate.
+func eksKubeconfig(clusterName, region, endpoint, caData string) (*api.Config, error) {
 	// clusterName and region come from AWS API responses. Validate them against
 	// a strict allowlist before they are interpolated into the kubeconfig
 	// template (text/template performs no escaping) or used to build a file
 	// path, preventing YAML injection and path traversal.
 	if !isValidEKSIdentifier(clusterName) {
-		return fmt.Errorf("cluster %q has an unexpected name format", clusterName)
+		return nil, fmt.Errorf("cluster %q has an unexpected name format", clusterName)
 	}
 	if !isValidEKSIdentifier(region) {
-		return fmt.Errorf("cluster %s is in an unexpected region format %q", clusterName, region)
+		return nil, fmt.Errorf("cluster %s is in an unexpected region format %q", clusterName, region)
 	}
 
-	contextName := fmt.Sprintf("%s@%s", clusterName, region)
-	utils.ActionLogger.Printf("%s Downloading kubeconfig for EKS cluster: %s",
-		utils.Iso8601Time(), color.New(color.Bold).Sprint(contextName))
-
 	kubeconfigContent := generateEKSKubeconfig(
 		clusterName,
 		region,
-		*cluster.Endpoint,
-		*cluster.CertificateAuthority.Data,
+		endpoint,
+		caData,
 	)
 
-	return saveKubeconfigToFile(contextName, kubeconfigContent)
+	config, err := clientcmd.Load([]byte(kubeconfigContent))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse generated kubeconfig for cluster %s: %v", clusterName, err)
+	}
+	return config, nil
 }
 
 // eksIdentifierPattern matches the characters allowed in EKS cluster names and
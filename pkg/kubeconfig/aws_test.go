@@ -12,6 +12,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"k8s.io/client-go/tools/clientcmd"
 	"kubectm/pkg/credentials"
 )
 
@@ -197,7 +198,7 @@ func TestDownloadAWSKubeConfig_MissingCredentials(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := downloadAWSKubeConfig(tt.cred)
+			_, err := awsProvider{}.ListClusters(context.Background(), tt.cred)
 			if err == nil {
 				t.Error("expected error, got nil")
 				return
@@ -317,21 +318,19 @@ func TestProcessEKSCluster(t *testing.T) {
 			}),
 		})
 
-		err := processEKSCluster(context.Background(), client, "test-cluster", "us-east-1")
+		config, err := processEKSCluster(context.Background(), client, "test-cluster", "us-east-1")
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
 			return
 		}
 
-		expectedFile := filepath.Join(tempDir, ".kube", "test-cluster@us-east-1-kubeconfig.yaml")
-		if _, err := os.Stat(expectedFile); os.IsNotExist(err) {
-			t.Errorf("expected kubeconfig file at %s", expectedFile)
-			return
+		if config.CurrentContext != "test-cluster@us-east-1" {
+			t.Errorf("expected current context test-cluster@us-east-1, got %q", config.CurrentContext)
 		}
 
-		content, err := os.ReadFile(expectedFile)
+		content, err := clientcmd.Write(*config)
 		if err != nil {
-			t.Fatalf("failed to read kubeconfig: %v", err)
+			t.Fatalf("failed to serialize kubeconfig: %v", err)
 		}
 
 		checks := []string{
@@ -349,6 +348,51 @@ func TestProcessEKSCluster(t *testing.T) {
 	})
 }
 
+func TestAWSKubeconfigUsesListedCluster(t *testing.T) {
+	describeCalls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		if r.URL.Path == "/clusters" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"clusters": []string{"prod"}})
+			return
+		}
+		describeCalls++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"cluster": map[string]interface{}{
+				"name":                 "prod",
+				"endpoint":             "https://prod.eks.amazonaws.com",
+				"certificateAuthority": map[string]interface{}{"data": "dGVzdC1jYS1kYXRh"},
+				"status":               "ACTIVE",
+			},
+		})
+	}))
+	defer server.Close()
+
+	cfg := aws.Config{
+		Region: "us-east-1",
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "test", SecretAccessKey: "test"}, nil
+		}),
+		BaseEndpoint: aws.String(server.URL),
+	}
+	clusters, err := processRegion(context.Background(), cfg, "us-east-1")
+	if err != nil || len(clusters) != 1 {
+		t.Fatalf("processRegion() = %v, %v, want one cluster", clusters, err)
+	}
+
+	// The credential has no keys, so describing the cluster again would fail.
+	config, err := awsProvider{}.Kubeconfig(context.Background(), credentials.Credential{Provider: "AWS"}, clusters[0])
+	if err != nil {
+		t.Fatalf("Kubeconfig() error = %v", err)
+	}
+	if describeCalls != 1 {
+		t.Errorf("expected the cluster to be described once, got %d calls", describeCalls)
+	}
+	if cluster := config.Clusters["prod@us-east-1"]; cluster == nil || cluster.Server != "https://prod.eks.amazonaws.com" {
+		t.Errorf("expected the listed endpoint in the kubeconfig, got %v", config.Clusters)
+	}
+}
+
 func TestScanRegionsForClusters_AllFail(t *testing.T) {
 	// Create a server that always returns an error for EKS ListClusters
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -368,7 +412,7 @@ func TestScanRegionsForClusters_AllFail(t *testing.T) {
 	}
 
 	regions := []string{"us-east-1", "eu-west-1"}
-	err := scanRegionsForClusters(context.Background(), cfg, regions)
+	_, err := scanRegionsForClusters(context.Background(), cfg, regions)
 
 	if err == nil {
 		t.Error("expected error when all regions fail, got nil")
@@ -404,11 +448,14 @@ func TestScanRegionsForClusters_PartialSuccess(t *testing.T) {
 	}
 
 	regions := []string{"us-east-1", "eu-west-1", "ap-southeast-1"}
-	err := scanRegionsForClusters(context.Background(), cfg, regions)
+	clusters, err := scanRegionsForClusters(context.Background(), cfg, regions)
 
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
+	if len(clusters) != 0 {
+		t.Errorf("expected no clusters, got %d", len(clusters))
+	}
 }
 
 func TestNewAWSConfig(t *testing.T) {
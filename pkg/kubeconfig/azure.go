@@ -0,0 +1,515 @@
+package kubeconfig
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+
+	"kubectm/pkg/credentials"
+	"kubectm/pkg/provider"
+	"kubectm/pkg/utils"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	azureDownloadTimeout = 60 * time.Second
+	azureAKSAPIVersion   = "2024-05-01"
+	azureManagementScope = "https://management.azure.com/.default"
+
+	// aksAADServerID is the well-known application ID of the AKS AAD server
+	// that kubelogin requests tokens for on AAD-enabled clusters.
+	aksAADServerID = "6dae42f8-4368-4678-94ff-3960e28e3630"
+)
+
+// azureManagementBaseURL and azureLoginBaseURL are the Azure Resource Manager
+// and Microsoft Entra ID endpoints. They are variables so tests can point them
+// at an httptest server.
+// API Documentation: https://learn.microsoft.com/rest/api/aks/managed-clusters
+// Endpoints used:
+//   - GET  /subscriptions/{sub}/providers/Microsoft.ContainerService/managedClusters
+//   - POST {clusterId}/listClusterUserCredential
+var (
+	azureManagementBaseURL = "https://management.azure.com"
+	azureLoginBaseURL      = "https://login.microsoftonline.com"
+)
+
+// azureCLIAccessToken obtains an ARM access token from the Azure CLI. It is a
+// variable so tests can avoid shelling out to `az`.
+var azureCLIAccessToken = func(ctx context.Context, tenantID string) (string, error) {
+	args := []string{"account", "get-access-token", "--resource", "https://management.azure.com/", "--output", "json"}
+	if tenantID != "" {
+		args = append(args, "--tenant", tenantID)
+	}
+	output, err := exec.CommandContext(ctx, "az", args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("az account get-access-token failed: %v", err)
+	}
+
+	var token struct {
+		AccessToken string `json:"accessToken"`
+	}
+	if err := json.Unmarshal(output, &token); err != nil {
+		return "", fmt.Errorf("failed to parse az access token: %v", err)
+	}
+	return token.AccessToken, nil
+}
+
+// AKSCluster is the subset of the AKS managedClusters resource kubectm needs.
+type AKSCluster struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Location   string            `json:"location"`
+	Tags       map[string]string `json:"tags"`
+	Properties struct {
+		KubernetesVersion string `json:"kubernetesVersion"`
+		ProvisioningState string `json:"provisioningState"`
+		FQDN              string `json:"fqdn"`
+		PrivateFQDN       string `json:"privateFQDN"`
+		PowerState        *struct {
+			Code string `json:"code"`
+		} `json:"powerState"`
+		AADProfile *AKSAADProfile `json:"aadProfile"`
+	} `json:"properties"`
+}
+
+// status returns the cluster's power state, such as "Running" or "Stopped",
+// falling back to its provisioning state.
+func (c AKSCluster) status() string {
+	if c.Properties.PowerState != nil && c.Properties.PowerState.Code != "" {
+		return c.Properties.PowerState.Code
+	}
+	return c.Properties.ProvisioningState
+}
+
+// endpoint returns the URL of the cluster's API server, which is private
+// for a private cluster.
+func (c AKSCluster) endpoint() string {
+	fqdn := c.Properties.FQDN
+	if fqdn == "" {
+		fqdn = c.Properties.PrivateFQDN
+	}
+	if fqdn == "" {
+		return ""
+	}
+	return "https://" + fqdn + ":443"
+}
+
+// AKSAADProfile is present on clusters with Microsoft Entra ID integration.
+type AKSAADProfile struct {
+	Managed  bool   `json:"managed"`
+	TenantID string `json:"tenantID"`
+}
+
+// AKSClustersResponse is a page of the managedClusters list response.
+type AKSClustersResponse struct {
+	Value    []AKSCluster `json:"value"`
+	NextLink string       `json:"nextLink"`
+}
+
+// AKSCredentialsResponse is the response of listClusterUserCredential.
+type AKSCredentialsResponse struct {
+	Kubeconfigs []AKSCredentialResult `json:"kubeconfigs"`
+}
+
+// AKSCredentialResult is a single named, base64-encoded kubeconfig.
+type AKSCredentialResult struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// azureProvider enumerates AKS managed clusters in each subscription and
+// downloads their user kubeconfigs.
+type azureProvider struct {
+	tokens tokenCache
+}
+
+func init() {
+	provider.Register(&azureProvider{})
+}
+
+// Name returns the provider name used in credentials and selections.
+func (p *azureProvider) Name() string {
+	return "Azure"
+}
+
+// Discover looks for service principal environment variables or an Azure
+// CLI profile.
+func (p *azureProvider) Discover(ctx context.Context) (*credentials.Credential, error) {
+	return credentials.Retrieve("Azure")
+}
+
+// ListClusters enumerates the AKS clusters in every subscription of the
+// credential. Failing subscriptions are logged and skipped unless all fail.
+func (p *azureProvider) ListClusters(ctx context.Context, cred credentials.Credential) ([]provider.Cluster, error) {
+	ctx, cancel := context.WithTimeout(ctx, azureDownloadTimeout)
+	defer cancel()
+
+	token, err := p.token(ctx, cred)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions, err := getAzureSubscriptions(ctx, token, cred)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine Azure subscriptions: %v", err)
+	}
+
+	var errs []string
+	var result []provider.Cluster
+	for _, subscriptionID := range subscriptions {
+		clusters, err := listAKSClusters(ctx, token, subscriptionID)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", subscriptionID, err))
+			utils.WarnLogger.Printf("%s Failed to list AKS clusters in subscription %s: %v", utils.Iso8601Time(), subscriptionID, err)
+			continue
+		}
+
+		utils.InfoLogger.Printf("%s Found %d AKS cluster(s) in subscription %s", utils.Iso8601Time(), len(clusters), subscriptionID)
+
+		for _, cluster := range clusters {
+			resourceGroup := azureResourceGroup(cluster.ID)
+			details := map[string]string{"Account": subscriptionID}
+			if cluster.Properties.AADProfile != nil {
+				details["AAD"] = "true"
+			}
+			result = append(result, provider.Cluster{
+				ID:          cluster.ID,
+				Name:        cluster.Name,
+				Region:      cluster.Location,
+				ContextName: fmt.Sprintf("%s@%s", cluster.Name, resourceGroup),
+				Version:     cluster.Properties.KubernetesVersion,
+				Status:      cluster.status(),
+				Endpoint:    cluster.endpoint(),
+				Tags:        cluster.Tags,
+				Details:     details,
+			})
+		}
+	}
+
+	if len(subscriptions) > 0 && len(errs) == len(subscriptions) {
+		return nil, fmt.Errorf("all subscriptions failed: %s", strings.Join(errs, "; "))
+	}
+	if len(errs) > 0 {
+		return result, &provider.PartialListError{Failures: errs}
+	}
+
+	return result, nil
+}
+
+// Kubeconfig downloads the user kubeconfig of a single AKS cluster.
+func (p *azureProvider) Kubeconfig(ctx context.Context, cred credentials.Credential, cluster provider.Cluster) (*api.Config, error) {
+	ctx, cancel := context.WithTimeout(ctx, azureDownloadTimeout)
+	defer cancel()
+
+	token, err := p.token(ctx, cred)
+	if err != nil {
+		return nil, err
+	}
+
+	aks := AKSCluster{ID: cluster.ID, Name: cluster.Name}
+	if cluster.Details["AAD"] == "true" {
+		aks.Properties.AADProfile = &AKSAADProfile{}
+	}
+	return processAKSCluster(ctx, token, cred, aks)
+}
+
+// token returns a cached ARM access token for the credential.
+func (p *azureProvider) token(ctx context.Context, cred credentials.Credential) (string, error) {
+	token, err := p.tokens.get(cred, func() (string, error) { return getAzureAccessToken(ctx, cred) })
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain Azure access token: %v", err)
+	}
+	return token, nil
+}
+
+// getAzureAccessToken returns an Azure Resource Manager access token, using
+// the client credentials grant for service principals and the Azure CLI for
+// interactive logins.
+func getAzureAccessToken(ctx context.Context, cred credentials.Credential) (string, error) {
+	tenantID := cred.Details["TenantID"]
+
+	switch cred.Details["AuthMethod"] {
+	case "ClientSecret":
+		if tenantID == "" || cred.Details["ClientID"] == "" || cred.Details["ClientSecret"] == "" {
+			return "", fmt.Errorf("Azure client ID, client secret or tenant ID is missing")
+		}
+	case "AzureCLI":
+		return azureCLIAccessToken(ctx, tenantID)
+	default:
+		return "", fmt.Errorf("unsupported Azure auth method %q", cred.Details["AuthMethod"])
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", cred.Details["ClientID"])
+	form.Set("client_secret", cred.Details["ClientSecret"])
+	form.Set("scope", azureManagementScope)
+
+	tokenURL := fmt.Sprintf("%s/%s/oauth2/v2.0/token", azureLoginBaseURL, url.PathEscape(tenantID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("token request failed, status: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var tokenResponse struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return "", err
+	}
+	if tokenResponse.AccessToken == "" {
+		return "", fmt.Errorf("token response did not contain an access token")
+	}
+
+	return tokenResponse.AccessToken, nil
+}
+
+// getAzureSubscriptions returns the subscriptions recorded on the credential,
+// or every subscription the token can see when none were configured.
+func getAzureSubscriptions(ctx context.Context, token string, cred credentials.Credential) ([]string, error) {
+	if configured := cred.Details["SubscriptionIDs"]; configured != "" {
+		return strings.Split(configured, ","), nil
+	}
+
+	var page struct {
+		Value []struct {
+			SubscriptionID string `json:"subscriptionId"`
+			State          string `json:"state"`
+		} `json:"value"`
+	}
+	if err := azureGet(ctx, token, azureManagementBaseURL+"/subscriptions?api-version=2022-12-01", &page); err != nil {
+		return nil, err
+	}
+
+	var subscriptions []string
+	for _, sub := range page.Value {
+		if sub.State == "Enabled" {
+			subscriptions = append(subscriptions, sub.SubscriptionID)
+		}
+	}
+	return subscriptions, nil
+}
+
+// listAKSClusters lists all managed clusters in the subscription, following
+// nextLink pagination.
+func listAKSClusters(ctx context.Context, token, subscriptionID string) ([]AKSCluster, error) {
+	nextURL := fmt.Sprintf("%s/subscriptions/%s/providers/Microsoft.ContainerService/managedClusters?api-version=%s",
+		azureManagementBaseURL, url.PathEscape(subscriptionID), azureAKSAPIVersion)
+
+	var clusters []AKSCluster
+	for nextURL != "" {
+		var page AKSClustersResponse
+		if err := azureGet(ctx, token, nextURL, &page); err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, page.Value...)
+
+		// nextLink comes from the API response; only follow it if it stays on
+		// the management endpoint so the bearer token is never sent elsewhere.
+		if page.NextLink != "" && !strings.HasPrefix(page.NextLink, azureManagementBaseURL+"/") {
+			return nil, fmt.Errorf("refusing to follow nextLink outside %s", azureManagementBaseURL)
+		}
+		nextURL = page.NextLink
+	}
+
+	return clusters, nil
+}
+
+// azureGet performs an authenticated GET against Azure Resource Manager and
+// decodes the JSON response into out.
+func azureGet(ctx context.Context, token, reqURL string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("request failed, status: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// getAKSUserCredentials fetches the clusterUser kubeconfig for an AKS cluster.
+func getAKSUserCredentials(ctx context.Context, token, clusterID string) ([]byte, error) {
+	reqURL := fmt.Sprintf("%s%s/listClusterUserCredential?api-version=%s", azureManagementBaseURL, clusterID, azureAKSAPIVersion)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to retrieve cluster credentials, status: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var credentialsResponse AKSCredentialsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&credentialsResponse); err != nil {
+		return nil, err
+	}
+	if len(credentialsResponse.Kubeconfigs) == 0 {
+		return nil, fmt.Errorf("no kubeconfig returned for cluster")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(credentialsResponse.Kubeconfigs[0].Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode kubeconfig: %v", err)
+	}
+	return decoded, nil
+}
+
+// processAKSCluster downloads the user kubeconfig for an AKS cluster, renames
+// its entries to {cluster}@{resource-group} and switches AAD-enabled clusters
+// to kubelogin exec authentication.
+func processAKSCluster(ctx context.Context, token string, cred credentials.Credential, cluster AKSCluster) (*api.Config, error) {
+	resourceGroup := azureResourceGroup(cluster.ID)
+	if cluster.Name == "" || resourceGroup == "" || !strings.HasPrefix(strings.ToLower(cluster.ID), "/subscriptions/") {
+		return nil, fmt.Errorf("cluster %q has an unexpected resource ID %q", cluster.Name, cluster.ID)
+	}
+
+	contextName := fmt.Sprintf("%s@%s", cluster.Name, resourceGroup)
+
+	raw, err := getAKSUserCredentials(ctx, token, cluster.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := clientcmd.Load(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig: %v", err)
+	}
+
+	config, err = normalizeAKSKubeconfig(config, contextName)
+	if err != nil {
+		return nil, err
+	}
+
+	if cluster.Properties.AADProfile != nil {
+		convertToKubelogin(config, cred)
+	}
+
+	return config, nil
+}
+
+// azureResourceGroup extracts the resource group from an ARM resource ID of
+// the form /subscriptions/{sub}/resourceGroups/{rg}/providers/...
+func azureResourceGroup(resourceID string) string {
+	parts := strings.Split(strings.Trim(resourceID, "/"), "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if strings.EqualFold(parts[i], "resourceGroups") {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
+// normalizeAKSKubeconfig rewrites the single cluster, user and context of an
+// AKS kubeconfig so all three are named contextName.
+func normalizeAKSKubeconfig(config *api.Config, contextName string) (*api.Config, error) {
+	srcContext, ok := config.Contexts[config.CurrentContext]
+	if !ok || srcContext == nil {
+		for _, c := range config.Contexts {
+			srcContext = c
+			break
+		}
+	}
+	if srcContext == nil {
+		return nil, fmt.Errorf("kubeconfig has no contexts")
+	}
+
+	cluster, ok := config.Clusters[srcContext.Cluster]
+	if !ok {
+		return nil, fmt.Errorf("kubeconfig context refers to missing cluster %q", srcContext.Cluster)
+	}
+	authInfo, ok := config.AuthInfos[srcContext.AuthInfo]
+	if !ok {
+		return nil, fmt.Errorf("kubeconfig context refers to missing user %q", srcContext.AuthInfo)
+	}
+
+	normalized := api.NewConfig()
+	normalized.Clusters[contextName] = cluster
+	normalized.AuthInfos[contextName] = authInfo
+	normalized.Contexts[contextName] = &api.Context{
+		Cluster:   contextName,
+		AuthInfo:  contextName,
+		Namespace: srcContext.Namespace,
+	}
+	normalized.CurrentContext = contextName
+	return normalized, nil
+}
+
+// convertToKubelogin replaces the users of an AAD-enabled cluster's kubeconfig
+// with a kubelogin exec plugin, matching `kubelogin convert-kubeconfig`. CLI
+// logins reuse the az session; service principals read AZURE_CLIENT_ID and
+// AZURE_CLIENT_SECRET from the environment at token time.
+func convertToKubelogin(config *api.Config, cred credentials.Credential) {
+	login := "azurecli"
+	if cred.Details["AuthMethod"] == "ClientSecret" {
+		login = "spn"
+	}
+
+	for name, authInfo := range config.AuthInfos {
+		serverID := aksAADServerID
+		if authInfo.AuthProvider != nil && authInfo.AuthProvider.Config["apiserver-id"] != "" {
+			serverID = authInfo.AuthProvider.Config["apiserver-id"]
+		}
+
+		args := []string{
+			"get-token",
+			"--environment", "AzurePublicCloud",
+			"--server-id", serverID,
+			"--login", login,
+		}
+		if tenantID := cred.Details["TenantID"]; tenantID != "" {
+			args = append(args, "--tenant-id", tenantID)
+		}
+
+		config.AuthInfos[name] = &api.AuthInfo{
+			Exec: &api.ExecConfig{
+				APIVersion:      "client.authentication.k8s.io/v1beta1",
+				Command:         "kubelogin",
+				Args:            args,
+				InstallHint:     "Install kubelogin for use with kubectl by following https://azure.github.io/kubelogin/install.html",
+				InteractiveMode: api.IfAvailableExecInteractiveMode,
+			},
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package kubeconfig
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kubectm/pkg/credentials"
+)
+
+const (
+	testAzureToken    = "azure-access-token"
+	testAKSClusterID  = "/subscriptions/sub-1/resourceGroups/rg-production/providers/Microsoft.ContainerService/managedClusters/aks-prod"
+	testAKSKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    certificate-authority-data: dGVzdC1jYS1kYXRh
+    server: https://aks-prod-dns.hcp.westeurope.azmk8s.io:443
+  name: aks-prod
+contexts:
+- context:
+    cluster: aks-prod
+    user: clusterUser_rg-production_aks-prod
+  name: aks-prod
+current-context: aks-prod
+users:
+- name: clusterUser_rg-production_aks-prod
+  user:
+    token: static-token
+`
+)
+
+// newAKSTestServer serves the Entra ID token endpoint and the ARM endpoints
+// used to enumerate managed clusters and fetch their user credentials. The
+// cluster list is split across two pages to exercise nextLink handling.
+func newAKSTestServer(t *testing.T, clusters []AKSCluster) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/oauth2/v2.0/token") {
+			json.NewEncoder(w).Encode(map[string]string{"access_token": testAzureToken})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+testAzureToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/managedClusters") && r.URL.Query().Get("page") == "":
+			json.NewEncoder(w).Encode(AKSClustersResponse{
+				Value:    clusters[:1],
+				NextLink: server.URL + r.URL.Path + "?api-version=" + azureAKSAPIVersion + "&page=2",
+			})
+		case strings.HasSuffix(r.URL.Path, "/managedClusters"):
+			json.NewEncoder(w).Encode(AKSClustersResponse{Value: clusters[1:]})
+		case strings.HasSuffix(r.URL.Path, "/listClusterUserCredential"):
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			json.NewEncoder(w).Encode(AKSCredentialsResponse{
+				Kubeconfigs: []AKSCredentialResult{
+					{Name: "clusterUser", Value: base64.StdEncoding.EncodeToString([]byte(testAKSKubeconfig))},
+				},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	origManagement, origLogin := azureManagementBaseURL, azureLoginBaseURL
+	azureManagementBaseURL, azureLoginBaseURL = server.URL, server.URL
+	t.Cleanup(func() { azureManagementBaseURL, azureLoginBaseURL = origManagement, origLogin })
+
+	return server
+}
+
+func testAKSCluster(name, resourceGroup string, aad bool) AKSCluster {
+	cluster := AKSCluster{
+		ID:       "/subscriptions/sub-1/resourceGroups/" + resourceGroup + "/providers/Microsoft.ContainerService/managedClusters/" + name,
+		Name:     name,
+		Location: "westeurope",
+	}
+	if aad {
+		cluster.Properties.AADProfile = &AKSAADProfile{Managed: true, TenantID: "tenant-a"}
+	}
+	return cluster
+}
+
+func testAzureServicePrincipal() credentials.Credential {
+	return credentials.Credential{
+		Provider: "Azure",
+		Details: map[string]string{
+			"AuthMethod":      "ClientSecret",
+			"ClientID":        "client-id",
+			"ClientSecret":    "client-secret",
+			"TenantID":        "tenant-a",
+			"SubscriptionIDs": "sub-1",
+		},
+	}
+}
+
+func TestGetAzureAccessToken(t *testing.T) {
+	newAKSTestServer(t, nil)
+
+	token, err := getAzureAccessToken(context.Background(), testAzureServicePrincipal())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token != testAzureToken {
+		t.Errorf("expected token %q, got %q", testAzureToken, token)
+	}
+
+	origCLI := azureCLIAccessToken
+	t.Cleanup(func() { azureCLIAccessToken = origCLI })
+	azureCLIAccessToken = func(ctx context.Context, tenantID string) (string, error) {
+		if tenantID != "tenant-a" {
+			t.Errorf("expected tenant-a, got %q", tenantID)
+		}
+		return "cli-token", nil
+	}
+
+	token, err = getAzureAccessToken(context.Background(), credentials.Credential{
+		Provider: "Azure",
+		Details:  map[string]string{"AuthMethod": "AzureCLI", "TenantID": "tenant-a"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token != "cli-token" {
+		t.Errorf("expected CLI token, got %q", token)
+	}
+
+	if _, err := getAzureAccessToken(context.Background(), credentials.Credential{Details: map[string]string{"AuthMethod": "ClientSecret"}}); err == nil {
+		t.Error("expected error for incomplete service principal, got nil")
+	}
+}
+
+func TestListAKSClustersFollowsNextLink(t *testing.T) {
+	newAKSTestServer(t, []AKSCluster{
+		testAKSCluster("aks-prod", "rg-production", false),
+		testAKSCluster("aks-dev", "rg-dev", true),
+	})
+
+	clusters, err := listAKSClusters(context.Background(), testAzureToken, "sub-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(clusters) != 2 {
+		t.Fatalf("expected 2 clusters across pages, got %d", len(clusters))
+	}
+}
+
+func TestListAKSClustersRejectsForeignNextLink(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(AKSClustersResponse{NextLink: "https://attacker.example.com/steal"})
+	}))
+	defer server.Close()
+
+	origManagement := azureManagementBaseURL
+	azureManagementBaseURL = server.URL
+	defer func() { azureManagementBaseURL = origManagement }()
+
+	if _, err := listAKSClusters(context.Background(), testAzureToken, "sub-1"); err == nil {
+		t.Fatal("expected error for nextLink outside the management endpoint, got nil")
+	}
+}
+
+func TestAzureResourceGroup(t *testing.T) {
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{id: testAKSClusterID, want: "rg-production"},
+		{id: "/subscriptions/sub/resourcegroups/MixedCase/providers/x/y/z", want: "MixedCase"},
+		{id: "/subscriptions/sub", want: ""},
+		{id: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := azureResourceGroup(tt.id); got != tt.want {
+			t.Errorf("azureResourceGroup(%q) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestDownloadAzureKubeConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	newAKSTestServer(t, []AKSCluster{
+		testAKSCluster("aks-prod", "rg-production", false),
+		testAKSCluster("aks-dev", "rg-dev", true),
+	})
+
+	result := DownloadAll(context.Background(), []credentials.Credential{testAzureServicePrincipal()})
+	if len(result.Failed) != 0 {
+		t.Fatalf("unexpected failures: %v", result.Failed)
+	}
+	configs := make(map[string]*DownloadedConfig, len(result.Configs))
+	for i := range result.Configs {
+		if result.Configs[i].Provider != "Azure" {
+			t.Errorf("expected provider Azure, got %q", result.Configs[i].Provider)
+		}
+		configs[result.Configs[i].Cluster.ContextName] = &result.Configs[i]
+	}
+	if _, err := os.Stat(filepath.Join(home, ".kube")); !os.IsNotExist(err) {
+		t.Error("expected downloads to stay in memory")
+	}
+
+	// A local-accounts cluster keeps its static token, renamed to {cluster}@{rg}.
+	prodDownload := configs["aks-prod@rg-production"]
+	if prodDownload == nil {
+		t.Fatal("expected a kubeconfig for aks-prod@rg-production")
+	}
+	if got := prodDownload.Cluster.Region; got != "westeurope" {
+		t.Errorf("expected region westeurope, got %q", got)
+	}
+	prod := prodDownload.Config
+	if prod.CurrentContext != "aks-prod@rg-production" {
+		t.Errorf("expected context aks-prod@rg-production, got %q", prod.CurrentContext)
+	}
+	if user := prod.AuthInfos["aks-prod@rg-production"]; user == nil || user.Token != "static-token" {
+		t.Errorf("expected static token user to be preserved, got %+v", user)
+	}
+
+	// An AAD-enabled cluster is converted to kubelogin exec auth.
+	devDownload := configs["aks-dev@rg-dev"]
+	if devDownload == nil {
+		t.Fatal("expected a kubeconfig for aks-dev@rg-dev")
+	}
+	dev := devDownload.Config
+	user := dev.AuthInfos["aks-dev@rg-dev"]
+	if user == nil || user.Exec == nil {
+		t.Fatalf("expected kubelogin exec user, got %+v", user)
+	}
+	if user.Exec.Command != "kubelogin" {
+		t.Errorf("expected kubelogin command, got %q", user.Exec.Command)
+	}
+	args := strings.Join(user.Exec.Args, " ")
+	for _, want := range []string{"get-token", "--login spn", "--server-id " + aksAADServerID, "--tenant-id tenant-a"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("expected exec args to contain %q, got %q", want, args)
+		}
+	}
+	if user.Token != "" {
+		t.Error("expected static token to be removed from kubelogin user")
+	}
+}
+
+func TestProcessAKSClusterRejectsUnexpectedID(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	cluster := testAKSCluster("aks-prod", "rg-production", false)
+	cluster.ID = "https://attacker.example.com/resourceGroups/rg/x"
+
+	if _, err := processAKSCluster(context.Background(), testAzureToken, testAzureServicePrincipal(), cluster); err == nil {
+		t.Fatal("expected error for unexpected resource ID, got nil")
+	}
+	if _, err := os.Stat(filepath.Join(os.Getenv("HOME"), ".kube")); !os.IsNotExist(err) {
+		t.Error("expected no kubeconfig to be written")
+	}
+}
@@ -1,46 +1,94 @@
 package kubeconfig
 
 import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
     "fmt"
     "os"
     "path/filepath"
     "sort"
+    "strconv"
     "strings"
     "time"
     "kubectm/pkg/utils"
+
+    "k8s.io/client-go/tools/clientcmd"
+    "k8s.io/client-go/tools/clientcmd/api"
 )
 
 // DefaultBackupCount is the default number of kubeconfig backups to keep.
 const DefaultBackupCount = 5
 
-// backupPrefix is the filename prefix used for kubeconfig backups in ~/.kube/.
-const backupPrefix = "config.bak."
+// backupInfix joins a kubeconfig's filename and the timestamp in the names
+// of its backups, which are kept next to it: config.bak.{timestamp}.
+const backupInfix = ".bak."
 
 // backupTimestampFormat is the compact ISO 8601 layout used in backup
 // filenames (no colons, so the name is valid on Windows too).
 const backupTimestampFormat = "20060102T150405Z"
 
-// BackupConfig copies ~/.kube/config to ~/.kube/config.bak.{timestamp} so the
-// user can recover the previous state if a merge goes wrong. After creating
-// the backup it prunes older backups, keeping only the most recent `keep`
-// files (values below 1 are treated as 1).
+// backupSeqSeparator joins the timestamp and a counter in the name of a
+// backup taken in the same second as an earlier one: config.bak.{timestamp}-1.
+const backupSeqSeparator = "-"
+
+// backupMetadataSuffix is appended to a backup's filename, with a leading
+// dot, to name its metadata sidecar: .config.bak.{timestamp}.json. The
+// leading dot keeps sidecars out of config.bak.* globs.
+const backupMetadataSuffix = ".json"
+
+// CurrentBackupID names the live kubeconfig in DiffBackups.
+const CurrentBackupID = "current"
+
+// LatestBackupID names the most recent backup.
+const LatestBackupID = "latest"
+
+// BackupMetadata is stored in a sidecar next to each backup.
+type BackupMetadata struct {
+    // Version is the kubectm version that took the backup.
+    Version string `json:"version"`
+    // Providers are the providers of the sync the backup was taken before.
+    Providers []string `json:"providers,omitempty"`
+    // Contexts is the number of contexts in the backed up kubeconfig.
+    Contexts int `json:"contexts"`
+    // SHA256 is the hex digest of the backup's content.
+    SHA256 string `json:"sha256"`
+}
+
+// Backup is a backup of the target kubeconfig, kept in the same directory.
+type Backup struct {
+    // ID is the backup's timestamp, as used on the command line, with a
+    // counter if an earlier backup was taken in the same second.
+    ID   string
+    Path string
+    Time time.Time
+    // seq is the counter in ID, or 0.
+    seq  int
+    // Metadata is nil for backups taken before sidecars were written.
+    Metadata *BackupMetadata
+}
+
+// BackupConfig copies the target kubeconfig, ~/.kube/config by default, to
+// config.bak.{timestamp} in the same directory so the user can recover the previous state if a merge goes wrong, and records the
+// kubectm version, the given providers and the context count in a metadata
+// sidecar. A backup never replaces another: if one was already taken in the
+// same second, a counter is appended to the timestamp. After creating the
+// backup it prunes older backups, keeping only the most recent `keep` files
+// (values below 1 are treated as 1).
 //
-// It returns the path of the created backup, or an empty string if there was
-// no existing kubeconfig to back up.
-func BackupConfig(keep int) (string, error) {
-    homeDir, kubeDir, err := getKubeDir()
+// If the kubeconfig is identical to the latest backup, no new backup is taken
+// and the latest one's path is returned, so repeated syncs that change
+// nothing do not rotate useful backups out. Only the latest backup is
+// compared: a kubeconfig that matches an older one is backed up again.
+//
+// It returns the path of the backup, or an empty string if there was no
+// existing kubeconfig to back up.
+func BackupConfig(keep int, providers ...string) (string, error) {
+    configPath, err := targetKubeconfig()
     if err != nil {
         return "", err
     }
-
-    if rel, relErr := filepath.Rel(homeDir, kubeDir); relErr != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
-        return "", fmt.Errorf("invalid kubeconfig directory outside user home: %s", kubeDir)
-    }
-
-    configPath := filepath.Clean(filepath.Join(kubeDir, "config"))
-    if !strings.HasPrefix(configPath, kubeDir) {
-        return "", fmt.Errorf("invalid main kubeconfig path outside .kube directory: %s", configPath)
-    }
+    kubeDir, prefix := filepath.Dir(configPath), backupPrefix(configPath)
 
     data, err := os.ReadFile(configPath)
     if err != nil {
@@ -50,67 +98,329 @@ func BackupConfig(keep int) (string, error) {
         }
         return "", fmt.Errorf("failed to read kubeconfig for backup: %v", err)
     }
+    sum := contentHash(data)
 
-    timestamp := time.Now().UTC().Format(backupTimestampFormat)
-    backupPath := filepath.Clean(filepath.Join(kubeDir, backupPrefix+timestamp))
-    if !strings.HasPrefix(backupPath, kubeDir) {
-        return "", fmt.Errorf("invalid backup path outside .kube directory: %s", backupPath)
+    backups, err := timestampedBackups(kubeDir, prefix)
+    if err != nil {
+        return "", err
+    }
+    if len(backups) > 0 {
+        latest := backups[0]
+        if latestData, err := os.ReadFile(latest.Path); err == nil && contentHash(latestData) == sum {
+            utils.InfoLogger.Printf("%s Kubeconfig unchanged since backup %s, skipping backup", utils.Iso8601Time(), latest.ID)
+            return latest.Path, nil
+        }
     }
 
-    if err := os.WriteFile(backupPath, data, 0600); err != nil {
-        return "", fmt.Errorf("failed to write kubeconfig backup: %v", err)
+    backupPath, err := writeNewBackup(kubeDir, prefix+time.Now().UTC().Format(backupTimestampFormat), data)
+    if err != nil {
+        return "", err
     }
     utils.InfoLogger.Printf("%s Backed up kubeconfig to %s", utils.Iso8601Time(), backupPath)
 
-    if err := pruneBackups(kubeDir, keep); err != nil {
+    metadata := BackupMetadata{Version: Version, Providers: providers, SHA256: sum}
+    if config, err := clientcmd.Load(data); err == nil {
+        metadata.Contexts = len(config.Contexts)
+    }
+    if err := writeBackupMetadata(backupPath, metadata); err != nil {
+        utils.WarnLogger.Printf("%s Warning: failed to write backup metadata: %v", utils.Iso8601Time(), err)
+    }
+
+    if err := pruneBackups(kubeDir, prefix, keep); err != nil {
         utils.WarnLogger.Printf("%s Warning: failed to prune old kubeconfig backups: %v", utils.Iso8601Time(), err)
     }
 
     return backupPath, nil
 }
 
-// pruneBackups removes the oldest config.bak.* files in kubeDir, keeping the
-// most recent `keep` backups. Backup filenames embed a compact ISO 8601 UTC
-// timestamp, so lexical order matches chronological order.
-func pruneBackups(kubeDir string, keep int) error {
-    if keep < 1 {
-        keep = 1
+// writeNewBackup writes data to a backup named name in kubeDir, creating the
+// file exclusively so an existing backup is never overwritten. If the name
+// is taken, a counter is appended to it.
+func writeNewBackup(kubeDir, name string, data []byte) (string, error) {
+    for seq := 0; ; seq++ {
+        candidate := name
+        if seq > 0 {
+            candidate += backupSeqSeparator + strconv.Itoa(seq)
+        }
+        backupPath := filepath.Clean(filepath.Join(kubeDir, candidate))
+        if !isWithinDir(kubeDir, backupPath) {
+            return "", fmt.Errorf("invalid backup path outside kubeconfig directory: %s", backupPath)
+        }
+
+        f, err := os.OpenFile(backupPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+        if os.IsExist(err) {
+            continue
+        }
+        if err != nil {
+            return "", fmt.Errorf("failed to write kubeconfig backup: %v", err)
+        }
+        _, err = f.Write(data)
+        if cerr := f.Close(); err == nil {
+            err = cerr
+        }
+        if err != nil {
+            os.Remove(backupPath)
+            return "", fmt.Errorf("failed to write kubeconfig backup: %v", err)
+        }
+        return backupPath, nil
     }
+}
+
+// parseBackupID returns the time and counter of a backup ID, and whether id
+// is one kubectm generated.
+func parseBackupID(id string) (time.Time, int, bool) {
+    timestampPart, seqPart, hasSeq := strings.Cut(id, backupSeqSeparator)
+    timestamp, err := time.Parse(backupTimestampFormat, timestampPart)
+    if err != nil {
+        return time.Time{}, 0, false
+    }
+    if !hasSeq {
+        return timestamp, 0, true
+    }
+    seq, err := strconv.Atoi(seqPart)
+    if err != nil || seq < 1 || strconv.Itoa(seq) != seqPart {
+        return time.Time{}, 0, false
+    }
+    return timestamp, seq, true
+}
+
+// backupPrefix returns the filename prefix of the backups of the kubeconfig
+// at configPath, such as config.bak. for ~/.kube/config.
+func backupPrefix(configPath string) string {
+    return filepath.Base(configPath) + backupInfix
+}
+
+// contentHash returns the hex SHA-256 digest of data.
+func contentHash(data []byte) string {
+    sum := sha256.Sum256(data)
+    return hex.EncodeToString(sum[:])
+}
+
+// backupMetadataPath returns the sidecar path for a backup.
+func backupMetadataPath(backupPath string) string {
+    return filepath.Join(filepath.Dir(backupPath), "."+filepath.Base(backupPath)+backupMetadataSuffix)
+}
+
+// writeBackupMetadata writes the metadata sidecar for a backup.
+func writeBackupMetadata(backupPath string, metadata BackupMetadata) error {
+    data, err := json.MarshalIndent(metadata, "", "  ")
+    if err != nil {
+        return err
+    }
+    return os.WriteFile(backupMetadataPath(backupPath), data, 0600)
+}
 
+// readBackupMetadata reads the metadata sidecar for a backup, returning nil
+// if there is none or it cannot be parsed.
+func readBackupMetadata(backupPath string) *BackupMetadata {
+    data, err := os.ReadFile(backupMetadataPath(backupPath))
+    if err != nil {
+        return nil
+    }
+    var metadata BackupMetadata
+    if err := json.Unmarshal(data, &metadata); err != nil {
+        return nil
+    }
+    return &metadata
+}
+
+// timestampedBackups returns the timestamped backups with the given prefix in
+// kubeDir, newest first. Manually created files such as
+// config.bak.before-upgrade are not listed.
+func timestampedBackups(kubeDir, prefix string) ([]Backup, error) {
     entries, err := os.ReadDir(kubeDir)
     if err != nil {
-        return fmt.Errorf("failed to read kubeconfig directory: %v", err)
+        if os.IsNotExist(err) {
+            return nil, nil
+        }
+        return nil, fmt.Errorf("failed to read kubeconfig directory: %v", err)
     }
 
-    var backups []string
+    var backups []Backup
     for _, entry := range entries {
-        if entry.IsDir() || !strings.HasPrefix(entry.Name(), backupPrefix) {
+        if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
             continue
         }
-        // Only prune files whose suffix is a timestamp we generated, so
-        // manually created backups like config.bak.before-upgrade survive.
-        timestampPart := strings.TrimPrefix(entry.Name(), backupPrefix)
-        if _, err := time.Parse(backupTimestampFormat, timestampPart); err != nil {
+        id := strings.TrimPrefix(entry.Name(), prefix)
+        timestamp, seq, ok := parseBackupID(id)
+        if !ok {
             continue
         }
-        backups = append(backups, entry.Name())
+        path := filepath.Join(kubeDir, entry.Name())
+        backups = append(backups, Backup{ID: id, Path: path, Time: timestamp, seq: seq, Metadata: readBackupMetadata(path)})
+    }
+    sort.Slice(backups, func(i, j int) bool {
+        if !backups[i].Time.Equal(backups[j].Time) {
+            return backups[i].Time.After(backups[j].Time)
+        }
+        return backups[i].seq > backups[j].seq
+    })
+    return backups, nil
+}
+
+// ListBackups returns the backups of the target kubeconfig, newest first.
+func ListBackups() ([]Backup, error) {
+    configPath, err := targetKubeconfig()
+    if err != nil {
+        return nil, err
+    }
+    return timestampedBackups(filepath.Dir(configPath), backupPrefix(configPath))
+}
+
+// FindBackup returns the backup with the given ID. The ID may also be given
+// as the backup's filename, or as "latest".
+func FindBackup(id string) (Backup, error) {
+    configPath, err := targetKubeconfig()
+    if err != nil {
+        return Backup{}, err
+    }
+    backups, err := timestampedBackups(filepath.Dir(configPath), backupPrefix(configPath))
+    if err != nil {
+        return Backup{}, err
+    }
+    if id == LatestBackupID && len(backups) > 0 {
+        return backups[0], nil
+    }
+    id = strings.TrimPrefix(id, backupPrefix(configPath))
+    for _, backup := range backups {
+        if backup.ID == id {
+            return backup, nil
+        }
+    }
+    return Backup{}, fmt.Errorf("no kubeconfig backup %q; run kubectm backups list", id)
+}
+
+// loadBackupConfig loads a backup, or the live kubeconfig for "current".
+func loadBackupConfig(id string) (*api.Config, string, error) {
+    if id == CurrentBackupID {
+        path, err := targetKubeconfig()
+        if err != nil {
+            return nil, "", err
+        }
+        config, err := loadKubeconfig(path)
+        return config, path, err
+    }
+    backup, err := FindBackup(id)
+    if err != nil {
+        return nil, "", err
+    }
+    config, err := clientcmd.LoadFromFile(backup.Path)
+    if err != nil {
+        return nil, "", fmt.Errorf("failed to load backup %s: %v", backup.ID, err)
+    }
+    return config, backup.Path, nil
+}
+
+// ShowBackup returns the content of a backup with credentials redacted.
+func ShowBackup(id string) (string, error) {
+    config, _, err := loadBackupConfig(id)
+    if err != nil {
+        return "", err
+    }
+    content, err := redactedYAML(config)
+    if err != nil {
+        return "", err
+    }
+    return string(content), nil
+}
+
+// DiffBackups returns a unified diff from backup a to backup b, either of
+// which may be "current" for the live kubeconfig, with credentials redacted.
+// It returns "" when they are the same.
+func DiffBackups(a, b string) (string, error) {
+    configA, pathA, err := loadBackupConfig(a)
+    if err != nil {
+        return "", err
+    }
+    configB, pathB, err := loadBackupConfig(b)
+    if err != nil {
+        return "", err
+    }
+    contentA, err := redactedYAML(configA)
+    if err != nil {
+        return "", err
     }
+    contentB, err := redactedYAML(configB)
+    if err != nil {
+        return "", err
+    }
+    return unifiedDiff(pathA, pathB, string(contentA), string(contentB)), nil
+}
 
+// RestoreBackup replaces the target kubeconfig with a backup. The current kubeconfig
+// is backed up first, so a restore can itself be undone. It returns the path
+// of that safety backup. The kubeconfig is replaced atomically while holding
+// the kubectm-wide lock and the kubeconfig's <file>.lock.
+func RestoreBackup(id string, keep int) (string, error) {
+    backup, err := FindBackup(id)
+    if err != nil {
+        return "", err
+    }
+    // Read the backup before taking the safety backup, which may prune it.
+    data, err := os.ReadFile(backup.Path)
+    if err != nil {
+        return "", fmt.Errorf("failed to read backup %s: %v", backup.ID, err)
+    }
+    if _, err := clientcmd.Load(data); err != nil {
+        return "", fmt.Errorf("backup %s is not a valid kubeconfig: %v", backup.ID, err)
+    }
+
+    configPath, err := targetKubeconfig()
+    if err != nil {
+        return "", err
+    }
+    lock, err := lockKubectm()
+    if err != nil {
+        return "", err
+    }
+    defer lock.release()
+    fileLock, err := lockKubeconfig(configPath)
+    if err != nil {
+        return "", err
+    }
+    defer fileLock.release()
+
+    safety, err := BackupConfig(keep)
+    if err != nil {
+        return "", fmt.Errorf("failed to back up kubeconfig before restoring: %v", err)
+    }
+    if err := writeFileAtomic(configPath, data, 0600); err != nil {
+        return "", fmt.Errorf("failed to restore kubeconfig: %v", err)
+    }
+    utils.ActionLogger.Printf("%s Restored %s from backup %s", utils.Iso8601Time(), configPath, backup.ID)
+    return safety, nil
+}
+
+// pruneBackups removes the oldest backups with the given prefix, such as
+// config.bak.*, in kubeDir, keeping the most recent `keep` backups. Only
+// files whose suffix is a timestamp kubectm generated are pruned, so manually
+// created backups like config.bak.before-upgrade survive.
+func pruneBackups(kubeDir, prefix string, keep int) error {
+    if keep < 1 {
+        keep = 1
+    }
+
+    backups, err := timestampedBackups(kubeDir, prefix)
+    if err != nil {
+        return err
+    }
     if len(backups) <= keep {
         return nil
     }
 
-    sort.Strings(backups)
-    for _, name := range backups[:len(backups)-keep] {
-        backupPath := filepath.Clean(filepath.Join(kubeDir, name))
-        if !strings.HasPrefix(backupPath, kubeDir) {
-            utils.WarnLogger.Printf("%s Skipping deletion of file outside .kube directory: %s", utils.Iso8601Time(), backupPath)
+    for _, backup := range backups[keep:] {
+        backupPath := filepath.Clean(backup.Path)
+        if !isWithinDir(kubeDir, backupPath) {
+            utils.WarnLogger.Printf("%s Skipping deletion of file outside kubeconfig directory: %s", utils.Iso8601Time(), backupPath)
             continue
         }
         if err := os.Remove(backupPath); err != nil {
             utils.WarnLogger.Printf("%s Warning: failed to delete old backup %s: %v", utils.Iso8601Time(), backupPath, err)
         } else {
             utils.InfoLogger.Printf("%s Deleted old kubeconfig backup %s", utils.Iso8601Time(), backupPath)
+            if err := os.Remove(backupMetadataPath(backupPath)); err != nil && !os.IsNotExist(err) {
+                utils.WarnLogger.Printf("%s Warning: failed to delete metadata of old backup %s: %v", utils.Iso8601Time(), backupPath, err)
+            }
         }
     }
 
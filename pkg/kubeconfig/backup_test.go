@@ -5,6 +5,8 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 const testKubeconfigContent = `apiVersion: v1
@@ -44,7 +46,7 @@ func listBackups(t *testing.T, kubeDir string) []string {
 	}
 	var backups []string
 	for _, entry := range entries {
-		if strings.HasPrefix(entry.Name(), backupPrefix) {
+		if strings.HasPrefix(entry.Name(), backupPrefix("config")) {
 			backups = append(backups, entry.Name())
 		}
 	}
@@ -81,8 +83,8 @@ func TestBackupConfigCreatesBackup(t *testing.T) {
 	if backupPath == "" {
 		t.Fatal("expected a backup path, got empty string")
 	}
-	if !strings.HasPrefix(filepath.Base(backupPath), backupPrefix) {
-		t.Errorf("expected backup filename to start with %q, got %q", backupPrefix, filepath.Base(backupPath))
+	if !strings.HasPrefix(filepath.Base(backupPath), backupPrefix("config")) {
+		t.Errorf("expected backup filename to start with %q, got %q", backupPrefix("config"), filepath.Base(backupPath))
 	}
 
 	data, err := os.ReadFile(backupPath)
@@ -193,3 +195,137 @@ func TestBackupConfigLeavesOtherFilesAlone(t *testing.T) {
 		t.Errorf("expected manual backup to be untouched: %v", err)
 	}
 }
+
+// TestBackupConfigSkipsUnchangedConfig verifies that no new backup is taken
+// when the kubeconfig matches the latest backup.
+func TestBackupConfigSkipsUnchangedConfig(t *testing.T) {
+	kubeDir := setupBackupTestHome(t)
+	writeTestConfig(t, kubeDir)
+	latest := filepath.Join(kubeDir, "config.bak.20200102T000000Z")
+	if err := os.WriteFile(filepath.Join(kubeDir, "config.bak.20200101T000000Z"), []byte("old"), 0600); err != nil {
+		t.Fatalf("failed to create old backup: %v", err)
+	}
+	if err := os.WriteFile(latest, []byte(testKubeconfigContent), 0600); err != nil {
+		t.Fatalf("failed to create latest backup: %v", err)
+	}
+
+	backupPath, err := BackupConfig(DefaultBackupCount)
+	if err != nil {
+		t.Fatalf("BackupConfig() error = %v", err)
+	}
+	if backupPath != latest {
+		t.Errorf("expected the latest backup %s to be reused, got %q", latest, backupPath)
+	}
+	if backups := listBackups(t, kubeDir); len(backups) != 2 {
+		t.Errorf("expected no new backup, got %v", backups)
+	}
+}
+
+// TestBackupConfigNeverOverwritesBackup verifies that backups taken in the
+// same second get a counter instead of replacing each other, and are listed
+// in the order they were taken.
+func TestBackupConfigNeverOverwritesBackup(t *testing.T) {
+	kubeDir := setupBackupTestHome(t)
+	name := "config.bak.20200101T000000Z"
+
+	first, err := writeNewBackup(kubeDir, name, []byte("first"))
+	if err != nil {
+		t.Fatalf("writeNewBackup() error = %v", err)
+	}
+	second, err := writeNewBackup(kubeDir, name, []byte("second"))
+	if err != nil {
+		t.Fatalf("writeNewBackup() error = %v", err)
+	}
+	if filepath.Base(first) != name || filepath.Base(second) != name+"-1" {
+		t.Errorf("expected %s and %s-1, got %s and %s", name, name, first, second)
+	}
+	if data, _ := os.ReadFile(first); string(data) != "first" {
+		t.Errorf("expected the first backup to be kept, got %q", data)
+	}
+
+	backups, err := ListBackups()
+	if err != nil {
+		t.Fatalf("ListBackups() error = %v", err)
+	}
+	if len(backups) != 2 || backups[0].ID != "20200101T000000Z-1" || backups[1].ID != "20200101T000000Z" {
+		t.Errorf("expected the counter backup listed first, got %+v", backups)
+	}
+
+	if err := pruneBackups(kubeDir, backupPrefix("config"), 1); err != nil {
+		t.Fatalf("pruneBackups() error = %v", err)
+	}
+	if backups := listBackups(t, kubeDir); len(backups) != 1 || backups[0] != name+"-1" {
+		t.Errorf("expected only the newest backup to be kept, got %v", backups)
+	}
+}
+
+// TestBackupConfigWritesMetadata verifies the metadata sidecar and that it
+// is pruned together with its backup.
+func TestBackupConfigWritesMetadata(t *testing.T) {
+	kubeDir := setupBackupTestHome(t)
+	config := createTestConfig(testClusterNameMerge, testServerURL, testCAData, testUserName, testToken, testContextName, nil)
+	if err := clientcmd.WriteToFile(*config, filepath.Join(kubeDir, "config")); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+	old := filepath.Join(kubeDir, "config.bak.20200101T000000Z")
+	if err := os.WriteFile(old, []byte("old"), 0600); err != nil {
+		t.Fatalf("failed to create old backup: %v", err)
+	}
+	if err := writeBackupMetadata(old, BackupMetadata{Version: "v0.1.0"}); err != nil {
+		t.Fatalf("failed to write old metadata: %v", err)
+	}
+
+	backupPath, err := BackupConfig(1, "AWS", "Linode")
+	if err != nil {
+		t.Fatalf("BackupConfig() error = %v", err)
+	}
+
+	metadata := readBackupMetadata(backupPath)
+	if metadata == nil {
+		t.Fatal("expected a metadata sidecar")
+	}
+	if metadata.Version != Version || metadata.Contexts != 1 || strings.Join(metadata.Providers, ",") != "AWS,Linode" || len(metadata.SHA256) != 64 {
+		t.Errorf("unexpected metadata %+v", metadata)
+	}
+	if _, err := os.Stat(backupMetadataPath(old)); !os.IsNotExist(err) {
+		t.Errorf("expected the pruned backup's metadata to be removed, got %v", err)
+	}
+}
+
+// TestRestoreBackup verifies that restoring replaces the kubeconfig and
+// keeps a safety backup of the config it replaced.
+func TestRestoreBackup(t *testing.T) {
+	kubeDir := setupBackupTestHome(t)
+	configPath := filepath.Join(kubeDir, "config")
+	if err := os.WriteFile(filepath.Join(kubeDir, "config.bak.20200101T000000Z"), []byte(testKubeconfigContent), 0600); err != nil {
+		t.Fatalf("failed to create backup: %v", err)
+	}
+	current := createTestConfig(testClusterNameMerge, testServerURL, testCAData, testUserName, testToken, testContextName, nil)
+	if err := clientcmd.WriteToFile(*current, configPath); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+	currentData, _ := os.ReadFile(configPath)
+
+	diff, err := DiffBackups("20200101T000000Z", CurrentBackupID)
+	if err != nil {
+		t.Fatalf("DiffBackups() error = %v", err)
+	}
+	if !strings.Contains(diff, "+    server: "+testServerURL) || strings.Contains(diff, testToken) {
+		t.Errorf("expected a redacted diff adding the current cluster, got:\n%s", diff)
+	}
+
+	safety, err := RestoreBackup(LatestBackupID, 1)
+	if err != nil {
+		t.Fatalf("RestoreBackup() error = %v", err)
+	}
+	if restored, _ := os.ReadFile(configPath); string(restored) != testKubeconfigContent {
+		t.Errorf("expected the backup to be restored, got %q", string(restored))
+	}
+	if saved, err := os.ReadFile(safety); err != nil || string(saved) != string(currentData) {
+		t.Errorf("expected safety backup %q to hold the replaced config, got %v", safety, err)
+	}
+
+	if _, err := RestoreBackup("20990101T000000Z", 1); err == nil {
+		t.Error("expected an error for an unknown backup")
+	}
+}
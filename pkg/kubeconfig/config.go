@@ -0,0 +1,234 @@
+package kubeconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// kubectmConfig represents the optional ~/.kubectm/config.json file.
+type kubectmConfig struct {
+	AWSRegions []string `json:"aws_regions"`
+	// Prune is the default stale-context policy: "off", "confirm" or "auto".
+	Prune string `json:"prune,omitempty"`
+	// PruneGracePeriod is how long a cluster must be missing before its
+	// context is pruned, as a Go duration such as "72h".
+	PruneGracePeriod string `json:"prune_grace_period,omitempty"`
+	// Naming holds naming rules keyed by provider name, or "default".
+	Naming map[string]NamingRule `json:"naming,omitempty"`
+	// Rename holds the rules `kubectm rename` applies when none are given on
+	// the command line.
+	Rename []RenameRule `json:"rename,omitempty"`
+	// Output is the default output mode: "merge", "provider" or "cluster".
+	Output string `json:"output,omitempty"`
+	// Conflicts is the default policy for local edits that conflict with
+	// upstream changes: "prefer-local", "prefer-remote" or "prompt".
+	Conflicts string `json:"conflicts,omitempty"`
+	// Pinned holds the names and patterns of contexts kubectm must never
+	// modify, rename or prune. `kubectm pin` maintains it.
+	Pinned []string `json:"pinned,omitempty"`
+	// CurrentContext is the default current-context policy: "keep",
+	// "newest" or the name of a context to switch to.
+	CurrentContext string `json:"current_context,omitempty"`
+}
+
+// kubectmDir returns the ~/.kubectm directory, confined to the home directory.
+func kubectmDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf(errHomeDirFmt, err)
+	}
+	homeDir = filepath.Clean(homeDir)
+
+	dir := filepath.Clean(filepath.Join(homeDir, ".kubectm"))
+	if !strings.HasPrefix(dir, homeDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid kubectm directory outside user home")
+	}
+	return dir, nil
+}
+
+// loadKubectmConfig reads ~/.kubectm/config.json. A missing file yields an
+// empty config.
+func loadKubectmConfig() (*kubectmConfig, error) {
+	dir, err := kubectmDir()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &kubectmConfig{}, nil
+		}
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+
+	var config kubectmConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing config file: %v", err)
+	}
+	return &config, nil
+}
+
+// ConfigPath returns the path of ~/.kubectm/config.json.
+func ConfigPath() (string, error) {
+	dir, err := kubectmDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// updateSettings rewrites ~/.kubectm/config.json with update, which changes
+// the settings it is given by key; every other setting is kept as written.
+// It holds the kubectm-wide lock so a sync never reads a half-updated file.
+func updateSettings(update func(settings map[string]json.RawMessage) error) error {
+	configPath, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
+		return fmt.Errorf("failed to create kubectm directory: %v", err)
+	}
+	lock, err := lockKubectm()
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+
+	settings := map[string]json.RawMessage{}
+	data, err := os.ReadFile(configPath)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return fmt.Errorf("error parsing config file: %v", err)
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("error reading config file: %v", err)
+	}
+
+	if err := update(settings); err != nil {
+		return err
+	}
+	data, err = json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode config file: %v", err)
+	}
+	return writeFileAtomic(configPath, append(data, '\n'), 0600)
+}
+
+// settingParsers validates the values `kubectm config set` accepts, keyed by
+// setting name, and returns them as they are stored. Naming and rename rules
+// and pins have their own structure and are edited by hand or with
+// `kubectm pin`.
+var settingParsers = map[string]func(string) (any, error){
+	"aws_regions": func(s string) (any, error) {
+		var regions []string
+		for _, region := range strings.Split(s, ",") {
+			if region = strings.TrimSpace(region); region != "" {
+				regions = append(regions, region)
+			}
+		}
+		if len(regions) == 0 {
+			return nil, fmt.Errorf("invalid AWS regions %q", s)
+		}
+		return regions, nil
+	},
+	"prune": func(s string) (any, error) {
+		_, err := ParsePrunePolicy(s)
+		return s, err
+	},
+	"prune_grace_period": func(s string) (any, error) {
+		if grace, err := time.ParseDuration(s); err != nil || grace < 0 {
+			return nil, fmt.Errorf("invalid prune grace period %q", s)
+		}
+		return s, nil
+	},
+	"output": func(s string) (any, error) {
+		_, err := ParseOutputMode(s)
+		return s, err
+	},
+	"conflicts": func(s string) (any, error) {
+		_, err := ParseConflictPolicy(s)
+		return s, err
+	},
+	"current_context": func(s string) (any, error) {
+		_, err := ParseCurrentContext(s)
+		return s, err
+	},
+}
+
+// SettingNames returns the names of the settings SetSetting accepts, sorted.
+func SettingNames() []string {
+	names := make([]string, 0, len(settingParsers))
+	for name := range settingParsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetSetting returns a setting of ~/.kubectm/config.json as compact JSON, or
+// "" if it is not set. Any setting in the file can be read, not only those
+// SetSetting accepts.
+func GetSetting(name string) (string, error) {
+	configPath, err := ConfigPath()
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("error reading config file: %v", err)
+	}
+	settings := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return "", fmt.Errorf("error parsing config file: %v", err)
+	}
+	raw, ok := settings[name]
+	if !ok {
+		return "", nil
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, raw); err != nil {
+		return "", fmt.Errorf("error parsing %s: %v", name, err)
+	}
+	return compact.String(), nil
+}
+
+// SetSetting validates value and stores it as a setting of
+// ~/.kubectm/config.json, keeping every other setting as written.
+func SetSetting(name, value string) error {
+	parse, ok := settingParsers[name]
+	if !ok {
+		return fmt.Errorf("unknown setting %q (want one of %s)", name, strings.Join(SettingNames(), ", "))
+	}
+	parsed, err := parse(value)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(parsed)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %v", name, err)
+	}
+	return updateSettings(func(settings map[string]json.RawMessage) error {
+		settings[name] = raw
+		return nil
+	})
+}
+
+// UnsetSetting removes a setting from ~/.kubectm/config.json, so its default
+// applies again. Removing a setting that is not set is not an error.
+func UnsetSetting(name string) error {
+	return updateSettings(func(settings map[string]json.RawMessage) error {
+		delete(settings, name)
+		return nil
+	})
+}
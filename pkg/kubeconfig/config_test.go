@@ -0,0 +1,50 @@
+package kubeconfig
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetSettingKeepsOtherSettings(t *testing.T) {
+	home := setupBackupTestHome(t)
+	configPath := filepath.Join(home, "..", ".kubectm", "config.json")
+	if err := os.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
+		t.Fatalf("failed to create kubectm directory: %v", err)
+	}
+	if err := os.WriteFile(configPath, []byte(`{"pinned": ["prod"], "naming": {"default": {"context": "{{.Name}}"}}}`), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	if err := SetSetting("aws_regions", "us-east-1, eu-west-1"); err != nil {
+		t.Fatalf("SetSetting() error = %v", err)
+	}
+	if err := SetSetting("prune", "auto"); err != nil {
+		t.Fatalf("SetSetting() error = %v", err)
+	}
+	if err := SetSetting("prune", "sometimes"); err == nil {
+		t.Error("expected an invalid prune policy to be rejected")
+	}
+	if err := SetSetting("pinned", "prod"); err == nil {
+		t.Error("expected a setting with its own command to be rejected")
+	}
+	if err := UnsetSetting("prune"); err != nil {
+		t.Fatalf("UnsetSetting() error = %v", err)
+	}
+
+	if got, err := GetSetting("aws_regions"); err != nil || got != `["us-east-1","eu-west-1"]` {
+		t.Errorf("GetSetting(aws_regions) = %s (err %v)", got, err)
+	}
+	if got, err := GetSetting("prune"); err != nil || got != "" {
+		t.Errorf("expected prune to be unset, got %s (err %v)", got, err)
+	}
+	config, err := loadKubectmConfig()
+	if err != nil {
+		t.Fatalf("loadKubectmConfig() error = %v", err)
+	}
+	if len(config.Pinned) != 1 || config.Naming["default"].Context == "" {
+		data, _ := json.Marshal(config)
+		t.Errorf("expected the other settings to be kept, got %s", data)
+	}
+}
@@ -0,0 +1,127 @@
+package kubeconfig
+
+import (
+	"fmt"
+
+	"kubectm/pkg/utils"
+
+	"github.com/fatih/color"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// CurrentContextPolicy controls what a sync does with the kubeconfig's
+// current-context. Downloaded kubeconfigs set their own current-context, but
+// it is never copied; only the policy moves the current-context.
+type CurrentContextPolicy string
+
+const (
+	// CurrentContextKeep leaves the current-context as it is.
+	CurrentContextKeep CurrentContextPolicy = "keep"
+	// CurrentContextNewest switches to the context of a cluster the sync
+	// added, the last one merged if it added several.
+	CurrentContextNewest CurrentContextPolicy = "newest"
+	// CurrentContextNamed switches to the context named in the options.
+	CurrentContextNamed CurrentContextPolicy = "named"
+)
+
+// CurrentContextOptions configures the current-context policy. The zero
+// value keeps the current-context.
+type CurrentContextOptions struct {
+	Policy CurrentContextPolicy
+	// Name is the context to switch to under CurrentContextNamed.
+	Name string
+}
+
+// ParseCurrentContext parses a current-context setting: "keep", "newest",
+// or the name of the context to switch to.
+func ParseCurrentContext(s string) (CurrentContextOptions, error) {
+	switch p := CurrentContextPolicy(s); p {
+	case CurrentContextKeep, CurrentContextNewest:
+		return CurrentContextOptions{Policy: p}, nil
+	}
+	if !validName(s) {
+		return CurrentContextOptions{}, fmt.Errorf("invalid current-context %q (want keep, newest or a context name)", s)
+	}
+	return CurrentContextOptions{Policy: CurrentContextNamed, Name: s}, nil
+}
+
+// ResolveCurrentContext returns the current-context policy from the given
+// flag value, falling back to ~/.kubectm/config.json and then to keep. An
+// empty flag value is treated as unset.
+func ResolveCurrentContext(setting string) (CurrentContextOptions, error) {
+	if setting == "" {
+		config, err := loadKubectmConfig()
+		if err != nil {
+			return CurrentContextOptions{Policy: CurrentContextKeep}, err
+		}
+		setting = config.CurrentContext
+	}
+	if setting == "" {
+		return CurrentContextOptions{Policy: CurrentContextKeep}, nil
+	}
+	return ParseCurrentContext(setting)
+}
+
+// managedClusters returns the provider and cluster ID of every cluster
+// state manages a context for, as addedContexts expects them.
+func managedClusters(state *kubeconfigState) map[string]bool {
+	clusters := map[string]bool{}
+	for _, managed := range state.Contexts {
+		clusters[managed.Provider+"/"+managed.ClusterID] = true
+	}
+	return clusters
+}
+
+// addedContexts returns the contexts of the clusters state manages now but
+// did not when it managed before, in the order the clusters were downloaded.
+// A context renamed by the sync is not added, since its cluster was managed.
+func addedContexts(downloaded []DownloadedConfig, before map[string]bool, state *kubeconfigState) []string {
+	var added []string
+	for _, d := range downloaded {
+		if before[d.Provider+"/"+d.Cluster.ID] {
+			continue
+		}
+		for _, name := range sortedKeys(state.Contexts) {
+			managed := state.Contexts[name]
+			if managed.Provider == d.Provider && managed.ClusterID == d.Cluster.ID && !containsString(added, name) {
+				added = append(added, name)
+			}
+		}
+	}
+	return added
+}
+
+// applyCurrentContext sets config's current-context according to opts, given
+// the contexts the sync added in the order they were merged, and records the
+// decision in report.
+func applyCurrentContext(config *api.Config, added []string, opts CurrentContextOptions, report *Report) {
+	previous := config.CurrentContext
+	reason := "kept"
+	switch opts.Policy {
+	case CurrentContextNewest:
+		if len(added) == 0 {
+			reason = "kept, no cluster was added"
+			break
+		}
+		config.CurrentContext = added[len(added)-1]
+		reason = "newest cluster"
+	case CurrentContextNamed:
+		if config.Contexts[opts.Name] == nil {
+			utils.WarnLogger.Printf("%s Context %s does not exist; keeping the current context", utils.Iso8601Time(), opts.Name)
+			reason = fmt.Sprintf("kept, context %s does not exist", opts.Name)
+			break
+		}
+		config.CurrentContext = opts.Name
+		reason = "as configured"
+	}
+
+	if config.CurrentContext != previous {
+		if previous == "" {
+			reason = "set, " + reason
+		} else {
+			reason = fmt.Sprintf("switched from %s, %s", previous, reason)
+		}
+		utils.ActionLogger.Printf("%s Switched current context to %s", utils.Iso8601Time(), color.New(color.Bold).Sprint(config.CurrentContext))
+	}
+	report.CurrentContext, report.CurrentContextReason = config.CurrentContext, reason
+}
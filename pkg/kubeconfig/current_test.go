@@ -0,0 +1,90 @@
+package kubeconfig
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestMergeConfigsCurrentContext(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        CurrentContextOptions
+		wantCurrent string
+		wantReason  string
+	}{
+		{name: "keep by default", wantCurrent: "lke-prod", wantReason: "kept"},
+		{name: "newest", opts: CurrentContextOptions{Policy: CurrentContextNewest}, wantCurrent: "lke-staging", wantReason: "switched from lke-prod, newest cluster"},
+		{name: "named", opts: CurrentContextOptions{Policy: CurrentContextNamed, Name: "lke-dev"}, wantCurrent: "lke-dev", wantReason: "switched from lke-prod, as configured"},
+		{name: "named but missing", opts: CurrentContextOptions{Policy: CurrentContextNamed, Name: "gone"}, wantCurrent: "lke-prod", wantReason: "kept, context gone does not exist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeDir := setupBackupTestHome(t)
+			configPath := filepath.Join(kubeDir, "config")
+			if _, err := MergeConfigs(&DownloadResult{Configs: []DownloadedConfig{splitDownload("Linode", "1", "lke-prod")}}, MergeOptions{}); err != nil {
+				t.Fatalf("MergeConfigs() error = %v", err)
+			}
+			editKubeconfig(t, configPath, func(config *api.Config) {
+				config.CurrentContext = "lke-prod"
+			})
+
+			// Every downloaded kubeconfig names its own context as current;
+			// the resync of lke-prod adds no cluster.
+			var configs []DownloadedConfig
+			for _, d := range []DownloadedConfig{splitDownload("Linode", "2", "lke-dev"), splitDownload("Linode", "1", "lke-prod"), splitDownload("Linode", "3", "lke-staging")} {
+				d.Config.CurrentContext = d.Cluster.ContextName
+				configs = append(configs, d)
+			}
+			report, err := MergeConfigs(&DownloadResult{Configs: configs}, MergeOptions{CurrentContext: tt.opts})
+			if err != nil {
+				t.Fatalf("MergeConfigs() error = %v", err)
+			}
+
+			config, err := clientcmd.LoadFromFile(configPath)
+			if err != nil {
+				t.Fatalf("failed to load kubeconfig: %v", err)
+			}
+			if config.CurrentContext != tt.wantCurrent {
+				t.Errorf("current-context = %q, want %q", config.CurrentContext, tt.wantCurrent)
+			}
+			if report.CurrentContext != tt.wantCurrent || report.CurrentContextReason != tt.wantReason {
+				t.Errorf("report = %q (%s), want %q (%s)", report.CurrentContext, report.CurrentContextReason, tt.wantCurrent, tt.wantReason)
+			}
+			var out strings.Builder
+			report.Print(&out)
+			if !strings.Contains(out.String(), "Current context: "+tt.wantCurrent+" ("+tt.wantReason+")") {
+				t.Errorf("expected the decision in the printed report, got:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestApplyCurrentContextNewestWithoutNewClusters(t *testing.T) {
+	config := api.NewConfig()
+	config.Contexts["lke-prod"] = api.NewContext()
+	report := &Report{}
+	applyCurrentContext(config, nil, CurrentContextOptions{Policy: CurrentContextNewest}, report)
+	if config.CurrentContext != "" || report.CurrentContextReason != "kept, no cluster was added" {
+		t.Errorf("expected the unset current-context to be kept, got %q (%s)", config.CurrentContext, report.CurrentContextReason)
+	}
+}
+
+func TestParseCurrentContext(t *testing.T) {
+	tests := map[string]CurrentContextOptions{
+		"keep":     {Policy: CurrentContextKeep},
+		"newest":   {Policy: CurrentContextNewest},
+		"lke-prod": {Policy: CurrentContextNamed, Name: "lke-prod"},
+	}
+	for setting, want := range tests {
+		if got, err := ParseCurrentContext(setting); err != nil || got != want {
+			t.Errorf("ParseCurrentContext(%q) = %+v (err %v), want %+v", setting, got, err, want)
+		}
+	}
+	if _, err := ParseCurrentContext("two words"); err == nil {
+		t.Error("expected an invalid context name to be rejected")
+	}
+}
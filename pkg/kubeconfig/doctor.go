@@ -0,0 +1,161 @@
+package kubeconfig
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CheckStatus is the outcome of a Check.
+type CheckStatus string
+
+const (
+	CheckOK   CheckStatus = "ok"
+	CheckWarn CheckStatus = "warn"
+	CheckFail CheckStatus = "fail"
+)
+
+// Check is the result of one `kubectm doctor` check.
+type Check struct {
+	Name   string
+	Status CheckStatus
+	Detail string
+}
+
+// Diagnose checks the files kubectm keeps and syncs into: the settings in
+// ~/.kubectm/config.json, the target kubeconfig, the state file, the pins and
+// the backups. It reads them the way a sync would but writes nothing.
+func Diagnose() []Check {
+	return []Check{checkSettings(), checkKubeconfig(), checkState(), checkPins(), checkBackups()}
+}
+
+// checkSettings parses ~/.kubectm/config.json and every rule and policy in it.
+func checkSettings() Check {
+	check := Check{Name: "settings", Status: CheckOK}
+	configPath, err := ConfigPath()
+	if err != nil {
+		return Check{Name: check.Name, Status: CheckFail, Detail: err.Error()}
+	}
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		check.Detail = configPath + " not found, using defaults"
+		return check
+	}
+
+	for _, resolve := range []func() error{
+		func() error { _, err := loadKubectmConfig(); return err },
+		func() error { _, err := LoadNamer(); return err },
+		func() error {
+			rules, err := LoadRenameRules()
+			if err == nil {
+				_, err = compileRenameRules(rules)
+			}
+			return err
+		},
+		func() error { _, err := ResolvePruneOptions("", ""); return err },
+		func() error { _, err := ResolveOutputMode(""); return err },
+		func() error { _, err := ResolveConflictOptions(""); return err },
+		func() error { _, err := ResolveCurrentContext(""); return err },
+	} {
+		if err := resolve(); err != nil {
+			return Check{Name: check.Name, Status: CheckFail, Detail: fmt.Sprintf("%s: %v", configPath, err)}
+		}
+	}
+	check.Detail = configPath
+	return check
+}
+
+// checkKubeconfig loads and validates the target kubeconfig.
+func checkKubeconfig() Check {
+	check := Check{Name: "kubeconfig", Status: CheckOK}
+	path, err := targetKubeconfig()
+	if err != nil {
+		return Check{Name: check.Name, Status: CheckFail, Detail: err.Error()}
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return Check{Name: check.Name, Status: CheckWarn, Detail: path + " not found; a sync creates it"}
+	}
+	config, err := loadKubeconfig(path)
+	if err != nil {
+		return Check{Name: check.Name, Status: CheckFail, Detail: err.Error()}
+	}
+
+	check.Detail = fmt.Sprintf("%s, %d contexts", path, len(config.Contexts))
+	if problems := validationErrors(config); len(problems) > 0 {
+		check.Status = CheckWarn
+		check.Detail += "; " + strings.Join(problems, "; ")
+	}
+	if config.CurrentContext != "" && config.Contexts[config.CurrentContext] == nil {
+		check.Status = CheckWarn
+		check.Detail += fmt.Sprintf("; current-context %s does not exist", config.CurrentContext)
+	}
+	return check
+}
+
+// checkState reads ~/.kubectm/state.json and compares the contexts it
+// records for the target kubeconfig with the kubeconfig itself.
+func checkState() Check {
+	check := Check{Name: "state", Status: CheckOK}
+	state, err := loadSyncState()
+	if err != nil {
+		return Check{Name: check.Name, Status: CheckFail, Detail: err.Error()}
+	}
+	path, err := targetKubeconfig()
+	if err != nil {
+		return Check{Name: check.Name, Status: CheckFail, Detail: err.Error()}
+	}
+	managed := state.Kubeconfigs[path]
+	if managed == nil || len(managed.Contexts) == 0 {
+		check.Detail = "no contexts synced into " + path
+		return check
+	}
+
+	check.Detail = fmt.Sprintf("%d contexts synced into %s", len(managed.Contexts), path)
+	config, err := loadKubeconfig(path)
+	if err != nil {
+		return check
+	}
+	var missing []string
+	for _, name := range sortedKeys(managed.Contexts) {
+		if config.Contexts[name] == nil {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		check.Status = CheckWarn
+		check.Detail += "; missing from the kubeconfig: " + strings.Join(missing, ", ")
+	}
+	return check
+}
+
+// checkPins reports pins that match no context of the target kubeconfig.
+func checkPins() Check {
+	check := Check{Name: "pins", Status: CheckOK}
+	pins, err := ListPins()
+	if err != nil {
+		return Check{Name: check.Name, Status: CheckFail, Detail: err.Error()}
+	}
+	var unmatched []string
+	for _, pin := range pins {
+		if len(pin.Contexts) == 0 {
+			unmatched = append(unmatched, pin.Pattern)
+		}
+	}
+	check.Detail = fmt.Sprintf("%d pinned", len(pins))
+	if len(unmatched) > 0 {
+		check.Status = CheckWarn
+		check.Detail += "; matching no context: " + strings.Join(unmatched, ", ")
+	}
+	return check
+}
+
+// checkBackups lists the backups of the target kubeconfig.
+func checkBackups() Check {
+	backups, err := ListBackups()
+	if err != nil {
+		return Check{Name: "backups", Status: CheckFail, Detail: err.Error()}
+	}
+	if len(backups) == 0 {
+		return Check{Name: "backups", Status: CheckOK, Detail: "none yet"}
+	}
+	return Check{Name: "backups", Status: CheckOK, Detail: fmt.Sprintf("%d, latest %s", len(backups), backups[0].ID)}
+}
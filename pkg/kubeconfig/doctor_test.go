@@ -0,0 +1,54 @@
+package kubeconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestDiagnose(t *testing.T) {
+	kubeDir := setupBackupTestHome(t)
+	configPath := filepath.Join(kubeDir, "config")
+	if _, err := MergeConfigs(&DownloadResult{Configs: []DownloadedConfig{splitDownload("Linode", "1", "lke-prod"), splitDownload("Linode", "2", "lke-dev")}}, MergeOptions{}); err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+	editKubeconfig(t, configPath, func(config *api.Config) {
+		delete(config.Contexts, "lke-dev")
+	})
+	if err := PinContexts("staging-*"); err != nil {
+		t.Fatalf("PinContexts() error = %v", err)
+	}
+
+	checks := map[string]Check{}
+	for _, check := range Diagnose() {
+		checks[check.Name] = check
+	}
+	if c := checks["settings"]; c.Status != CheckOK {
+		t.Errorf("expected the settings to pass, got %+v", c)
+	}
+	if c := checks["kubeconfig"]; c.Status != CheckOK || !strings.Contains(c.Detail, "1 contexts") {
+		t.Errorf("expected the kubeconfig to pass, got %+v", c)
+	}
+	if c := checks["state"]; c.Status != CheckWarn || !strings.Contains(c.Detail, "missing from the kubeconfig: lke-dev") {
+		t.Errorf("expected the context removed by hand to be reported, got %+v", c)
+	}
+	if c := checks["pins"]; c.Status != CheckWarn || !strings.Contains(c.Detail, "staging-*") {
+		t.Errorf("expected the unmatched pin to be reported, got %+v", c)
+	}
+
+	configFile, err := ConfigPath()
+	if err != nil {
+		t.Fatalf("ConfigPath() error = %v", err)
+	}
+	if err := os.WriteFile(configFile, []byte(`{"prune": "sometimes"}`), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	for _, c := range Diagnose() {
+		if c.Name == "settings" && c.Status != CheckFail {
+			t.Errorf("expected an invalid prune policy to fail the settings check, got %+v", c)
+		}
+	}
+}
@@ -1,30 +1,243 @@
 package kubeconfig
 
 import (
-    "kubectm/pkg/credentials"
+    "context"
     "fmt"
+    "strings"
+    "sync"
+
+    "kubectm/pkg/credentials"
+    "kubectm/pkg/provider"
+    "kubectm/pkg/utils"
+
+    "github.com/fatih/color"
+    "k8s.io/client-go/tools/clientcmd/api"
 )
 
-// DownloadConfigs downloads the kubeconfig files from the specified providers.
-// It loops through the given credentials and uses the provider to download the
-// corresponding kubeconfig file.
-func DownloadConfigs(creds []credentials.Credential) error {
+// DownloadedConfig is a parsed kubeconfig for a single cluster, tagged with
+// the provider and cluster it was downloaded from.
+type DownloadedConfig struct {
+    Provider string
+    // Account is the profile, project or subscription the cluster belongs to.
+    Account  string
+    Cluster  provider.Cluster
+    Config   *api.Config
+}
+
+// DownloadResult holds the kubeconfigs downloaded in a run and the clusters
+// each provider listed.
+type DownloadResult struct {
+    Configs []DownloadedConfig
+    // Listed holds, for each provider whose cluster listing completed without
+    // errors, the IDs of every cluster it listed, keyed by listingKey for each
+    // account the listing covered. Providers with failed or partial listings,
+    // and accounts not listed in this run, are absent, so their contexts are
+    // never pruned.
+    Listed map[string]map[string]bool
+    // Failed holds the providers whose download failed, in the order they
+    // were given.
+    Failed []ProviderError
+}
+
+// ProviderError is the error that failed a provider's download.
+type ProviderError struct {
+    Provider string
+    Err      error
+}
+
+func (e ProviderError) Error() string {
+    return fmt.Sprintf("%s: %v", e.Provider, e.Err)
+}
+
+func (e ProviderError) Unwrap() error {
+    return e.Err
+}
+
+// Add appends the configs, listings and failures of another result.
+func (r *DownloadResult) Add(other *DownloadResult) {
+    if other == nil {
+        return
+    }
+    r.Configs = append(r.Configs, other.Configs...)
+    r.Failed = append(r.Failed, other.Failed...)
+    for name, ids := range other.Listed {
+        if r.Listed == nil {
+            r.Listed = map[string]map[string]bool{}
+        }
+        r.Listed[name] = ids
+    }
+}
+
+// deepCopy returns a copy of the result whose configs can be merged without
+// changing the originals. Listed is shared, as merges only read it.
+func (r *DownloadResult) deepCopy() *DownloadResult {
+    c := &DownloadResult{Configs: make([]DownloadedConfig, len(r.Configs)), Listed: r.Listed, Failed: r.Failed}
+    for i, d := range r.Configs {
+        if d.Config != nil {
+            d.Config = d.Config.DeepCopy()
+        }
+        c.Configs[i] = d
+    }
+    return c
+}
+
+// ListedCluster is a cluster a provider listed, tagged with its provider and
+// account.
+type ListedCluster struct {
+    Provider string
+    Account  string
+    Cluster  provider.Cluster
+}
+
+// ListClusters lists the clusters of the specified providers without
+// downloading any kubeconfig. The returned result has no configs, but its
+// Listed is filled as DownloadAll fills it, so merging it only prunes.
+// A failing plugin is skipped.
+func ListClusters(creds []credentials.Credential) ([]ListedCluster, *DownloadResult, error) {
+    ctx := context.Background()
+
+    var listed []ListedCluster
+    result := &DownloadResult{Listed: map[string]map[string]bool{}}
     for _, cred := range creds {
-        switch cred.Provider {
-        case "Linode":
-            err := downloadLinodeKubeConfig(cred)
-            if err != nil {
-                return fmt.Errorf("error downloading Linode kubeconfig: %v", err)
-            }
-        case "AWS":
-            err := downloadAWSKubeConfig(cred)
-            if err != nil {
-                return fmt.Errorf("error downloading AWS EKS kubeconfig: %v", err)
+        _, clusters, err := listProviderClusters(ctx, cred, result)
+        if provider.IsPluginError(err) {
+            // A misbehaving plugin must not abort the other providers.
+            utils.WarnLogger.Printf("%s Skipping %s: %v", utils.Iso8601Time(), cred.Provider, err)
+            continue
+        }
+        if err != nil {
+            return nil, nil, err
+        }
+        for _, cluster := range clusters {
+            listed = append(listed, ListedCluster{Provider: cred.Provider, Account: clusterAccount(cred, cluster), Cluster: cluster})
+        }
+    }
+    return listed, result, nil
+}
+
+// listProviderClusters looks up the registered provider for cred and lists
+// its clusters, recording a complete listing in result.Listed. A partial
+// listing is used but not recorded.
+func listProviderClusters(ctx context.Context, cred credentials.Credential, result *DownloadResult) (provider.Provider, []provider.Cluster, error) {
+    p, ok := provider.Get(cred.Provider)
+    if !ok {
+        return nil, nil, fmt.Errorf("provider %s is not supported", cred.Provider)
+    }
+
+    clusters, err := p.ListClusters(ctx, cred)
+    complete := err == nil
+    if provider.IsPartialList(err) {
+        // Use what was listed, but never treat the listing as complete.
+        utils.WarnLogger.Printf("%s %s: %v", utils.Iso8601Time(), cred.Provider, err)
+    } else if err != nil {
+        return nil, nil, fmt.Errorf("error listing %s clusters: %w", cred.Provider, err)
+    }
+
+    if complete {
+        ids := make(map[string]bool, len(clusters))
+        for _, cluster := range clusters {
+            ids[cluster.ID] = true
+        }
+        for _, account := range listedAccounts(cred, clusters) {
+            result.Listed[listingKey(cred.Provider, account)] = ids
+        }
+    }
+    return p, clusters, nil
+}
+
+// listingKey returns the key of a provider's account in DownloadResult.Listed.
+// Cluster IDs are only unique within an account, such as a Linode token or
+// an AWS profile, so a listing only covers the accounts it was made with.
+func listingKey(provider, account string) string {
+    return provider + "/" + account
+}
+
+// listedAccounts returns the accounts a complete listing with cred covered:
+// the credential's own, each account it names (an Azure credential can name
+// several subscriptions), and the account of every listed cluster.
+func listedAccounts(cred credentials.Credential, clusters []provider.Cluster) []string {
+    account := credentialAccount(cred)
+    accounts := []string{account}
+    for _, a := range strings.Split(account, ",") {
+        if a != "" && !containsString(accounts, a) {
+            accounts = append(accounts, a)
+        }
+    }
+    for _, cluster := range clusters {
+        if a := clusterAccount(cred, cluster); !containsString(accounts, a) {
+            accounts = append(accounts, a)
+        }
+    }
+    return accounts
+}
+
+// DownloadAll downloads the kubeconfigs from the specified providers
+// concurrently. A provider that fails is recorded in the result's Failed,
+// without its configs, and the others still complete. Configs are returned in
+// the order of creds. It looks up the registered provider for each
+// credential and returns a parsed kubeconfig for every cluster the provider
+// lists; nothing is written to disk. Cancelling ctx stops
+// every provider still downloading, and each fails with ctx's error.
+func DownloadAll(ctx context.Context, creds []credentials.Credential) *DownloadResult {
+    results := make([]*DownloadResult, len(creds))
+    var wg sync.WaitGroup
+    for i, cred := range creds {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            utils.InfoLogger.Printf("%s Downloading kubeconfig from %s", utils.Iso8601Time(), cred.Provider)
+            results[i] = &DownloadResult{Listed: map[string]map[string]bool{}}
+            if err := downloadProvider(ctx, cred, results[i]); err != nil {
+                results[i] = &DownloadResult{Failed: []ProviderError{{Provider: cred.Provider, Err: err}}}
             }
-        default:
-            // Print a message to the user if the provider is not supported
-            fmt.Printf("Provider %s is not supported yet\n", cred.Provider)
+        }()
+    }
+    wg.Wait()
+
+    downloaded := &DownloadResult{Listed: map[string]map[string]bool{}}
+    for _, result := range results {
+        downloaded.Add(result)
+    }
+    return downloaded
+}
+
+// downloadProvider lists the clusters of the provider for cred and adds a
+// parsed kubeconfig for each one to result. A cluster whose kubeconfig cannot
+// be fetched is skipped with a warning.
+func downloadProvider(ctx context.Context, cred credentials.Credential, result *DownloadResult) error {
+    p, clusters, err := listProviderClusters(ctx, cred, result)
+    if err != nil {
+        return err
+    }
+
+    for _, cluster := range clusters {
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+        utils.ActionLogger.Printf("%s Downloading kubeconfig for %s cluster: %s", utils.Iso8601Time(), cred.Provider, color.New(color.Bold).Sprint(cluster.ContextName))
+
+        config, err := p.Kubeconfig(ctx, cred, cluster)
+        if err != nil {
+            utils.WarnLogger.Printf("%s Failed to get kubeconfig for %s cluster %s: %v", utils.Iso8601Time(), cred.Provider, cluster.ContextName, err)
+            continue
         }
+
+        result.Configs = append(result.Configs, DownloadedConfig{
+            Provider: cred.Provider,
+            Account:  clusterAccount(cred, cluster),
+            Cluster:  cluster,
+            Config:   config,
+        })
     }
     return nil
 }
+
+// clusterAccount returns the account a cluster belongs to. A provider can
+// report it per cluster in the "Account" detail; otherwise it is taken from
+// the credential.
+func clusterAccount(cred credentials.Credential, cluster provider.Cluster) string {
+    if account := cluster.Details["Account"]; account != "" {
+        return account
+    }
+    return credentialAccount(cred)
+}
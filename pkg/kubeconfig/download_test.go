@@ -0,0 +1,147 @@
+package kubeconfig
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"kubectm/pkg/credentials"
+	"kubectm/pkg/provider"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// downloadTestProvider lists one cluster, or fails with err. If block is set,
+// listing waits for ctx to be cancelled.
+type downloadTestProvider struct {
+	name  string
+	err   error
+	block bool
+}
+
+func (p downloadTestProvider) Name() string { return p.name }
+
+func (p downloadTestProvider) Discover(ctx context.Context) (*credentials.Credential, error) {
+	return &credentials.Credential{Provider: p.name}, nil
+}
+
+func (p downloadTestProvider) ListClusters(ctx context.Context, cred credentials.Credential) ([]provider.Cluster, error) {
+	if p.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return []provider.Cluster{{ID: "1", Name: p.name + "-cluster", ContextName: p.name + "-cluster"}}, nil
+}
+
+func (p downloadTestProvider) Kubeconfig(ctx context.Context, cred credentials.Credential, cluster provider.Cluster) (*api.Config, error) {
+	return api.NewConfig(), nil
+}
+
+// withDownloadTestProviders registers the test providers, and extra, in
+// place of the registered ones until the test ends.
+func withDownloadTestProviders(t *testing.T, extra ...provider.Provider) {
+	t.Helper()
+	ps := []provider.Provider{
+		downloadTestProvider{name: "download-ok-a"},
+		downloadTestProvider{name: "download-ok-b"},
+		downloadTestProvider{name: "download-broken", err: errors.New("API unavailable")},
+		downloadTestProvider{name: "download-blocked", block: true},
+	}
+	t.Cleanup(provider.Swap(append(ps, extra...)...))
+}
+
+// downloadTestCreds returns a credential for each named provider.
+func downloadTestCreds(names ...string) []credentials.Credential {
+	creds := make([]credentials.Credential, 0, len(names))
+	for _, name := range names {
+		creds = append(creds, credentials.Credential{Provider: name})
+	}
+	return creds
+}
+
+func TestDownloadAllKeepsSuccessfulProviders(t *testing.T) {
+	withDownloadTestProviders(t)
+	creds := downloadTestCreds("download-ok-a", "download-broken", "download-ok-b")
+
+	result := DownloadAll(context.Background(), creds)
+
+	if len(result.Configs) != 2 {
+		t.Fatalf("expected 2 configs, got %d", len(result.Configs))
+	}
+	if result.Configs[0].Provider != "download-ok-a" || result.Configs[1].Provider != "download-ok-b" {
+		t.Errorf("expected configs in credential order, got %s, %s", result.Configs[0].Provider, result.Configs[1].Provider)
+	}
+	if len(result.Failed) != 1 || result.Failed[0].Provider != "download-broken" {
+		t.Fatalf("expected download-broken to fail, got %+v", result.Failed)
+	}
+	if got := result.Failed[0].Error(); got != "download-broken: error listing download-broken clusters: API unavailable" {
+		t.Errorf("unexpected error %q", got)
+	}
+	if _, ok := result.Listed[listingKey("download-broken", "")]; ok {
+		t.Error("expected the failed provider's listing to be absent, so nothing of it is pruned")
+	}
+	if !result.Listed[listingKey("download-ok-a", "")]["1"] || !result.Listed[listingKey("download-ok-b", "")]["1"] {
+		t.Errorf("expected the successful listings to be recorded, got %v", result.Listed)
+	}
+}
+
+func TestDownloadAllRecordsFailingPlugin(t *testing.T) {
+	failing, err := exec.LookPath("false")
+	if err != nil {
+		t.Skip("needs the false command")
+	}
+	withDownloadTestProviders(t, provider.NewPlugin("download-plugin", failing))
+	creds := append(downloadTestCreds("download-ok-a"), credentials.Credential{Provider: "download-plugin"})
+
+	result := DownloadAll(context.Background(), creds)
+
+	if len(result.Configs) != 1 || result.Configs[0].Provider != "download-ok-a" {
+		t.Errorf("expected the built-in provider's config, got %+v", result.Configs)
+	}
+	if len(result.Failed) != 1 || result.Failed[0].Provider != "download-plugin" {
+		t.Fatalf("expected the plugin to be recorded as failed, got %+v", result.Failed)
+	}
+	if !provider.IsPluginError(result.Failed[0]) {
+		t.Errorf("expected a plugin error, got %v", result.Failed[0].Err)
+	}
+}
+
+func TestDownloadAllCancelled(t *testing.T) {
+	withDownloadTestProviders(t)
+	creds := downloadTestCreds("download-blocked", "download-ok-a")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result := DownloadAll(ctx, creds)
+
+	if len(result.Failed) != 2 {
+		t.Fatalf("expected both providers to fail, got %+v", result.Failed)
+	}
+	for _, failure := range result.Failed {
+		if !errors.Is(failure, context.Canceled) {
+			t.Errorf("expected %s to fail with context.Canceled, got %v", failure.Provider, failure.Err)
+		}
+	}
+	if len(result.Configs) != 0 {
+		t.Errorf("expected no configs, got %d", len(result.Configs))
+	}
+}
+
+func TestListedAccounts(t *testing.T) {
+	cred := credentials.Credential{Provider: "Azure", Details: map[string]string{"SubscriptionIDs": "sub-a,sub-b"}}
+	clusters := []provider.Cluster{
+		{ID: "1", Details: map[string]string{"Account": "sub-a"}},
+		{ID: "2", Details: map[string]string{"Account": "sub-c"}},
+	}
+
+	got := listedAccounts(cred, clusters)
+	want := []string{"sub-a,sub-b", "sub-a", "sub-b", "sub-c"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("listedAccounts() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+package kubeconfig
+
+import (
+	"encoding/json"
+	"time"
+
+	"kubectm/pkg/credentials"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ExtensionName is the key of the ownership extension kubectm writes on the
+// contexts, clusters and users it manages.
+const ExtensionName = "kubectm"
+
+// Version is the kubectm version recorded in ownership extensions. The CLI
+// sets it from its build version.
+var Version = "development"
+
+// KubectmExtension marks a kubeconfig entry as managed by kubectm and records
+// where it came from. Entries without it were not written by kubectm and are
+// never modified or removed by it.
+type KubectmExtension struct {
+	Provider string `json:"provider"`
+	// Account is the profile, project or subscription the cluster was
+	// downloaded with, if the provider has one.
+	Account    string `json:"account,omitempty"`
+	ClusterID  string `json:"cluster-id"`
+	Region     string `json:"region,omitempty"`
+	LastSynced string `json:"last-synced"`
+	Version    string `json:"version"`
+}
+
+// GetObjectKind is required to implement the runtime.Object interface
+func (e *KubectmExtension) GetObjectKind() schema.ObjectKind {
+	return schema.EmptyObjectKind
+}
+
+// DeepCopyObject is required to implement the runtime.Object interface
+func (e *KubectmExtension) DeepCopyObject() runtime.Object {
+	copied := *e
+	return &copied
+}
+
+// newKubectmExtension returns the ownership extension for a downloaded
+// cluster, stamped with the current time and kubectm version.
+func newKubectmExtension(d DownloadedConfig) *KubectmExtension {
+	return &KubectmExtension{
+		Provider:   d.Provider,
+		Account:    d.Account,
+		ClusterID:  d.Cluster.ID,
+		Region:     d.Cluster.Region,
+		LastSynced: now().UTC().Format(time.RFC3339),
+		Version:    Version,
+	}
+}
+
+// ownership returns the kubectm extension from an entry's extensions, or nil
+// if the entry is not managed by kubectm. Extensions read back from a file
+// are decoded from their raw form.
+func ownership(extensions map[string]runtime.Object) *KubectmExtension {
+	switch ext := extensions[ExtensionName].(type) {
+	case *KubectmExtension:
+		return ext
+	case *runtime.Unknown:
+		var decoded KubectmExtension
+		if err := json.Unmarshal(ext.Raw, &decoded); err != nil || decoded.Provider == "" {
+			return nil
+		}
+		return &decoded
+	}
+	return nil
+}
+
+// setOwnership adds or replaces the kubectm extension in extensions,
+// preserving any other extensions, and returns the updated map.
+func setOwnership(extensions map[string]runtime.Object, ext *KubectmExtension) map[string]runtime.Object {
+	if extensions == nil {
+		extensions = map[string]runtime.Object{}
+	}
+	extensions[ExtensionName] = ext.DeepCopyObject()
+	return extensions
+}
+
+// credentialAccount returns the profile, project or subscription a credential
+// belongs to, or "" if it has none.
+func credentialAccount(cred credentials.Credential) string {
+	for _, key := range []string{"Profile", "ProjectID", "SubscriptionIDs"} {
+		if account := cred.Details[key]; account != "" {
+			return account
+		}
+	}
+	return ""
+}
@@ -0,0 +1,178 @@
+package kubeconfig
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kubectm/pkg/credentials"
+	"kubectm/pkg/provider"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestOwnershipSurvivesRoundTrip(t *testing.T) {
+	setNow(t, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	d := DownloadedConfig{
+		Provider: "AWS",
+		Account:  "staging",
+		Cluster:  provider.Cluster{ID: "us-east-1/prod", Region: "us-east-1"},
+	}
+
+	config := api.NewConfig()
+	config.Clusters["prod"] = &api.Cluster{Server: testServerURL}
+	config.Clusters["prod"].Extensions = setOwnership(nil, newKubectmExtension(d))
+
+	content, err := clientcmd.Write(*config)
+	if err != nil {
+		t.Fatalf("failed to serialize kubeconfig: %v", err)
+	}
+	loaded, err := clientcmd.Load(content)
+	if err != nil {
+		t.Fatalf("failed to load kubeconfig: %v", err)
+	}
+
+	ext := ownership(loaded.Clusters["prod"].Extensions)
+	if ext == nil {
+		t.Fatalf("expected ownership extension after round trip, got:\n%s", content)
+	}
+	want := KubectmExtension{Provider: "AWS", Account: "staging", ClusterID: "us-east-1/prod", Region: "us-east-1", LastSynced: "2026-03-01T12:00:00Z", Version: Version}
+	if *ext != want {
+		t.Errorf("ownership() = %+v, want %+v", *ext, want)
+	}
+
+	if ownership(nil) != nil {
+		t.Error("expected no ownership for an entry without extensions")
+	}
+}
+
+func TestMergeStampsOnlyWrittenEntries(t *testing.T) {
+	dest := api.NewConfig()
+	// A hand-written user that happens to share the downloaded user's name.
+	dest.AuthInfos[testUserName] = &api.AuthInfo{Token: "mine"}
+
+	d := DownloadedConfig{
+		Provider: "Linode",
+		Cluster:  provider.Cluster{ID: "1", ContextName: "lke-prod"},
+		Config:   createTestConfig(testClusterNameMerge, testServerURL, testCAData, testUserName, testToken, testContextName, nil),
+	}
+	state := &kubeconfigState{Contexts: map[string]*ManagedContext{}}
+	if err := mergeDownloadedConfig(dest, d, testIconPath, state, nil, MergeOptions{}, nil); err != nil {
+		t.Fatalf("mergeDownloadedConfig() error = %v", err)
+	}
+
+	context := dest.Contexts["lke-prod"]
+	if ownership(context.Extensions) == nil {
+		t.Error("expected context to carry the kubectm extension")
+	}
+	if context.Extensions["aptakube"] == nil {
+		t.Error("expected the Aptakube extension to be preserved")
+	}
+	if ownership(dest.Clusters[testClusterNameMerge].Extensions) == nil {
+		t.Error("expected added cluster to carry the kubectm extension")
+	}
+	if ownership(dest.AuthInfos[testUserName].Extensions) != nil {
+		t.Error("expected hand-written user to stay unowned")
+	}
+	if ownership(d.Config.Contexts[testContextName].Extensions) != nil {
+		t.Error("expected the downloaded config's context not to be modified")
+	}
+}
+
+func TestPruneAdoptsContextsFromExtension(t *testing.T) {
+	setNow(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	config, _ := pruneTestConfig()
+	config.Contexts["lke-prod"].Extensions = setOwnership(nil, &KubectmExtension{Provider: "Linode", ClusterID: "1"})
+
+	// With no state, only the context carrying the extension is considered.
+	state := &kubeconfigState{Contexts: map[string]*ManagedContext{}}
+	pruneStaleContexts(config, state, map[string]map[string]bool{listingKey("Linode", ""): {}}, nil, PruneOptions{Policy: PruneAuto}, false, nil)
+
+	if _, ok := config.Contexts["lke-prod"]; ok {
+		t.Error("expected owned context to be pruned")
+	}
+	if _, ok := config.Contexts["lke-dev"]; !ok {
+		t.Error("expected context without the extension to be kept")
+	}
+}
+
+// TestPruneAdoptsAccountFromExtension checks that the account of the
+// extension is kept, so a listing of another account does not prune it.
+func TestPruneAdoptsAccountFromExtension(t *testing.T) {
+	setNow(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	config, state := pruneTestConfig()
+	config.Contexts["lke-prod"].Extensions = setOwnership(nil, &KubectmExtension{Provider: "Linode", Account: "work", ClusterID: "1"})
+	config.Contexts["lke-dev"].Extensions = setOwnership(nil, &KubectmExtension{Provider: "Linode", Account: "work", ClusterID: "2"})
+	// lke-dev is recorded without an account, as before accounts were
+	// recorded; lke-prod is only known from its extension.
+	delete(state.Contexts, "lke-prod")
+
+	personal := map[string]map[string]bool{listingKey("Linode", "personal"): {}}
+	pruneStaleContexts(config, state, personal, nil, PruneOptions{Policy: PruneAuto}, false, nil)
+
+	for _, name := range []string{"lke-prod", "lke-dev"} {
+		if _, ok := config.Contexts[name]; !ok {
+			t.Errorf("expected %s to be kept when another account was listed", name)
+		}
+		if got := state.Contexts[name]; got == nil || got.Account != "work" {
+			t.Errorf("expected %s to be tracked for account work, got %+v", name, got)
+		}
+	}
+
+	work := map[string]map[string]bool{listingKey("Linode", "work"): {}}
+	pruneStaleContexts(config, state, work, nil, PruneOptions{Policy: PruneAuto}, false, nil)
+	if len(state.Contexts) != 0 {
+		t.Errorf("expected both contexts to be pruned once their account was listed, got %+v", state.Contexts)
+	}
+}
+
+func TestClusterAccount(t *testing.T) {
+	tests := []struct {
+		name    string
+		cred    credentials.Credential
+		cluster provider.Cluster
+		want    string
+	}{
+		{name: "profile", cred: credentials.Credential{Details: map[string]string{"Profile": "staging"}}, want: "staging"},
+		{name: "project", cred: credentials.Credential{Details: map[string]string{"ProjectID": "my-project"}}, want: "my-project"},
+		{name: "cluster detail wins", cred: credentials.Credential{Details: map[string]string{"SubscriptionIDs": "a,b"}}, cluster: provider.Cluster{Details: map[string]string{"Account": "b"}}, want: "b"},
+		{name: "none", cred: credentials.Credential{Details: map[string]string{"AccessToken": "secret"}}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clusterAccount(tt.cred, tt.cluster); got != tt.want {
+				t.Errorf("clusterAccount() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeConfigsWritesOwnership(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	d := DownloadedConfig{
+		Provider: "Linode",
+		Account:  "default",
+		Cluster:  provider.Cluster{ID: "1", ContextName: "lke-prod"},
+		Config:   createTestConfig(testClusterNameMerge, testServerURL, testCAData, testUserName, testToken, testContextName, nil),
+	}
+	if _, err := MergeConfigs(&DownloadResult{Configs: []DownloadedConfig{d}}, MergeOptions{}); err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+
+	merged, err := clientcmd.LoadFromFile(filepath.Join(home, ".kube", "config"))
+	if err != nil {
+		t.Fatalf("failed to load merged config: %v", err)
+	}
+	for kind, ext := range map[string]*KubectmExtension{
+		"context": ownership(merged.Contexts["lke-prod"].Extensions),
+		"cluster": ownership(merged.Clusters[testClusterNameMerge].Extensions),
+		"user":    ownership(merged.AuthInfos[testUserName].Extensions),
+	} {
+		if ext == nil || ext.Provider != "Linode" || ext.ClusterID != "1" || ext.Account != "default" {
+			t.Errorf("expected %s ownership for Linode cluster 1, got %+v", kind, ext)
+		}
+	}
+}
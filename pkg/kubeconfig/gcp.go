@@ -0,0 +1,376 @@
+package kubeconfig
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"kubectm/pkg/credentials"
+	"kubectm/pkg/provider"
+	"kubectm/pkg/utils"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	gcpDownloadTimeout    = 30 * time.Second
+	gcpDefaultTokenURI    = "https://oauth2.googleapis.com/token"
+	gcpCloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+// gkeAPIBaseURL is the base URL for the GKE container API v1. It is a variable
+// so tests can point it at an httptest server.
+// API Documentation: https://cloud.google.com/kubernetes-engine/docs/reference/rest
+// Endpoints used:
+//   - GET /projects/{project}/locations/-/clusters - List clusters in all locations
+var gkeAPIBaseURL = "https://container.googleapis.com/v1"
+
+// GKECluster is the subset of the GKE Cluster resource kubectm needs.
+type GKECluster struct {
+	Name     string `json:"name"`
+	Location string `json:"location"`
+	Endpoint string `json:"endpoint"`
+	Status   string `json:"status"`
+	// CurrentMasterVersion is the Kubernetes version of the control plane.
+	CurrentMasterVersion string            `json:"currentMasterVersion"`
+	ResourceLabels       map[string]string `json:"resourceLabels"`
+	MasterAuth           struct {
+		ClusterCACertificate string `json:"clusterCaCertificate"`
+	} `json:"masterAuth"`
+}
+
+// GKEClustersResponse is the response body of the clusters.list call.
+type GKEClustersResponse struct {
+	Clusters     []GKECluster `json:"clusters"`
+	MissingZones []string     `json:"missingZones"`
+}
+
+// gcpProvider lists GKE clusters in the credential's project and generates
+// kubeconfigs that authenticate with gke-gcloud-auth-plugin.
+type gcpProvider struct {
+	tokens tokenCache
+}
+
+func init() {
+	provider.Register(&gcpProvider{})
+}
+
+// Name returns the provider name used in credentials and selections.
+func (p *gcpProvider) Name() string {
+	return "GCP"
+}
+
+// Discover looks for a service account key or gcloud application default
+// credentials and the active project.
+func (p *gcpProvider) Discover(ctx context.Context) (*credentials.Credential, error) {
+	return credentials.Retrieve("GCP")
+}
+
+// ListClusters lists the GKE clusters in every location of the credential's
+// project.
+func (p *gcpProvider) ListClusters(ctx context.Context, cred credentials.Credential) ([]provider.Cluster, error) {
+	ctx, cancel := context.WithTimeout(ctx, gcpDownloadTimeout)
+	defer cancel()
+
+	project := cred.Details["ProjectID"]
+	if project == "" {
+		return nil, fmt.Errorf("GCP project ID is missing")
+	}
+
+	token, err := p.tokens.get(cred, func() (string, error) { return getGCPAccessToken(ctx, cred) })
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain GCP access token: %v", err)
+	}
+
+	clusters, err := listGKEClusters(ctx, token, project)
+	if err != nil && !provider.IsPartialList(err) {
+		return nil, fmt.Errorf("failed to list GKE clusters: %v", err)
+	}
+
+	utils.InfoLogger.Printf("%s Found %d GKE cluster(s) in project %s", utils.Iso8601Time(), len(clusters), project)
+
+	result := make([]provider.Cluster, 0, len(clusters))
+	for _, cluster := range clusters {
+		result = append(result, provider.Cluster{
+			ID:          fmt.Sprintf("%s/%s/%s", project, cluster.Location, cluster.Name),
+			Name:        cluster.Name,
+			Region:      cluster.Location,
+			ContextName: fmt.Sprintf("%s@%s", cluster.Name, cluster.Location),
+			Version:     cluster.CurrentMasterVersion,
+			Status:      cluster.Status,
+			Endpoint:    "https://" + cluster.Endpoint,
+			Tags:        cluster.ResourceLabels,
+			Details: map[string]string{
+				"Endpoint": cluster.Endpoint,
+				"CAData":   cluster.MasterAuth.ClusterCACertificate,
+			},
+		})
+	}
+	// err is nil or a PartialListError for unreachable zones.
+	return result, err
+}
+
+// Kubeconfig generates the kubeconfig for a GKE cluster from the endpoint and
+// CA certificate reported when it was listed.
+func (p *gcpProvider) Kubeconfig(ctx context.Context, cred credentials.Credential, cluster provider.Cluster) (*api.Config, error) {
+	gke := GKECluster{
+		Name:     cluster.Name,
+		Location: cluster.Region,
+		Endpoint: cluster.Details["Endpoint"],
+	}
+	gke.MasterAuth.ClusterCACertificate = cluster.Details["CAData"]
+
+	return processGKECluster(gke)
+}
+
+// getGCPAccessToken exchanges the discovered credentials for an OAuth2 access
+// token scoped to the Cloud Platform. Service account keys use a signed JWT
+// bearer assertion; gcloud application default credentials use their refresh
+// token.
+func getGCPAccessToken(ctx context.Context, cred credentials.Credential) (string, error) {
+	tokenURI := cred.Details["TokenURI"]
+	if tokenURI == "" {
+		tokenURI = gcpDefaultTokenURI
+	}
+
+	form := url.Values{}
+	switch cred.Details["Type"] {
+	case "service_account":
+		assertion, err := signGCPJWT(cred.Details["ClientEmail"], cred.Details["PrivateKey"], tokenURI, time.Now())
+		if err != nil {
+			return "", err
+		}
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", assertion)
+	case "authorized_user":
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", cred.Details["ClientID"])
+		form.Set("client_secret", cred.Details["ClientSecret"])
+		form.Set("refresh_token", cred.Details["RefreshToken"])
+	default:
+		return "", fmt.Errorf("unsupported GCP credentials type %q", cred.Details["Type"])
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("token request failed, status: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var tokenResponse struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return "", err
+	}
+	if tokenResponse.AccessToken == "" {
+		return "", fmt.Errorf("token response did not contain an access token")
+	}
+
+	return tokenResponse.AccessToken, nil
+}
+
+// signGCPJWT builds the RS256-signed JWT assertion a service account presents
+// to the token endpoint.
+func signGCPJWT(clientEmail, privateKeyPEM, audience string, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return "", fmt.Errorf("GCP service account private key is not PEM encoded")
+	}
+
+	var key *rsa.PrivateKey
+	if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return "", fmt.Errorf("GCP service account private key is not an RSA key")
+		}
+		key = rsaKey
+	} else if rsaKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		key = rsaKey
+	} else {
+		return "", fmt.Errorf("failed to parse GCP service account private key: %v", err)
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   clientEmail,
+		"scope": gcpCloudPlatformScope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GCP JWT: %v", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// listGKEClusters lists the clusters in every location of the project. The
+// "-" location wildcard makes this a single call; zones that could not be
+// reached are reported by the API and logged here.
+func listGKEClusters(ctx context.Context, token, project string) ([]GKECluster, error) {
+	if !isValidGKEIdentifier(project) {
+		return nil, fmt.Errorf("GCP project %q has an unexpected format", project)
+	}
+
+	reqURL := fmt.Sprintf("%s/projects/%s/locations/-/clusters", gkeAPIBaseURL, project)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to list clusters, status: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var clustersResponse GKEClustersResponse
+	if err := json.NewDecoder(resp.Body).Decode(&clustersResponse); err != nil {
+		return nil, err
+	}
+
+	if len(clustersResponse.MissingZones) > 0 {
+		utils.WarnLogger.Printf("%s GKE could not reach zones %v; clusters there were not listed", utils.Iso8601Time(), clustersResponse.MissingZones)
+		return clustersResponse.Clusters, &provider.PartialListError{Failures: clustersResponse.MissingZones}
+	}
+
+	return clustersResponse.Clusters, nil
+}
+
+// processGKECluster validates a GKE cluster and generates a kubeconfig for it.
+func processGKECluster(cluster GKECluster) (*api.Config, error) {
+	// Every value interpolated into the template comes from the GKE API, so
+	// it is validated first (text/template performs no escaping).
+	if !isValidGKEIdentifier(cluster.Name) {
+		return nil, fmt.Errorf("cluster %q has an unexpected name format", cluster.Name)
+	}
+	if !isValidGKEIdentifier(cluster.Location) {
+		return nil, fmt.Errorf("cluster %s is in an unexpected location format %q", cluster.Name, cluster.Location)
+	}
+	if !gkeEndpointPattern.MatchString(cluster.Endpoint) {
+		return nil, fmt.Errorf("cluster %s has an unexpected endpoint %q", cluster.Name, cluster.Endpoint)
+	}
+	if _, err := base64.StdEncoding.DecodeString(cluster.MasterAuth.ClusterCACertificate); err != nil || cluster.MasterAuth.ClusterCACertificate == "" {
+		return nil, fmt.Errorf("cluster %s has invalid certificate authority data", cluster.Name)
+	}
+
+	kubeconfigContent := generateGKEKubeconfig(
+		cluster.Name,
+		cluster.Location,
+		cluster.Endpoint,
+		cluster.MasterAuth.ClusterCACertificate,
+	)
+
+	config, err := clientcmd.Load([]byte(kubeconfigContent))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse generated kubeconfig for cluster %s: %v", cluster.Name, err)
+	}
+	return config, nil
+}
+
+// gkeIdentifierPattern matches GCP project IDs, GKE cluster names and
+// locations, which are limited to lowercase letters, digits and hyphens.
+var gkeIdentifierPattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// gkeEndpointPattern matches the IP address or hostname GKE reports as the
+// cluster endpoint.
+var gkeEndpointPattern = regexp.MustCompile(`^[A-Za-z0-9.:-]+$`)
+
+// isValidGKEIdentifier reports whether s is a safe GCP project, GKE cluster
+// name or location.
+func isValidGKEIdentifier(s string) bool {
+	return s != "" && gkeIdentifierPattern.MatchString(s)
+}
+
+// gkeKubeconfigTemplate is the template for generating GKE kubeconfig files.
+var gkeKubeconfigTemplate = template.Must(template.New("kubeconfig").Parse(`apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://{{.Endpoint}}
+    certificate-authority-data: {{.CAData}}
+  name: {{.ContextName}}
+contexts:
+- context:
+    cluster: {{.ContextName}}
+    user: {{.ContextName}}
+  name: {{.ContextName}}
+current-context: {{.ContextName}}
+users:
+- name: {{.ContextName}}
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      command: gke-gcloud-auth-plugin
+      installHint: Install gke-gcloud-auth-plugin for use with kubectl by following
+        https://cloud.google.com/kubernetes-engine/docs/how-to/cluster-access-for-kubectl#install_plugin
+      provideClusterInfo: true
+`))
+
+// generateGKEKubeconfig generates a kubeconfig YAML string for a GKE cluster
+// that uses the gke-gcloud-auth-plugin exec plugin for authentication.
+func generateGKEKubeconfig(clusterName, location, endpoint, caData string) string {
+	data := struct {
+		Endpoint    string
+		CAData      string
+		ContextName string
+	}{
+		Endpoint:    endpoint,
+		CAData:      caData,
+		ContextName: fmt.Sprintf("%s@%s", clusterName, location),
+	}
+
+	var buf bytes.Buffer
+	if err := gkeKubeconfigTemplate.Execute(&buf, data); err != nil {
+		utils.ErrorLogger.Printf("%s Error executing GKE kubeconfig template: %v", utils.Iso8601Time(), err)
+		return ""
+	}
+
+	return buf.String()
+}
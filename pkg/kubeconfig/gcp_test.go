@@ -0,0 +1,285 @@
+package kubeconfig
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"kubectm/pkg/credentials"
+	"kubectm/pkg/provider"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const testGKEAccessToken = "ya29.test-access-token"
+
+// testGCPPrivateKeyPEM generates a throwaway RSA key in the PKCS#8 PEM form
+// used by service account key files.
+func testGCPPrivateKeyPEM(t *testing.T) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal RSA key: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+// newGKETestServer serves both the OAuth2 token endpoint and the GKE clusters
+// list endpoint.
+func newGKETestServer(t *testing.T, clusters GKEClustersResponse) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			if err := r.ParseForm(); err != nil {
+				t.Errorf("failed to parse token form: %v", err)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"access_token": testGKEAccessToken})
+		case strings.HasSuffix(r.URL.Path, "/locations/-/clusters"):
+			if r.Header.Get("Authorization") != "Bearer "+testGKEAccessToken {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(clusters)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	origBaseURL := gkeAPIBaseURL
+	gkeAPIBaseURL = server.URL
+	t.Cleanup(func() { gkeAPIBaseURL = origBaseURL })
+
+	return server
+}
+
+func testGKECluster(name, location string) GKECluster {
+	cluster := GKECluster{
+		Name:     name,
+		Location: location,
+		Endpoint: "34.1.2.3",
+		Status:   "RUNNING",
+	}
+	cluster.MasterAuth.ClusterCACertificate = "dGVzdC1jYS1kYXRh"
+	return cluster
+}
+
+func TestGetGCPAccessToken(t *testing.T) {
+	server := newGKETestServer(t, GKEClustersResponse{})
+	privateKey := testGCPPrivateKeyPEM(t)
+
+	tests := []struct {
+		name      string
+		details   map[string]string
+		expectErr bool
+	}{
+		{
+			name: "service account",
+			details: map[string]string{
+				"Type":        "service_account",
+				"ClientEmail": "kubectm@project.iam.gserviceaccount.com",
+				"PrivateKey":  privateKey,
+				"TokenURI":    server.URL + "/token",
+			},
+		},
+		{
+			name: "authorized user",
+			details: map[string]string{
+				"Type":         "authorized_user",
+				"ClientID":     "client-id",
+				"ClientSecret": "client-secret",
+				"RefreshToken": "refresh-token",
+				"TokenURI":     server.URL + "/token",
+			},
+		},
+		{
+			name: "invalid private key",
+			details: map[string]string{
+				"Type":        "service_account",
+				"ClientEmail": "kubectm@project.iam.gserviceaccount.com",
+				"PrivateKey":  "not a key",
+				"TokenURI":    server.URL + "/token",
+			},
+			expectErr: true,
+		},
+		{
+			name:      "unsupported type",
+			details:   map[string]string{"Type": "external_account"},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := getGCPAccessToken(context.Background(), credentials.Credential{Provider: "GCP", Details: tt.details})
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if token != testGKEAccessToken {
+				t.Errorf("expected token %q, got %q", testGKEAccessToken, token)
+			}
+		})
+	}
+}
+
+func TestSignGCPJWT(t *testing.T) {
+	jwt, err := signGCPJWT("sa@project.iam.gserviceaccount.com", testGCPPrivateKeyPEM(t), "https://oauth2.googleapis.com/token", time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parts := strings.Split(jwt, "."); len(parts) != 3 {
+		t.Fatalf("expected a three-part JWT, got %d parts", len(parts))
+	}
+}
+
+func TestListGKEClusters(t *testing.T) {
+	newGKETestServer(t, GKEClustersResponse{
+		Clusters: []GKECluster{
+			testGKECluster("prod-gke", "us-central1"),
+			testGKECluster("dev-gke", "europe-west1-b"),
+		},
+		MissingZones: []string{"asia-east1-a"},
+	})
+
+	// Unreachable zones still return the clusters that were listed, but mark
+	// the listing as incomplete.
+	clusters, err := listGKEClusters(context.Background(), testGKEAccessToken, "my-project")
+	if !provider.IsPartialList(err) {
+		t.Fatalf("expected a partial listing error for missing zones, got %v", err)
+	}
+	if len(clusters) != 2 {
+		t.Fatalf("expected 2 clusters, got %d", len(clusters))
+	}
+	if clusters[1].Location != "europe-west1-b" {
+		t.Errorf("expected location europe-west1-b, got %s", clusters[1].Location)
+	}
+
+	if _, err := listGKEClusters(context.Background(), "wrong-token", "my-project"); err == nil {
+		t.Error("expected error for unauthorized request, got nil")
+	}
+	if _, err := listGKEClusters(context.Background(), testGKEAccessToken, "../evil"); err == nil {
+		t.Error("expected error for invalid project, got nil")
+	}
+}
+
+func TestGenerateGKEKubeconfig(t *testing.T) {
+	result := generateGKEKubeconfig("prod-gke", "us-central1", "34.1.2.3", "dGVzdC1jYS1kYXRh")
+
+	checks := []string{
+		"server: https://34.1.2.3",
+		"certificate-authority-data: dGVzdC1jYS1kYXRh",
+		"name: prod-gke@us-central1",
+		"current-context: prod-gke@us-central1",
+		"command: gke-gcloud-auth-plugin",
+		"provideClusterInfo: true",
+		"apiVersion: client.authentication.k8s.io/v1beta1",
+	}
+	for _, check := range checks {
+		if !strings.Contains(result, check) {
+			t.Errorf("generated kubeconfig missing expected content: %q\nGot:\n%s", check, result)
+		}
+	}
+}
+
+func TestProcessGKEClusterRejectsUnsafeValues(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	tests := []struct {
+		name    string
+		cluster GKECluster
+	}{
+		{name: "name injection", cluster: testGKECluster("evil\n    command: rm", "us-central1")},
+		{name: "location traversal", cluster: testGKECluster("prod", "../../etc")},
+		{name: "endpoint injection", cluster: func() GKECluster {
+			c := testGKECluster("prod", "us-central1")
+			c.Endpoint = "1.2.3.4\n  evil: true"
+			return c
+		}()},
+		{name: "invalid CA", cluster: func() GKECluster {
+			c := testGKECluster("prod", "us-central1")
+			c.MasterAuth.ClusterCACertificate = "not base64!"
+			return c
+		}()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := processGKECluster(tt.cluster); err == nil {
+				t.Fatal("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestDownloadGCPKubeConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	server := newGKETestServer(t, GKEClustersResponse{
+		Clusters: []GKECluster{testGKECluster("prod-gke", "us-central1")},
+	})
+
+	cred := credentials.Credential{
+		Provider: "GCP",
+		Details: map[string]string{
+			"Type":         "authorized_user",
+			"ClientID":     "client-id",
+			"ClientSecret": "client-secret",
+			"RefreshToken": "refresh-token",
+			"TokenURI":     server.URL + "/token",
+			"ProjectID":    "my-project",
+		},
+	}
+
+	result := DownloadAll(context.Background(), []credentials.Credential{cred})
+	if len(result.Failed) != 0 {
+		t.Fatalf("unexpected failures: %v", result.Failed)
+	}
+	if len(result.Configs) != 1 {
+		t.Fatalf("expected 1 kubeconfig, got %d", len(result.Configs))
+	}
+	if got := result.Configs[0].Cluster.ContextName; got != "prod-gke@us-central1" {
+		t.Errorf("expected context prod-gke@us-central1, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".kube")); !os.IsNotExist(err) {
+		t.Error("expected downloads to stay in memory")
+	}
+
+	content, err := clientcmd.Write(*result.Configs[0].Config)
+	if err != nil {
+		t.Fatalf("failed to serialize kubeconfig: %v", err)
+	}
+	if !strings.Contains(string(content), "command: gke-gcloud-auth-plugin") {
+		t.Errorf("kubeconfig missing gke-gcloud-auth-plugin exec block:\n%s", content)
+	}
+}
+
+func TestDownloadGCPKubeConfigMissingProject(t *testing.T) {
+	_, err := (&gcpProvider{}).ListClusters(context.Background(), credentials.Credential{Provider: "GCP", Details: map[string]string{}})
+	if err == nil || !strings.Contains(err.Error(), "project ID is missing") {
+		t.Fatalf("expected missing project error, got %v", err)
+	}
+}
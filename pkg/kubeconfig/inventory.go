@@ -0,0 +1,102 @@
+package kubeconfig
+
+import (
+	"os"
+	"path/filepath"
+
+	"kubectm/pkg/credentials"
+)
+
+// InventoryEntry is a cluster as `kubectm list` reports it.
+type InventoryEntry struct {
+	Provider string `json:"provider" yaml:"provider"`
+	Account  string `json:"account,omitempty" yaml:"account,omitempty"`
+	ID       string `json:"id" yaml:"id"`
+	Name     string `json:"name" yaml:"name"`
+	Region   string `json:"region,omitempty" yaml:"region,omitempty"`
+	Version  string `json:"version,omitempty" yaml:"version,omitempty"`
+	Status   string `json:"status,omitempty" yaml:"status,omitempty"`
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	// Context is the context the cluster was synced to, if it is in the
+	// target kubeconfig or one of its split files.
+	Context      string `json:"context,omitempty" yaml:"context,omitempty"`
+	InKubeconfig bool   `json:"inKubeconfig" yaml:"inKubeconfig"`
+}
+
+// Inventory lists the clusters of the specified providers and looks each one
+// up in the target kubeconfig and its kubectm.d split files. No kubeconfig is
+// downloaded and nothing is written.
+func Inventory(creds []credentials.Credential) ([]InventoryEntry, error) {
+	listed, _, err := ListClusters(creds)
+	if err != nil {
+		return nil, err
+	}
+	synced, err := syncedClusters()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]InventoryEntry, 0, len(listed))
+	for _, c := range listed {
+		context := synced[c.Provider+"/"+c.Cluster.ID]
+		entries = append(entries, InventoryEntry{
+			Provider:     c.Provider,
+			Account:      c.Account,
+			ID:           c.Cluster.ID,
+			Name:         c.Cluster.Name,
+			Region:       c.Cluster.Region,
+			Version:      c.Cluster.Version,
+			Status:       c.Cluster.Status,
+			Endpoint:     c.Cluster.Endpoint,
+			Context:      context,
+			InKubeconfig: context != "",
+		})
+	}
+	return entries, nil
+}
+
+// syncedClusters returns the context each synced cluster has in the target
+// kubeconfig or its split files, keyed by provider and cluster ID. A context
+// counts if the state file records it or it carries the ownership extension,
+// and only while it is still in the file.
+func syncedClusters() (map[string]string, error) {
+	target, err := targetKubeconfig()
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadSyncState()
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{target}
+	splitDir := filepath.Join(filepath.Dir(target), splitDirName)
+	for _, path := range sortedKeys(state.Kubeconfigs) {
+		if filepath.Dir(path) == splitDir {
+			paths = append(paths, path)
+		}
+	}
+
+	synced := map[string]string{}
+	for _, path := range paths {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		config, err := loadKubeconfig(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range sortedKeys(config.Contexts) {
+			var key string
+			if managed := state.forKubeconfig(path).Contexts[name]; managed != nil {
+				key = managed.Provider + "/" + managed.ClusterID
+			} else if ext := ownership(config.Contexts[name].Extensions); ext != nil {
+				key = ext.Provider + "/" + ext.ClusterID
+			}
+			if _, seen := synced[key]; key != "" && !seen {
+				synced[key] = name
+			}
+		}
+	}
+	return synced, nil
+}
@@ -0,0 +1,76 @@
+package kubeconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kubectm/pkg/credentials"
+)
+
+func TestInventory(t *testing.T) {
+	kubeDir := setupBackupTestHome(t)
+	server := newGKETestServer(t, GKEClustersResponse{
+		Clusters: []GKECluster{testGKECluster("prod-gke", "us-central1"), testGKECluster("dev-gke", "europe-west1")},
+	})
+	cred := credentials.Credential{
+		Provider: "GCP",
+		Details: map[string]string{
+			"Type":         "authorized_user",
+			"ClientID":     "client-id",
+			"ClientSecret": "client-secret",
+			"RefreshToken": "refresh-token",
+			"TokenURI":     server.URL + "/token",
+			"ProjectID":    "my-project",
+		},
+	}
+
+	synced := splitDownload("GCP", "my-project/us-central1/prod-gke", "prod")
+	if _, err := MergeConfigs(&DownloadResult{Configs: []DownloadedConfig{synced}}, MergeOptions{}); err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+	before, err := os.ReadFile(filepath.Join(kubeDir, "config"))
+	if err != nil {
+		t.Fatalf("failed to read kubeconfig: %v", err)
+	}
+
+	entries, err := Inventory([]credentials.Credential{cred})
+	if err != nil {
+		t.Fatalf("Inventory() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 clusters, got %+v", entries)
+	}
+	prod, dev := entries[0], entries[1]
+	if prod.Name != "prod-gke" || !prod.InKubeconfig || prod.Context != "prod" {
+		t.Errorf("expected prod-gke in the kubeconfig as prod, got %+v", prod)
+	}
+	if prod.Status != "RUNNING" || prod.Endpoint != "https://34.1.2.3" || prod.Region != "us-central1" {
+		t.Errorf("expected the listed status, endpoint and region, got %+v", prod)
+	}
+	if dev.Name != "dev-gke" || dev.InKubeconfig || dev.Context != "" {
+		t.Errorf("expected dev-gke not to be in the kubeconfig, got %+v", dev)
+	}
+
+	after, err := os.ReadFile(filepath.Join(kubeDir, "config"))
+	if err != nil || string(after) != string(before) {
+		t.Error("expected the kubeconfig to be left alone")
+	}
+}
+
+func TestAKSClusterStatusAndEndpoint(t *testing.T) {
+	cluster := testAKSCluster("aks-prod", "rg-production", false)
+	cluster.Properties.ProvisioningState = "Succeeded"
+	cluster.Properties.PrivateFQDN = "aks-prod.privatelink.eastus.azmk8s.io"
+	if cluster.status() != "Succeeded" || cluster.endpoint() != "https://aks-prod.privatelink.eastus.azmk8s.io:443" {
+		t.Errorf("got status %q, endpoint %q", cluster.status(), cluster.endpoint())
+	}
+
+	cluster.Properties.FQDN = "aks-prod.hcp.eastus.azmk8s.io"
+	cluster.Properties.PowerState = &struct {
+		Code string `json:"code"`
+	}{Code: "Stopped"}
+	if cluster.status() != "Stopped" || cluster.endpoint() != "https://aks-prod.hcp.eastus.azmk8s.io:443" {
+		t.Errorf("got status %q, endpoint %q", cluster.status(), cluster.endpoint())
+	}
+}
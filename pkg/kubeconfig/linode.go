@@ -1,29 +1,36 @@
 package kubeconfig
 
 import (
+    "context"
     "encoding/base64"
     "encoding/json"
     "fmt"
     "io"
     "net/http"
-    "os"
-    "path/filepath"
+    "strconv"
     "strings"
-    "github.com/fatih/color"
     "kubectm/pkg/credentials"
-    "kubectm/pkg/utils"  // Import the utils package
+    "kubectm/pkg/provider"
+    "kubectm/pkg/utils"
+    "k8s.io/client-go/tools/clientcmd"
+    "k8s.io/client-go/tools/clientcmd/api"
 )
 
 // linodeAPIBaseURL is the base URL for the Linode API v4.
 // API Documentation: https://techdocs.akamai.com/linode-api/reference/api
 // LKE endpoints used:
 //   - GET /lke/clusters - List all LKE clusters
+//   - GET /lke/clusters/{clusterId}/api-endpoints - List a cluster's API server endpoints
 //   - GET /lke/clusters/{clusterId}/kubeconfig - Get cluster kubeconfig (base64 encoded)
 const linodeAPIBaseURL = "https://api.linode.com/v4"
 
 type LinodeCluster struct {
-    ID    int    `json:"id"`
-    Label string `json:"label"`
+    ID         int      `json:"id"`
+    Label      string   `json:"label"`
+    Region     string   `json:"region"`
+    K8sVersion string   `json:"k8s_version"`
+    Status     string   `json:"status"`
+    Tags       []string `json:"tags"`
 }
 
 type LinodeClustersResponse struct {
@@ -33,44 +40,112 @@ type LinodeClustersResponse struct {
     Results int             `json:"results"`
 }
 
+type LinodeAPIEndpointsResponse struct {
+    Data []struct {
+        Endpoint string `json:"endpoint"`
+    } `json:"data"`
+}
+
 type KubeconfigResponse struct {
     Kubeconfig string `json:"kubeconfig"`
 }
 
-// downloadLinodeKubeConfig downloads the Linode cluster configuration.
-// It takes a single Credential object as an argument which contains the
-// access token and provider information.
-// Returns an error if the download or saving process fails.
-func downloadLinodeKubeConfig(cred credentials.Credential) error {
+// linodeProvider lists LKE clusters and downloads their kubeconfigs through
+// the Linode API v4.
+type linodeProvider struct{}
+
+func init() {
+    provider.Register(linodeProvider{})
+}
+
+// Name returns the provider name used in credentials and selections.
+func (linodeProvider) Name() string {
+    return "Linode"
+}
+
+// Discover looks for a Linode access token in the environment or the
+// linode-cli config file.
+func (linodeProvider) Discover(ctx context.Context) (*credentials.Credential, error) {
+    return credentials.Retrieve("Linode")
+}
+
+// ListClusters lists the LKE clusters the credential's access token can see.
+func (linodeProvider) ListClusters(ctx context.Context, cred credentials.Credential) ([]provider.Cluster, error) {
     // Get the access token from the credential details
     token := cred.Details["AccessToken"]
     if token == "" {
-        return fmt.Errorf("Linode access token is missing")
+        return nil, fmt.Errorf("Linode access token is missing")
     }
 
     // Retrieve the list of Linode clusters
     clusters, err := getLinodeClusters(token)
     if err != nil {
-        return fmt.Errorf("failed to retrieve Linode clusters: %v", err)
+        return nil, fmt.Errorf("failed to retrieve Linode clusters: %v", err)
     }
 
-    // Loop through each cluster and download the kubeconfig
-    // If the download or saving process fails for any cluster, stop
-    // the loop and return an error.
-    for _, cluster := range clusters { 
-        utils.ActionLogger.Printf("%s Downloading kubeconfig for cluster: %s", utils.Iso8601Time(), color.New(color.Bold).Sprint(cluster.Label))
-        kubeconfig, err := getLinodeKubeconfig(token, cluster.ID)
+    result := make([]provider.Cluster, 0, len(clusters))
+    for _, cluster := range clusters {
+        // The listing has no endpoint. A failure only leaves it out of
+        // `kubectm list`, so it is logged rather than returned.
+        endpoint, err := getLinodeAPIEndpoint(token, cluster.ID)
         if err != nil {
-            return fmt.Errorf("failed to retrieve kubeconfig for cluster %s: %v", cluster.Label, err)
+            utils.WarnLogger.Printf("%s Failed to get the API endpoint of Linode cluster %s: %v", utils.Iso8601Time(), cluster.Label, err)
         }
+        result = append(result, provider.Cluster{
+            ID:          strconv.Itoa(cluster.ID),
+            Name:        cluster.Label,
+            Region:      cluster.Region,
+            ContextName: cluster.Label,
+            Version:     cluster.K8sVersion,
+            Status:      cluster.Status,
+            Endpoint:    endpoint,
+            Tags:        linodeTags(cluster.Tags),
+        })
+    }
+    return result, nil
+}
 
-        err = saveKubeconfigToFile(cluster.Label, kubeconfig)
-        if err != nil {
-            return fmt.Errorf("failed to save kubeconfig for cluster %s: %v", cluster.Label, err)
+// linodeTags converts Linode's tag list to a map. A "key:value" or "key=value"
+// tag becomes that key and value; any other tag maps to an empty value.
+func linodeTags(tags []string) map[string]string {
+    if len(tags) == 0 {
+        return nil
+    }
+    result := make(map[string]string, len(tags))
+    for _, tag := range tags {
+        if key, value, found := strings.Cut(tag, ":"); found {
+            result[key] = value
+        } else if key, value, found := strings.Cut(tag, "="); found {
+            result[key] = value
+        } else {
+            result[tag] = ""
         }
     }
+    return result
+}
 
-    return nil
+// Kubeconfig downloads and parses the kubeconfig of a single LKE cluster.
+func (linodeProvider) Kubeconfig(ctx context.Context, cred credentials.Credential, cluster provider.Cluster) (*api.Config, error) {
+    token := cred.Details["AccessToken"]
+    if token == "" {
+        return nil, fmt.Errorf("Linode access token is missing")
+    }
+
+    clusterID, err := strconv.Atoi(cluster.ID)
+    if err != nil {
+        return nil, fmt.Errorf("invalid Linode cluster ID %q", cluster.ID)
+    }
+
+    kubeconfig, err := getLinodeKubeconfig(token, clusterID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to retrieve kubeconfig for cluster %s: %v", cluster.Name, err)
+    }
+
+    config, err := clientcmd.Load([]byte(kubeconfig))
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse kubeconfig for cluster %s: %v", cluster.Name, err)
+    }
+    return config, nil
 }
 
 // getLinodeClusters retrieves the list of Linode clusters using the
@@ -124,6 +199,38 @@ func getLinodeClusters(token string) ([]LinodeCluster, error) {
     return clustersResponse.Data, nil
 }
 
+// getLinodeAPIEndpoint retrieves the first API server endpoint of the
+// specified Linode cluster, or "" if it has none yet.
+func getLinodeAPIEndpoint(token string, clusterID int) (string, error) {
+    url := fmt.Sprintf("%s/lke/clusters/%d/api-endpoints", linodeAPIBaseURL, clusterID)
+    req, err := http.NewRequest("GET", url, nil)
+    if err != nil {
+        return "", err
+    }
+    req.Header.Set("Authorization", "Bearer "+token)
+    req.Header.Set("Content-Type", "application/json")
+
+    resp, err := (&http.Client{}).Do(req)
+    if err != nil {
+        return "", err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        body, _ := io.ReadAll(resp.Body)
+        return "", fmt.Errorf("failed to list API endpoints, status: %d, body: %s", resp.StatusCode, string(body))
+    }
+
+    var endpoints LinodeAPIEndpointsResponse
+    if err := json.NewDecoder(resp.Body).Decode(&endpoints); err != nil {
+        return "", err
+    }
+    if len(endpoints.Data) == 0 {
+        return "", nil
+    }
+    return endpoints.Data[0].Endpoint, nil
+}
+
 // getLinodeKubeconfig retrieves the kubeconfig file for the specified Linode
 // cluster using the given token. It sends a GET request to the Linode API and
 // returns the decoded kubeconfig file as a string.
@@ -176,54 +283,3 @@ func getLinodeKubeconfig(token string, clusterID int) (string, error) {
     // Return the decoded kubeconfig file as a string.
     return string(decodedKubeconfig), nil
 }
-
-// saveKubeconfigToFile saves the given kubeconfig string to a file in the
-// ~/.kube directory. The file name is determined by the clusterLabel
-// argument. If the file already exists, it is overwritten.
-//
-// The function returns an error if there is a problem writing the file.
-func saveKubeconfigToFile(clusterLabel string, kubeconfig string) error {
-    // Get the user's home directory
-    homeDir, err := os.UserHomeDir()
-    if err != nil {
-        return err
-    }
-    absHomeDir, err := filepath.Abs(filepath.Clean(homeDir))
-    if err != nil {
-        return err
-    }
-
-    // The cluster label originates from a cloud provider API response and is
-    // therefore untrusted. Reject any value containing a path separator so it
-    // cannot be used to escape the ~/.kube directory (path traversal).
-    if strings.ContainsAny(clusterLabel, `/\`) || strings.Contains(clusterLabel, "..") {
-        return fmt.Errorf("invalid cluster label %q: must not contain path separators", clusterLabel)
-    }
-
-    // Create the ~/.kube directory with 0700 so the directory holding
-    // credential-bearing kubeconfig files is not readable by other users.
-    // Verify it resolves within the home directory before creating it.
-    kubeconfigDir := filepath.Clean(filepath.Join(absHomeDir, ".kube"))
-    if rel, relErr := filepath.Rel(absHomeDir, kubeconfigDir); relErr != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
-        return fmt.Errorf("invalid kube directory outside home: %s", kubeconfigDir)
-    }
-    if err = os.MkdirAll(kubeconfigDir, 0700); err != nil {
-        return err
-    }
-
-    // Build the destination file and confirm it stays inside ~/.kube before writing.
-    kubeconfigFile := filepath.Clean(filepath.Join(kubeconfigDir, fmt.Sprintf("%s-kubeconfig.yaml", clusterLabel)))
-    if rel, relErr := filepath.Rel(kubeconfigDir, kubeconfigFile); relErr != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
-        return fmt.Errorf("invalid kubeconfig path outside .kube directory: %s", kubeconfigFile)
-    }
-
-    // Write the kubeconfig string to the file
-    err = os.WriteFile(kubeconfigFile, []byte(kubeconfig), 0600)
-    if err != nil {
-        return err
-    }
-
-    // Log a message to the user indicating that the file was saved
-    utils.InfoLogger.Printf("%s Kubeconfig saved to %s", utils.Iso8601Time(), kubeconfigFile)
-    return nil
-}
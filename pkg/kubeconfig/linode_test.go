@@ -1,12 +1,11 @@
 package kubeconfig
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
-	"os"
-	"path/filepath"
 	"testing"
 
 	"kubectm/pkg/credentials"
@@ -222,101 +221,8 @@ users:
 	}
 }
 
-// verifySavedKubeconfig checks that the kubeconfig file was created correctly
-func verifySavedKubeconfig(t *testing.T, expectedPath, expectedContent string) {
-	t.Helper()
-
-	if _, err := os.Stat(expectedPath); os.IsNotExist(err) {
-		t.Errorf("Expected file to be created at %s", expectedPath)
-		return
-	}
-
-	content, err := os.ReadFile(expectedPath)
-	if err != nil {
-		t.Errorf("Failed to read saved file: %v", err)
-		return
-	}
-
-	if string(content) != expectedContent {
-		t.Errorf("File content mismatch. Expected:\n%s\n\nGot:\n%s", expectedContent, string(content))
-	}
-
-	info, err := os.Stat(expectedPath)
-	if err != nil {
-		t.Errorf("Failed to stat file: %v", err)
-		return
-	}
-
-	if info.Mode().Perm() != 0600 {
-		t.Errorf("Expected file permissions 0600, got %o", info.Mode().Perm())
-	}
-}
-
-// TestSaveKubeconfigToFile tests the saveKubeconfigToFile function
-func TestSaveKubeconfigToFile(t *testing.T) {
-	tempDir := t.TempDir()
-
-	originalHome := os.Getenv("HOME")
-	os.Setenv("HOME", tempDir)
-	defer os.Setenv("HOME", originalHome)
-
-	tests := []struct {
-		name          string
-		clusterLabel  string
-		kubeconfig    string
-		expectedError bool
-		description   string
-	}{
-		{
-			name:         "save valid kubeconfig",
-			clusterLabel: testClusterName,
-			kubeconfig: `apiVersion: v1
-kind: Config
-clusters:
-- cluster:
-    server: https://example.com:6443
-  name: test-cluster
-`,
-			expectedError: false,
-			description:   "should save kubeconfig successfully",
-		},
-		{
-			name:         "save kubeconfig with special characters in label",
-			clusterLabel: "test-cluster-123",
-			kubeconfig: `apiVersion: v1
-kind: Config
-`,
-			expectedError: false,
-			description:   "should handle special characters in cluster label",
-		},
-		{
-			name:          "save empty kubeconfig",
-			clusterLabel:  "empty-cluster",
-			kubeconfig:    "",
-			expectedError: false,
-			description:   "should save even empty content",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := saveKubeconfigToFile(tt.clusterLabel, tt.kubeconfig)
-
-			if (err != nil) != tt.expectedError {
-				t.Errorf("saveKubeconfigToFile() error = %v, expectedError %v", err, tt.expectedError)
-				return
-			}
-
-			if !tt.expectedError {
-				expectedPath := filepath.Join(tempDir, ".kube", tt.clusterLabel+"-kubeconfig.yaml")
-				verifySavedKubeconfig(t, expectedPath, tt.kubeconfig)
-			}
-		})
-	}
-}
-
-// TestDownloadLinodeKubeConfig tests the downloadLinodeKubeConfig function
-func TestDownloadLinodeKubeConfig(t *testing.T) {
+// TestLinodeProviderListClusters tests the Linode provider's credential checks
+func TestLinodeProviderListClusters(t *testing.T) {
 	tests := []struct {
 		name          string
 		credential    credentials.Credential
@@ -347,15 +253,33 @@ func TestDownloadLinodeKubeConfig(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := downloadLinodeKubeConfig(tt.credential)
+			_, err := linodeProvider{}.ListClusters(context.Background(), tt.credential)
 
 			if (err != nil) != tt.expectedError {
-				t.Errorf("downloadLinodeKubeConfig() error = %v, expectedError %v", err, tt.expectedError)
+				t.Errorf("ListClusters() error = %v, expectedError %v", err, tt.expectedError)
 			}
 		})
 	}
 }
 
+// TestLinodeTags verifies that Linode's tag list is exposed to naming templates
+// as a map.
+func TestLinodeTags(t *testing.T) {
+	tags := linodeTags([]string{"env:prod", "team=payments", "critical"})
+	want := map[string]string{"env": "prod", "team": "payments", "critical": ""}
+	if len(tags) != len(want) {
+		t.Fatalf("linodeTags() = %v, want %v", tags, want)
+	}
+	for key, value := range want {
+		if got, ok := tags[key]; !ok || got != value {
+			t.Errorf("linodeTags()[%q] = %q, want %q", key, got, value)
+		}
+	}
+	if linodeTags(nil) != nil {
+		t.Error("expected nil tags for an untagged cluster")
+	}
+}
+
 // TestLinodeAPICompatibility validates the API endpoint constants
 func TestLinodeAPICompatibility(t *testing.T) {
 	// Verify the API base URL is correct
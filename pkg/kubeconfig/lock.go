@@ -0,0 +1,173 @@
+package kubeconfig
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// kubectmLockName is the file in ~/.kubectm held while kubectm modifies a
+// kubeconfig, so two kubectm runs never interleave.
+const kubectmLockName = "kubectm.lock"
+
+// lockTimeout is how long to wait for a lock held by another process before
+// giving up; lockRetryInterval is how often to try in the meantime.
+var (
+	lockTimeout       = 10 * time.Second
+	lockRetryInterval = 100 * time.Millisecond
+)
+
+// fileLock is a lock taken by creating a file exclusively, the way client-go's
+// clientcmd locks a kubeconfig while writing it.
+type fileLock struct {
+	path string
+}
+
+// release removes the lock file.
+func (l *fileLock) release() {
+	if l != nil {
+		os.Remove(l.path)
+	}
+}
+
+// fileLocks are locks held together, such as the <file>.lock of every
+// kubeconfig a split-mode sync writes.
+type fileLocks []*fileLock
+
+// release releases every lock, in reverse order.
+func (ls fileLocks) release() {
+	for i := len(ls) - 1; i >= 0; i-- {
+		ls[i].release()
+	}
+}
+
+// acquireLock creates path exclusively, writing contents to it, retrying
+// until lockTimeout while another process holds it. If stale is given and
+// reports that the existing lock was left behind by a process that is gone,
+// the lock is removed with removeStaleLock and taken again.
+func acquireLock(path string, contents []byte, stale func(holder []byte) bool) (*fileLock, error) {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			_, werr := f.Write(contents)
+			if cerr := f.Close(); werr == nil {
+				werr = cerr
+			}
+			if werr != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write lock file %s: %v", path, werr)
+			}
+			return &fileLock{path: path}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create lock file %s: %v", path, err)
+		}
+
+		holder, _ := os.ReadFile(path)
+		if stale != nil && stale(holder) {
+			if err := removeStaleLock(path, holder); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s; if no kubectl or kubectm process is running, remove it", path)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// removeStaleLock removes the lock at path if it still contains holder, the
+// contents of a lock found to be stale. Removing it by name could delete a
+// lock another process took in the meantime, so the lock is first renamed to
+// a name of its own, which is atomic: when several processes find the same
+// stale lock, only one of them moves it. A lock that turns out to have been
+// taken since it was read is linked back in place, unless yet another
+// process has taken the free name by then.
+func removeStaleLock(path string, holder []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".stale.*")
+	if err != nil {
+		return fmt.Errorf("failed to take over stale lock %s: %v", path, err)
+	}
+	moved := f.Name()
+	f.Close()
+	defer os.Remove(moved)
+
+	if err := os.Rename(path, moved); err != nil {
+		if os.IsNotExist(err) {
+			// Another process moved it first.
+			return nil
+		}
+		return fmt.Errorf("failed to take over stale lock %s: %v", path, err)
+	}
+	if current, err := os.ReadFile(moved); err == nil && !bytes.Equal(current, holder) {
+		if err := os.Link(moved, path); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("failed to restore lock %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// lockKubeconfig takes the <file>.lock lock clientcmd uses when it writes
+// the kubeconfig at path, so kubectl and other client-go tools do not write
+// the file at the same time as kubectm.
+func lockKubeconfig(path string) (*fileLock, error) {
+	// Like clientcmd, make sure the directory exists before locking.
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create kubeconfig directory: %v", err)
+	}
+	return acquireLock(path+".lock", nil, nil)
+}
+
+// lockKubectm takes the kubectm-wide lock in ~/.kubectm. The lock file
+// records the holder's PID, so a lock left behind by a kubectm process that
+// no longer exists is taken over.
+func lockKubectm() (*fileLock, error) {
+	dir, err := kubectmDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create kubectm directory: %v", err)
+	}
+	return acquireLock(filepath.Join(dir, kubectmLockName), []byte(strconv.Itoa(os.Getpid())), func(holder []byte) bool {
+		pid, err := strconv.Atoi(strings.TrimSpace(string(holder)))
+		return err == nil && !processExists(pid)
+	})
+}
+
+// processExists reports whether a process with the given PID is running.
+// Windows cannot probe a process without signalling it, so there every
+// process is assumed to exist.
+func processExists(pid int) bool {
+	if pid <= 0 || runtime.GOOS == "windows" {
+		return true
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+
+// fileHash returns the content hash of the file at path, or "" if it does
+// not exist. Comparing it before and after a merge detects a kubeconfig
+// that changed on disk in the meantime.
+func fileHash(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return contentHash(data), nil
+}
@@ -0,0 +1,220 @@
+package kubeconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// shortLockTimeout makes lock waits fast for the duration of a test.
+func shortLockTimeout(t *testing.T, timeout time.Duration) {
+	t.Helper()
+	oldTimeout, oldInterval := lockTimeout, lockRetryInterval
+	lockTimeout, lockRetryInterval = timeout, 10*time.Millisecond
+	t.Cleanup(func() { lockTimeout, lockRetryInterval = oldTimeout, oldInterval })
+}
+
+func TestLockKubeconfig(t *testing.T) {
+	shortLockTimeout(t, 50*time.Millisecond)
+	path := filepath.Join(t.TempDir(), ".kube", "config")
+
+	lock, err := lockKubeconfig(path)
+	if err != nil {
+		t.Fatalf("lockKubeconfig() error = %v", err)
+	}
+	if _, err := os.Stat(path + ".lock"); err != nil {
+		t.Fatalf("expected %s.lock to exist, got %v", path, err)
+	}
+
+	if _, err := lockKubeconfig(path); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected a held lock to time out, got %v", err)
+	}
+
+	lock.release()
+	second, err := lockKubeconfig(path)
+	if err != nil {
+		t.Fatalf("expected the released lock to be taken, got %v", err)
+	}
+	second.release()
+}
+
+func TestLockKubectmTakesOverStaleLock(t *testing.T) {
+	shortLockTimeout(t, 50*time.Millisecond)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".kubectm")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatalf("failed to create kubectm dir: %v", err)
+	}
+	lockPath := filepath.Join(dir, kubectmLockName)
+
+	// A PID this large is never a running process.
+	if err := os.WriteFile(lockPath, []byte("2147483646"), 0600); err != nil {
+		t.Fatalf("failed to write stale lock: %v", err)
+	}
+	lock, err := lockKubectm()
+	if err != nil {
+		t.Fatalf("expected the stale lock to be taken over, got %v", err)
+	}
+	if data, _ := os.ReadFile(lockPath); string(data) != strconv.Itoa(os.Getpid()) {
+		t.Errorf("expected the lock to record this process, got %q", data)
+	}
+
+	if _, err := lockKubectm(); err == nil {
+		t.Error("expected a lock held by a running process to time out")
+	}
+	lock.release()
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("expected release to remove the lock, got %v", err)
+	}
+}
+
+// TestAcquireLockConcurrentStaleTakeover verifies that when several
+// processes find the same stale lock, only one of them holds it at a time.
+func TestAcquireLockConcurrentStaleTakeover(t *testing.T) {
+	shortLockTimeout(t, 5*time.Second)
+	path := filepath.Join(t.TempDir(), kubectmLockName)
+	staleHolder := []byte("2147483646")
+	if err := os.WriteFile(path, staleHolder, 0600); err != nil {
+		t.Fatalf("failed to write stale lock: %v", err)
+	}
+	stale := func(holder []byte) bool { return string(holder) == string(staleHolder) }
+
+	const workers = 8
+	var holders, maxHolders atomic.Int32
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lock, err := acquireLock(path, []byte("worker "+strconv.Itoa(i)), stale)
+			if err != nil {
+				errs <- err
+				return
+			}
+			n := holders.Add(1)
+			for {
+				m := maxHolders.Load()
+				if n <= m || maxHolders.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			holders.Add(-1)
+			lock.release()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("acquireLock() error = %v", err)
+	}
+	if got := maxHolders.Load(); got != 1 {
+		t.Errorf("expected one holder at a time, got %d at once", got)
+	}
+	if matches, _ := filepath.Glob(path + ".stale.*"); len(matches) != 0 {
+		t.Errorf("expected no leftover files, got %v", matches)
+	}
+}
+
+// TestRemoveStaleLockKeepsNewHolder replays the takeover race step by step:
+// two processes read the same stale lock, the first removes it and takes the
+// lock, and only then does the second try to remove what it read.
+func TestRemoveStaleLockKeepsNewHolder(t *testing.T) {
+	shortLockTimeout(t, 50*time.Millisecond)
+	path := filepath.Join(t.TempDir(), kubectmLockName)
+	staleHolder := []byte("2147483646")
+	if err := os.WriteFile(path, staleHolder, 0600); err != nil {
+		t.Fatalf("failed to write stale lock: %v", err)
+	}
+
+	if err := removeStaleLock(path, staleHolder); err != nil {
+		t.Fatalf("removeStaleLock() error = %v", err)
+	}
+	first, err := acquireLock(path, []byte("first"), nil)
+	if err != nil {
+		t.Fatalf("acquireLock() error = %v", err)
+	}
+	defer first.release()
+
+	if err := removeStaleLock(path, staleHolder); err != nil {
+		t.Fatalf("removeStaleLock() error = %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "first" {
+		t.Errorf("expected the first process to keep the lock, got %q (err %v)", data, err)
+	}
+	if matches, _ := filepath.Glob(path + ".stale.*"); len(matches) != 0 {
+		t.Errorf("expected no leftover files, got %v", matches)
+	}
+}
+
+// TestMergeConfigsRemergesOnConcurrentChange verifies that a kubeconfig
+// changed on disk while MergeConfigs waits for its lock is merged again
+// rather than overwritten.
+func TestMergeConfigsRemergesOnConcurrentChange(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	kubeDir := filepath.Join(home, ".kube")
+	if err := os.MkdirAll(kubeDir, 0700); err != nil {
+		t.Fatalf("failed to create .kube dir: %v", err)
+	}
+	configPath := filepath.Join(kubeDir, "config")
+	if err := os.WriteFile(configPath, []byte(testKubeconfigContent), 0600); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+
+	// Hold the kubeconfig lock as kubectl would while it writes.
+	held, err := lockKubeconfig(configPath)
+	if err != nil {
+		t.Fatalf("lockKubeconfig() error = %v", err)
+	}
+
+	downloaded := []DownloadedConfig{{
+		Provider: "Linode",
+		Config:   createTestConfig(testClusterNameMerge, testServerURL, testCAData, testUserName, testToken, testContextName, nil),
+	}}
+	downloaded[0].Cluster.ContextName = "lke-prod"
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := MergeConfigs(&DownloadResult{Configs: downloaded}, MergeOptions{})
+		done <- err
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	changed, err := clientcmd.Load([]byte(testKubeconfigContent))
+	if err != nil {
+		t.Fatalf("failed to parse kubeconfig: %v", err)
+	}
+	changed.Preferences.Colors = true
+	if err := clientcmd.WriteToFile(*changed, configPath); err != nil {
+		t.Fatalf("failed to change kubeconfig: %v", err)
+	}
+	held.release()
+
+	if err := <-done; err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+	merged, err := clientcmd.LoadFromFile(configPath)
+	if err != nil {
+		t.Fatalf("failed to load merged config: %v", err)
+	}
+	if !merged.Preferences.Colors {
+		t.Error("expected the concurrent change to be kept")
+	}
+	if _, ok := merged.Contexts["lke-prod"]; !ok {
+		t.Errorf("expected context lke-prod in merged config, got %v", merged.Contexts)
+	}
+	if _, err := os.Stat(configPath + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("expected the kubeconfig lock to be released, got %v", err)
+	}
+}
@@ -1,12 +1,15 @@
 package kubeconfig
 
 import (
+    "bytes"
     "fmt"
     "os"
     "path/filepath"
+    "sort"
     "strings"
     "kubectm/pkg/utils"
     "github.com/fatih/color"
+    apiequality "k8s.io/apimachinery/pkg/api/equality"
     "k8s.io/apimachinery/pkg/runtime"
     "k8s.io/apimachinery/pkg/runtime/schema"
     "k8s.io/client-go/tools/clientcmd"
@@ -32,37 +35,60 @@ func getKubeDir() (homeDir, kubeDir string, err error) {
     return homeDir, kubeDir, nil
 }
 
-// saveImage saves the LKE image to ~/.kube/lke.png
-//
-// It returns the path to the saved image and an error if saving fails.
-func saveImage() (string, error) {
+// defaultKubeconfig returns the path of ~/.kube/config, confined to the .kube
+// directory in the user's home.
+func defaultKubeconfig() (string, error) {
     homeDir, kubeconfigDir, err := getKubeDir()
     if err != nil {
         return "", err
     }
 
-    if rel, relErr := filepath.Rel(homeDir, kubeconfigDir); relErr != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
-        return "", fmt.Errorf("invalid directory path outside user home")
+    if !strings.HasPrefix(kubeconfigDir, homeDir) {
+        return "", fmt.Errorf("invalid kubeconfig directory outside user home: %s", kubeconfigDir)
+    }
+
+    path := filepath.Clean(filepath.Join(kubeconfigDir, "config"))
+    if !strings.HasPrefix(path, kubeconfigDir) {
+        return "", fmt.Errorf("invalid main kubeconfig path outside .kube directory: %s", path)
     }
+    return path, nil
+}
 
-    if err := os.MkdirAll(kubeconfigDir, 0700); err != nil {
-        return "", fmt.Errorf("failed to create kubeconfig directory: %v", err)
+// lkeImagePath returns the path of the LKE image, ~/.kube/lke.png, without
+// writing it.
+func lkeImagePath() (string, error) {
+    homeDir, kubeconfigDir, err := getKubeDir()
+    if err != nil {
+        return "", err
+    }
+
+    if rel, relErr := filepath.Rel(homeDir, kubeconfigDir); relErr != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+        return "", fmt.Errorf("invalid directory path outside user home")
     }
 
     imagePath := filepath.Clean(filepath.Join(kubeconfigDir, "lke.png"))
     if rel, relErr := filepath.Rel(kubeconfigDir, imagePath); relErr != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
         return "", fmt.Errorf("invalid image path outside .kube directory")
     }
+    return imagePath, nil
+}
+
+// saveImage saves the LKE image to ~/.kube/lke.png as part of tx, unless it
+// is already there.
+func saveImage(tx *transaction, imagePath string) error {
+    if err := os.MkdirAll(filepath.Dir(imagePath), 0700); err != nil {
+        return fmt.Errorf("failed to create kubeconfig directory: %v", err)
+    }
 
     existingImage, readErr := os.ReadFile(imagePath)
     if readErr != nil || string(existingImage) != string(lkeImage) {
-        if err := os.WriteFile(imagePath, lkeImage, 0600); err != nil {
-            return "", fmt.Errorf("failed to write image file: %v", err)
+        if err := tx.writeFile(imagePath, lkeImage, 0600); err != nil {
+            return fmt.Errorf("failed to write image file: %v", err)
         }
         utils.InfoLogger.Printf("%s Saved Linode icon to %s", utils.Iso8601Time(), imagePath)
     }
 
-    return imagePath, nil
+    return nil
 }
 
 // AptakubeExtension is a custom struct that implements runtime.Object
@@ -82,100 +108,344 @@ func (e *AptakubeExtension) DeepCopyObject() runtime.Object {
     }
 }
 
-// processYAMLFile processes a single YAML kubeconfig file and adds it to the main config
-func processYAMLFile(mainConfig *api.Config, kubeconfigDir, fileName, imagePath string) (string, error) {
-    filePath := filepath.Clean(filepath.Join(kubeconfigDir, fileName))
+// MergeOptions controls how MergeConfigs applies downloaded kubeconfigs.
+type MergeOptions struct {
+    // DryRun computes the merge and its report without writing any files.
+    DryRun bool
+    // Prune configures removal of kubectm-created contexts whose cluster no
+    // longer exists at the provider.
+    Prune PruneOptions
+    // BackupCount is passed to BackupConfig before anything is written.
+    BackupCount int
+    // Providers are recorded in the backup's metadata.
+    Providers []string
+    // Output selects whether the configs are merged into the target kubeconfig or written
+    // to one file per provider or cluster. The zero value merges.
+    Output OutputMode
+    // Conflicts resolves fields of kubectm-managed entries that were edited locally and changed
+    // upstream. The zero value keeps the local values.
+    Conflicts ConflictOptions
+    // CurrentContext decides the merged kubeconfig's current-context. The zero value keeps it.
+    // Split output mode never writes the target kubeconfig, so its current-context is kept.
+    CurrentContext CurrentContextOptions
+}
 
-    if !strings.HasPrefix(filePath, kubeconfigDir) {
-        utils.WarnLogger.Printf("%s Ignoring file outside .kube directory: %s", utils.Iso8601Time(), filePath)
-        return "", nil
+// mergeDownloadedConfig merges a single downloaded kubeconfig into the main config, stamps the
+// contexts it manages, and their cluster and user entries, with the kubectm ownership extension,
+// and records the contexts in state, along with the fields they were synced with.
+//
+// A context kubectm synced before is updated by a three-way merge with its last-synced fields
+// (see syncManagedContext), so local edits to it survive the sync. An existing pinned context,
+// or one sharing its cluster or user with a pinned context, is left alone; the report says
+// whether upstream has drifted from it.
+func mergeDownloadedConfig(mainConfig *api.Config, downloaded DownloadedConfig, imagePath string, state *kubeconfigState, pins pinSet, opts MergeOptions, report *Report) error {
+    contextName := downloaded.Cluster.ContextName
+    if downloaded.Config == nil {
+        return fmt.Errorf("no kubeconfig downloaded for %s cluster %s", downloaded.Provider, contextName)
+    }
+    contextName = migrateContext(mainConfig, state, downloaded, pins, report)
+    pinnedClusters, pinnedUsers := pins.entries(mainConfig)
+    if context := mainConfig.Contexts[contextName]; context != nil && (pins.matches(contextName) || pinnedClusters[context.Cluster] || pinnedUsers[context.AuthInfo]) {
+        return reportPinnedDrift(mainConfig, downloaded, contextName, report)
     }
 
-    utils.ActionLogger.Printf("%s Merging kubeconfig from %s", utils.Iso8601Time(), filePath)
+    utils.ActionLogger.Printf("%s Merging kubeconfig for %s cluster %s", utils.Iso8601Time(), downloaded.Provider, color.New(color.Bold).Sprint(contextName))
 
-    newConfig, err := loadKubeconfig(filePath)
+    synced, err := newSyncedFields(downloaded.Config)
     if err != nil {
-        return "", fmt.Errorf("failed to load kubeconfig from %s: %v", filePath, err)
+        return fmt.Errorf("failed to merge kubeconfig for %s: %v", contextName, err)
     }
 
-    contextName := strings.TrimSuffix(fileName, "-kubeconfig.yaml")
-    if err := mergeKubeconfigs(mainConfig, newConfig, contextName, imagePath); err != nil {
-        return "", fmt.Errorf("failed to merge kubeconfig from %s: %v", filePath, err)
-    }
+    var written []string
+    if managed := state.Contexts[contextName]; managed != nil && managed.Synced != nil && mainConfig.Contexts[contextName] != nil {
+        if err := syncManagedContext(mainConfig, downloaded, contextName, managed.Synced, imagePath, opts, report); err != nil {
+            return fmt.Errorf("failed to merge kubeconfig for %s: %v", contextName, err)
+        }
+        written = []string{contextName}
+    } else if written, err = mergeKubeconfigs(mainConfig, downloaded.Config, contextName, imagePath, report); err != nil {
+        return fmt.Errorf("failed to merge kubeconfig for %s: %v", contextName, err)
+    }
+
+    // Contexts kubectm wrote are owned by it. A context that was skipped
+    // because it already existed is only refreshed if kubectm already owns it,
+    // so hand-written contexts are never adopted and later pruned.
+    if len(written) == 0 && isOwnedContext(mainConfig, state, contextName) {
+        written = []string{contextName}
+    }
+    ext := newKubectmExtension(downloaded)
+    for _, name := range written {
+        context := mainConfig.Contexts[name]
+        context.Extensions = setOwnership(context.Extensions, ext)
+        // Only stamp cluster and user entries this download wrote, or that
+        // kubectm already owns; a same-named hand-written entry stays unowned,
+        // and an entry a pinned context uses is not touched.
+        if cluster := mainConfig.Clusters[context.Cluster]; cluster != nil && !pinnedClusters[context.Cluster] && (containsValue(downloaded.Config.Clusters, cluster) || ownership(cluster.Extensions) != nil) {
+            cluster.Extensions = setOwnership(cluster.Extensions, ext)
+        }
+        if authInfo := mainConfig.AuthInfos[context.AuthInfo]; authInfo != nil && !pinnedUsers[context.AuthInfo] && (containsValue(downloaded.Config.AuthInfos, authInfo) || ownership(authInfo.Extensions) != nil) {
+            authInfo.Extensions = setOwnership(authInfo.Extensions, ext)
+        }
 
-    return filePath, nil
+        managed := &ManagedContext{
+            Provider:  downloaded.Provider,
+            Account:   downloaded.Account,
+            ClusterID: downloaded.Cluster.ID,
+            Cluster:   context.Cluster,
+            User:      context.AuthInfo,
+            Synced:    synced,
+        }
+        state.Contexts[name] = managed
+    }
+    return nil
 }
 
-// cleanupMergedFiles removes the temporary kubeconfig files that have been merged
-func cleanupMergedFiles(filesToDelete []string, kubeconfigDir string) {
-    for _, filePath := range filesToDelete {
-        if !strings.HasPrefix(filePath, kubeconfigDir) {
-            utils.WarnLogger.Printf("%s Skipping deletion of file outside .kube directory: %s", utils.Iso8601Time(), filePath)
-            continue
+// containsValue reports whether entry is one of the values of m. The merge stores downloaded
+// entries by pointer, so this identifies the entries a download wrote, whatever their key.
+func containsValue[V comparable](m map[string]V, entry V) bool {
+    for _, v := range m {
+        if v == entry {
+            return true
         }
+    }
+    return false
+}
 
-        if err := os.Remove(filePath); err != nil {
-            utils.WarnLogger.Printf("%s Warning: failed to delete file %s: %v", utils.Iso8601Time(), filePath, err)
-        } else {
-            utils.InfoLogger.Printf("%s Deleted file %s", utils.Iso8601Time(), filePath)
-        }
+// isOwnedContext reports whether kubectm manages the named context, either because it is
+// recorded in state or because it carries the kubectm ownership extension.
+func isOwnedContext(config *api.Config, state *kubeconfigState, name string) bool {
+    if state.Contexts[name] != nil {
+        return true
     }
+    context := config.Contexts[name]
+    return context != nil && ownership(context.Extensions) != nil
 }
 
-// MergeConfigs merges all kubeconfig files in the ~/.kube directory into one main config file.
-// It ensures safe path operations and cleans up unnecessary files safely.
-func MergeConfigs() error {
-    homeDir, kubeconfigDir, err := getKubeDir()
+// maxMergeAttempts bounds how often MergeConfigs merges again when the kubeconfig keeps
+// changing on disk while it works.
+const maxMergeAttempts = 3
+
+// MergeConfigs merges the downloaded kubeconfigs into the target kubeconfig, ~/.kube/config
+// unless --kubeconfig, KUBECTM_KUBECONFIG or KUBECONFIG name another file (see targetKubeconfig).
+// The configs are merged in memory; no other kubeconfig is read, written or removed.
+// It returns a report of every context, cluster and user added, overwritten, skipped,
+// renamed or pruned. With opts.DryRun set nothing is written and the report describes the plan.
+//
+// With opts.Output set to OutputProvider or OutputCluster, the target kubeconfig is left alone
+// and the configs are merged into one file per provider or per cluster in the kubectm.d
+// directory next to it instead (see splitInMemory).
+//
+// The sync is a transaction: the merged kubeconfig is validated with clientcmd.Validate,
+// the kubeconfig is backed up, and only then are the icon, the kubeconfig and the state file
+// written, each atomically. If any write fails, the files already written are put back and
+// a *RollbackError describes what was rolled back.
+//
+// While writing, MergeConfigs holds the kubectm-wide lock and the kubeconfig's <file>.lock
+// used by client-go. If the kubeconfig changed on disk after it was loaded, for example by
+// kubectl config use-context, the merge is redone on the new content instead of overwriting it.
+func MergeConfigs(downloaded *DownloadResult, opts MergeOptions) (*Report, error) {
+    mainKubeconfigPath, err := targetKubeconfig()
     if err != nil {
-        return err
+        return nil, err
     }
 
-    if !strings.HasPrefix(kubeconfigDir, homeDir) {
-        return fmt.Errorf("invalid kubeconfig directory outside user home: %s", kubeconfigDir)
+    iconPath, err := lkeImagePath()
+    if err != nil {
+        return nil, fmt.Errorf("failed to locate Linode icon: %v", err)
     }
 
-    mainKubeconfigPath := filepath.Clean(filepath.Join(kubeconfigDir, "config"))
-    if !strings.HasPrefix(mainKubeconfigPath, kubeconfigDir) {
-        return fmt.Errorf("invalid main kubeconfig path outside .kube directory: %s", mainKubeconfigPath)
+    if !opts.DryRun {
+        lock, err := lockKubectm()
+        if err != nil {
+            return nil, err
+        }
+        defer lock.release()
     }
 
-    mainConfig, err := loadKubeconfig(mainKubeconfigPath)
-    if err != nil {
-        utils.WarnLogger.Printf("%s No existing kubeconfig found at %s, creating a new one", utils.Iso8601Time(), mainKubeconfigPath)
-        mainConfig = api.NewConfig()
+    for attempt := 1; ; attempt++ {
+        plan, err := mergeInMemory(downloaded.deepCopy(), mainKubeconfigPath, iconPath, opts)
+        if err != nil {
+            return nil, err
+        }
+
+        tx := &transaction{}
+        for _, f := range plan.files {
+            if f.config == nil {
+                continue
+            }
+            if err := validateMerged(f.before, f.config); err != nil {
+                return nil, tx.fail(err)
+            }
+        }
+
+        if opts.DryRun {
+            utils.InfoLogger.Printf("%s Dry run: %s was not modified", utils.Iso8601Time(), plan.report.Path)
+            return plan.report, nil
+        }
+
+        locks, changed, err := plan.lock()
+        if err != nil {
+            return nil, tx.fail(err)
+        }
+        if changed != "" {
+            locks.release()
+            if attempt == maxMergeAttempts {
+                return nil, tx.fail(fmt.Errorf("%s kept changing on disk, giving up after %d attempts", changed, attempt))
+            }
+            utils.WarnLogger.Printf("%s %s changed on disk while merging, merging again", utils.Iso8601Time(), changed)
+            continue
+        }
+
+        err = commitMerge(tx, plan, iconPath, opts)
+        locks.release()
+        if err != nil {
+            return nil, err
+        }
+
+        utils.InfoLogger.Printf("%s Successfully merged %d kubeconfig(s) into %s", utils.Iso8601Time(), len(downloaded.Configs), plan.report.Path)
+        return plan.report, nil
     }
+}
+
+// mergePlan is the outcome of a merge computed in memory: its report, and the state file and
+// kubeconfig files to write.
+type mergePlan struct {
+    report *Report
+    state  *syncState
+    files  []*plannedFile
+    // envPath and envData, in split output mode, are the file kubectm maintains with the
+    // matching KUBECONFIG value, and its content.
+    envPath string
+    envData []byte
+}
+
+// plannedFile is a kubeconfig file a merge writes, or removes if config is nil.
+type plannedFile struct {
+    path string
+    // loadedHash is the content hash of the file when it was loaded, "" if it did not exist.
+    loadedHash string
+    before     *api.Config
+    config     *api.Config
+}
 
-    imagePath, err := saveImage()
+// loadPlannedFile loads the kubeconfig at path for merging. A missing or unreadable file is
+// replaced by a new, empty kubeconfig.
+func loadPlannedFile(path string) (*plannedFile, error) {
+    hash, err := fileHash(path)
     if err != nil {
-        return fmt.Errorf("failed to save Linode icon: %v", err)
+        return nil, err
     }
+    f := &plannedFile{path: path, loadedHash: hash}
 
-    files, err := os.ReadDir(kubeconfigDir)
+    config, err := loadKubeconfig(path)
     if err != nil {
-        return fmt.Errorf("failed to read kubeconfig directory: %v", err)
+        utils.WarnLogger.Printf("%s No existing kubeconfig found at %s, creating a new one", utils.Iso8601Time(), path)
+        f.config = api.NewConfig()
+    } else {
+        f.config, f.before = config, config.DeepCopy()
     }
+    return f, nil
+}
 
-    var filesToDelete []string
-    for _, file := range files {
-        if filepath.Ext(file.Name()) != ".yaml" {
-            continue
+// lock takes the <file>.lock of every file in the plan, in path order. It returns the path of
+// the first file whose content changed on disk since it was loaded, or "" if none did.
+func (p *mergePlan) lock() (fileLocks, string, error) {
+    var locks fileLocks
+    for _, f := range p.files {
+        lock, err := lockKubeconfig(f.path)
+        if err != nil {
+            locks.release()
+            return nil, "", err
         }
-        filePath, err := processYAMLFile(mainConfig, kubeconfigDir, file.Name(), imagePath)
+        locks = append(locks, lock)
+    }
+    for _, f := range p.files {
+        hash, err := fileHash(f.path)
         if err != nil {
-            return err
+            locks.release()
+            return nil, "", err
         }
-        if filePath != "" {
-            filesToDelete = append(filesToDelete, filePath)
+        if hash != f.loadedHash {
+            return locks, f.path, nil
         }
     }
+    return locks, "", nil
+}
+
+// mergeInMemory loads the kubeconfig and the state file, and merges and prunes the downloaded
+// configs into them without writing anything.
+func mergeInMemory(downloaded *DownloadResult, mainKubeconfigPath, iconPath string, opts MergeOptions) (*mergePlan, error) {
+    state, err := loadSyncState()
+    if err != nil {
+        return nil, err
+    }
+    pins, err := loadPins()
+    if err != nil {
+        return nil, err
+    }
+    if opts.Output.split() {
+        return splitInMemory(downloaded, mainKubeconfigPath, iconPath, state, pins, opts)
+    }
 
-    if err := saveKubeconfig(mainConfig, mainKubeconfigPath); err != nil {
-        return fmt.Errorf("failed to save merged kubeconfig: %v", err)
+    f, err := loadPlannedFile(mainKubeconfigPath)
+    if err != nil {
+        return nil, err
+    }
+    report := &Report{DryRun: opts.DryRun, Path: mainKubeconfigPath, before: f.before, after: f.config}
+    ks := state.forKubeconfig(mainKubeconfigPath)
+    managed := managedClusters(ks)
+    if err := mergeInto(f.config, downloaded.Configs, downloaded.Listed, iconPath, ks, pins, opts, report); err != nil {
+        return nil, err
     }
+    applyCurrentContext(f.config, addedContexts(downloaded.Configs, managed, ks), opts.CurrentContext, report)
+    return &mergePlan{report: report, state: state, files: []*plannedFile{f}}, nil
+}
 
-    utils.InfoLogger.Printf("%s Successfully merged kubeconfigs into %s", utils.Iso8601Time(), mainKubeconfigPath)
-    cleanupMergedFiles(filesToDelete, kubeconfigDir)
+// mergeInto merges the downloaded configs into config and prunes the stale contexts that state
+// records for it, leaving pinned contexts alone.
+func mergeInto(config *api.Config, downloaded []DownloadedConfig, listed map[string]map[string]bool, iconPath string, state *kubeconfigState, pins pinSet, opts MergeOptions, report *Report) error {
+    for _, d := range downloaded {
+        if err := mergeDownloadedConfig(config, d, iconPath, state, pins, opts, report); err != nil {
+            return err
+        }
+    }
+    pruneStaleContexts(config, state, listed, pins, opts.Prune, opts.DryRun, report)
+    return nil
+}
+
+// commitMerge backs up the kubeconfig and writes the icon, the merged kubeconfig and the
+// state file as part of tx, rolling every write back if one fails. In split output mode the
+// target kubeconfig is not written, so it is not backed up either.
+func commitMerge(tx *transaction, plan *mergePlan, iconPath string, opts MergeOptions) error {
+    // Back up the existing kubeconfig before anything is written, so a bad
+    // merge is always recoverable.
+    if !opts.Output.split() {
+        if _, err := BackupConfig(opts.BackupCount, opts.Providers...); err != nil {
+            return tx.fail(fmt.Errorf("failed to back up kubeconfig: %v", err))
+        }
+    }
 
+    if err := saveImage(tx, iconPath); err != nil {
+        return tx.fail(fmt.Errorf("failed to save Linode icon: %v", err))
+    }
+    for _, f := range plan.files {
+        if f.config == nil {
+            if err := tx.removeFile(f.path); err != nil {
+                return tx.fail(fmt.Errorf("failed to remove kubeconfig: %v", err))
+            }
+            continue
+        }
+        if err := saveKubeconfig(tx, f.config, f.path); err != nil {
+            return tx.fail(fmt.Errorf("failed to save merged kubeconfig: %v", err))
+        }
+    }
+    if plan.envPath != "" {
+        if err := tx.writeFile(plan.envPath, plan.envData, 0600); err != nil {
+            return tx.fail(fmt.Errorf("failed to save KUBECONFIG file: %v", err))
+        }
+    }
+    if err := plan.state.save(tx); err != nil {
+        return tx.fail(fmt.Errorf("failed to save kubectm state: %v", err))
+    }
     return nil
 }
 
@@ -183,17 +453,12 @@ func MergeConfigs() error {
 //
 // It reads the contents of the file at the specified path and uses the
 // clientcmd package to parse the contents into an api.Config object.
-// Ensures the path is within the expected ~/.kube directory.
+// Ensures the path is an absolute, clean path such as targetKubeconfig returns.
 //
 // The function returns an api.Config object and an error. If the error
 // is not nil, the returned config object is nil.
 func loadKubeconfig(path string) (*api.Config, error) {
-    _, kubeconfigDir, err := getKubeDir()
-    if err != nil {
-        return nil, err
-    }
-
-    if !strings.HasPrefix(filepath.Clean(path), kubeconfigDir) {
+    if !filepath.IsAbs(path) || filepath.Clean(path) != path {
         return nil, fmt.Errorf("path traversal attempt detected: %s", path)
     }
 
@@ -230,26 +495,99 @@ func isSameCluster(cluster1, cluster2 *api.Cluster) bool {
     return true
 }
 
-// mergeMaps copies non-existing entries from source maps to destination maps
-func mergeClusters(dest, src map[string]*api.Cluster) {
-    for key, cluster := range src {
-        if _, exists := dest[key]; !exists {
-            dest[key] = cluster
+// mergeCluster stores an incoming cluster in dest and returns the key it was stored under.
+// An existing entry with the same key is reused if it is the same cluster, and replaced if
+// only the context being overwritten refers to it; otherwise the incoming cluster is stored
+// under a unique key, the way makeContextNameUnique names contexts.
+func mergeCluster(dest *api.Config, key string, cluster *api.Cluster, overwriting string, report *Report) string {
+    resolved, action := resolveKey(dest.Clusters, key,
+        func(existing *api.Cluster) bool { return isSameCluster(existing, cluster) },
+        func(candidate string) bool { return referencedOnlyBy(dest, overwriting, func(c *api.Context) string { return c.Cluster }, candidate) })
+    recordEntry(report, KindCluster, key, resolved, action)
+    if action != ActionSkipped {
+        dest.Clusters[resolved] = cluster
+    }
+    return resolved
+}
+
+// mergeAuthInfo stores an incoming user in dest and returns the key it was stored under,
+// following the same rules as mergeCluster with users compared by their credentials.
+func mergeAuthInfo(dest *api.Config, key string, authInfo *api.AuthInfo, overwriting string, report *Report) string {
+    resolved, action := resolveKey(dest.AuthInfos, key,
+        func(existing *api.AuthInfo) bool { return existing != nil && authInfo != nil && sameCredentials(existing, authInfo) },
+        func(candidate string) bool { return referencedOnlyBy(dest, overwriting, func(c *api.Context) string { return c.AuthInfo }, candidate) })
+    recordEntry(report, KindUser, key, resolved, action)
+    if action != ActionSkipped {
+        dest.AuthInfos[resolved] = authInfo
+    }
+    return resolved
+}
+
+// resolveKey picks the key an incoming entry is stored under. It tries key, then key-1,
+// key-2 and so on, and takes the first candidate that is free (added), holds the same
+// entry (skipped) or may be replaced (overwritten). Trying candidates in order keeps the
+// result stable across syncs: a renamed entry is found again under the same key.
+func resolveKey[V any](dest map[string]V, key string, same func(V) bool, replaceable func(string) bool) (string, ChangeAction) {
+    candidate := key
+    for i := 1; ; i++ {
+        existing, exists := dest[candidate]
+        switch {
+        case !exists:
+            return candidate, ActionAdded
+        case same(existing):
+            return candidate, ActionSkipped
+        case replaceable(candidate):
+            return candidate, ActionOverwritten
         }
+        candidate = fmt.Sprintf("%s-%d", key, i)
     }
 }
 
-func mergeAuthInfos(dest, src map[string]*api.AuthInfo) {
-    for key, authInfo := range src {
-        if _, exists := dest[key]; !exists {
-            dest[key] = authInfo
+// referencedOnlyBy reports whether the named context is the only context whose ref is key.
+// An empty context name matches nothing, so entries are never replaced unless a context is
+// being overwritten.
+func referencedOnlyBy(config *api.Config, contextName string, ref func(*api.Context) string, key string) bool {
+    if contextName == "" {
+        return false
+    }
+    owner := config.Contexts[contextName]
+    if owner == nil || ref(owner) != key {
+        return false
+    }
+    for name, context := range config.Contexts {
+        if name != contextName && context != nil && ref(context) == key {
+            return false
         }
     }
+    return true
+}
+
+// recordEntry records how an incoming cluster or user entry was merged.
+func recordEntry(report *Report, kind ChangeKind, key, resolved string, action ChangeAction) {
+    switch {
+    case resolved != key && action == ActionAdded:
+        report.record(kind, resolved, ActionRenamed, fmt.Sprintf("from %s, name in use", key))
+    case action == ActionSkipped:
+        report.record(kind, resolved, ActionSkipped, "already exists")
+    default:
+        report.record(kind, resolved, action, "")
+    }
+}
+
+// sortedKeys returns the keys of m in sorted order so merges, and the
+// reports describing them, are deterministic.
+func sortedKeys[V any](m map[string]V) []string {
+    keys := make([]string, 0, len(m))
+    for key := range m {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    return keys
 }
 
 // handleExistingContext checks if an existing context should be skipped or overwritten
 // Returns: shouldSkip, shouldOverwrite
-func handleExistingContext(dest, src *api.Config, contextName string, context *api.Context, imagePath string) (bool, bool) {
+func handleExistingContext(dest, src *api.Config, contextName string, context *api.Context, imagePath string, report *Report) (bool, bool) {
     if context == nil {
         return false, false
     }
@@ -267,17 +605,52 @@ func handleExistingContext(dest, src *api.Config, contextName string, context *a
         // pre-existing contexts also get the icon (issue #14).
         ensureAptakubeExtension(existingContext, imagePath)
         utils.ActionLogger.Printf("%s Context %s already exists for the same cluster, updating Aptakube icon...", utils.Iso8601Time(), color.New(color.Bold).Sprint(contextName))
+        refreshCredentials(dest, existingContext, src.AuthInfos[context.AuthInfo], context.AuthInfo, contextName, report)
+        report.record(KindContext, contextName, ActionSkipped, "same cluster")
         return true, false
     }
 
     utils.ActionLogger.Printf("%s Context %s exists but refers to a different cluster, overwriting...", utils.Iso8601Time(), color.New(color.Bold).Sprint(contextName))
-    dest.Clusters[context.Cluster] = src.Clusters[context.Cluster]
-    if authInfo, exists := src.AuthInfos[context.AuthInfo]; exists {
-        dest.AuthInfos[context.AuthInfo] = authInfo
-    }
+    report.record(KindContext, contextName, ActionOverwritten, "different cluster")
     return false, true
 }
 
+// refreshCredentials replaces the user entry of an existing context with the downloaded one when
+// the credentials differ, e.g. after a token rotation or an exec configuration change. The context
+// itself, including its name and namespace, is left untouched.
+//
+// Only a user entry kubectm owns, or one with the same name as the downloaded entry, is updated,
+// so a hand-written user that happens to point at the same cluster keeps its credentials.
+func refreshCredentials(dest *api.Config, existingContext *api.Context, incoming *api.AuthInfo, incomingName, contextName string, report *Report) {
+    existing := dest.AuthInfos[existingContext.AuthInfo]
+    if incoming == nil || existing == nil {
+        return
+    }
+    if existingContext.AuthInfo != incomingName && ownership(existing.Extensions) == nil {
+        return
+    }
+    if sameCredentials(existing, incoming) {
+        return
+    }
+
+    updated := incoming.DeepCopy()
+    updated.LocationOfOrigin = existing.LocationOfOrigin
+    updated.Extensions = existing.Extensions
+    dest.AuthInfos[existingContext.AuthInfo] = updated
+
+    utils.ActionLogger.Printf("%s Context %s: updated credentials for user %s", utils.Iso8601Time(), color.New(color.Bold).Sprint(contextName), existingContext.AuthInfo)
+    report.record(KindUser, existingContext.AuthInfo, ActionUpdated, "credentials changed")
+}
+
+// sameCredentials reports whether two user entries hold the same credentials, ignoring
+// extensions and where they were loaded from.
+func sameCredentials(a, b *api.AuthInfo) bool {
+    a, b = a.DeepCopy(), b.DeepCopy()
+    a.LocationOfOrigin, b.LocationOfOrigin = "", ""
+    a.Extensions, b.Extensions = nil, nil
+    return apiequality.Semantic.DeepEqual(a, b)
+}
+
 // ensureAptakubeExtension adds or updates the Aptakube icon extension on the
 // given context, preserving any other extensions already present.
 func ensureAptakubeExtension(context *api.Context, imagePath string) {
@@ -306,34 +679,48 @@ func createContextWithExtension(context *api.Context, imagePath string) *api.Con
     return &newContext
 }
 
-// mergeKubeconfigs merges the source kubeconfig into the destination kubeconfig and renames contexts
-func mergeKubeconfigs(dest, src *api.Config, contextName string, imagePath string) error {
-    mergeClusters(dest.Clusters, src.Clusters)
-    mergeAuthInfos(dest.AuthInfos, src.AuthInfos)
-
-    for key, context := range src.Contexts {
+// mergeKubeconfigs merges the source kubeconfig into the destination kubeconfig and renames contexts.
+// Cluster and user entries whose key is already taken by a different entry are stored under a
+// unique key, and the merged context refers to them, so it always points at the cluster and
+// credentials it was downloaded with. Every change is recorded in report, which may be nil. It
+// returns the names of the contexts it added or overwrote; contexts skipped because they already
+// exist for the same cluster are not included.
+func mergeKubeconfigs(dest, src *api.Config, contextName string, imagePath string, report *Report) ([]string, error) {
+    var written []string
+    for _, key := range sortedKeys(src.Contexts) {
+        context := src.Contexts[key]
         if context == nil {
             continue
         }
-        shouldSkip, shouldOverwrite := handleExistingContext(dest, src, contextName, context, imagePath)
+        shouldSkip, shouldOverwrite := handleExistingContext(dest, src, contextName, context, imagePath, report)
         if shouldSkip {
             continue
         }
 
         uniqueContextName := contextName
-        if !shouldOverwrite {
+        overwriting := ""
+        if shouldOverwrite {
+            overwriting = contextName
+        } else {
             uniqueContextName = makeContextNameUnique(contextName, dest.Contexts)
+            if uniqueContextName != contextName {
+                report.record(KindContext, uniqueContextName, ActionRenamed, "from "+contextName)
+            } else {
+                report.record(KindContext, uniqueContextName, ActionAdded, "")
+            }
         }
 
         newContext := createContextWithExtension(context, imagePath)
-        newContext.Cluster = context.Cluster
-        dest.Contexts[uniqueContextName] = newContext
-
-        if src.CurrentContext == key {
-            dest.CurrentContext = uniqueContextName
+        if cluster, exists := src.Clusters[context.Cluster]; exists {
+            newContext.Cluster = mergeCluster(dest, context.Cluster, cluster, overwriting, report)
+        }
+        if authInfo, exists := src.AuthInfos[context.AuthInfo]; exists {
+            newContext.AuthInfo = mergeAuthInfo(dest, context.AuthInfo, authInfo, overwriting, report)
         }
+        dest.Contexts[uniqueContextName] = newContext
+        written = append(written, uniqueContextName)
     }
-    return nil
+    return written, nil
 }
 
 // makeContextNameUnique ensures the context name is unique in the destination contexts
@@ -365,23 +752,34 @@ func makeContextNameUnique(name string, existingContexts map[string]*api.Context
 
 // saveKubeconfig saves the merged kubeconfig to the specified path
 //
-// It takes a single argument, a pointer to an api.Config object, which is the
-// merged kubeconfig.
+// It takes the transaction the write belongs to and a pointer to an api.Config
+// object, which is the merged kubeconfig.
+//
+// An existing file is patched with patchKubeconfig, so comments, ordering and
+// fields clientcmd does not know survive; only if that is not possible is the
+// whole file rewritten from clientcmd's serialization.
 //
 // The function returns an error if there is a problem writing the file.
-func saveKubeconfig(config *api.Config, path string) error {
+func saveKubeconfig(tx *transaction, config *api.Config, path string) error {
     // Convert the config object to a byte slice
     kubeconfigBytes, err := clientcmd.Write(*config)
     if err != nil {
         return err
     }
 
-    // Write the byte slice to the specified file path
-    err = os.WriteFile(path, kubeconfigBytes, 0600)
-    if err != nil {
-        return err
+    if original, err := os.ReadFile(path); err == nil && len(bytes.TrimSpace(original)) > 0 {
+        patched, err := patchKubeconfig(original, kubeconfigBytes)
+        if err != nil {
+            utils.WarnLogger.Printf("%s Rewriting %s in full, as it could not be patched in place: %v", utils.Iso8601Time(), path, err)
+        } else {
+            kubeconfigBytes = patched
+        }
     }
 
-    // Return success if the file was written correctly
-    return nil
+    if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+        return fmt.Errorf("failed to create kubeconfig directory: %v", err)
+    }
+
+    // Replace the file atomically so it is never left half-written
+    return tx.writeFile(path, kubeconfigBytes, 0600)
 }
@@ -1,9 +1,12 @@
 package kubeconfig
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
 )
 
@@ -222,7 +225,7 @@ func TestMergeKubeconfigs(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := mergeKubeconfigs(tt.destConfig, tt.srcConfig, tt.contextName, tt.imagePath)
+			_, err := mergeKubeconfigs(tt.destConfig, tt.srcConfig, tt.contextName, tt.imagePath, nil)
 			if err != nil {
 				t.Fatalf("mergeKubeconfigs() error = %v", err)
 			}
@@ -244,7 +247,7 @@ func TestMergeKubeconfigsAddsExtensionToExistingContext(t *testing.T) {
 	destConfig := createTestConfig(testClusterNameMerge, testServerURL2, testCAData2, testUserName, testToken, testContextName, nil)
 	srcConfig := createTestConfig(testClusterNameMerge, testServerURL2, testCAData2, testUserName, testToken, testContextName, nil)
 
-	if err := mergeKubeconfigs(destConfig, srcConfig, testContextName, testIconPath); err != nil {
+	if _, err := mergeKubeconfigs(destConfig, srcConfig, testContextName, testIconPath, nil); err != nil {
 		t.Fatalf("mergeKubeconfigs() error = %v", err)
 	}
 
@@ -269,6 +272,93 @@ func TestMergeKubeconfigsAddsExtensionToExistingContext(t *testing.T) {
 	}
 }
 
+// TestMergeKubeconfigsRefreshesRotatedCredentials verifies that an existing
+// context for the same cluster picks up changed credentials without its name
+// or namespace changing, and that unrelated users are left alone.
+func TestMergeKubeconfigsRefreshesRotatedCredentials(t *testing.T) {
+	tests := []struct {
+		name        string
+		destUser    string
+		srcToken    string
+		wantToken   string
+		wantUpdated bool
+	}{
+		{name: "rotated token", destUser: testUserName, srcToken: "rotated-token", wantToken: "rotated-token", wantUpdated: true},
+		{name: "unchanged token", destUser: testUserName, srcToken: testToken, wantToken: testToken},
+		{name: "hand-written user", destUser: "my-user", srcToken: "rotated-token", wantToken: testToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destConfig := createTestConfig(testClusterNameMerge, testServerURL, testCAData, tt.destUser, testToken, testContextName, nil)
+			destConfig.Contexts[testContextName].Namespace = "payments"
+			srcConfig := createTestConfig(testClusterNameMerge, testServerURL, testCAData, testUserName, tt.srcToken, testContextName, nil)
+
+			report := &Report{}
+			if _, err := mergeKubeconfigs(destConfig, srcConfig, testContextName, testIconPath, report); err != nil {
+				t.Fatalf("mergeKubeconfigs() error = %v", err)
+			}
+
+			context := destConfig.Contexts[testContextName]
+			if context.Namespace != "payments" || context.AuthInfo != tt.destUser {
+				t.Errorf("expected context to be kept as is, got %+v", context)
+			}
+			if got := destConfig.AuthInfos[tt.destUser].Token; got != tt.wantToken {
+				t.Errorf("expected token %q, got %q", tt.wantToken, got)
+			}
+			if got := report.Count(ActionUpdated); (got == 1) != tt.wantUpdated {
+				t.Errorf("expected updated=%v, got %d updated in %+v", tt.wantUpdated, got, report.Changes)
+			}
+		})
+	}
+}
+
+// TestMergeKubeconfigsRenamesCollidingEntries verifies that incoming cluster
+// and user entries whose keys are taken by different entries get unique keys,
+// that the merged context refers to them, and that a later merge of the same
+// entries finds them again instead of adding more copies.
+func TestMergeKubeconfigsRenamesCollidingEntries(t *testing.T) {
+	destConfig := createTestConfig("kubernetes", "https://a.example.com:6443", "ca-a", "admin", "token-a", "cluster-a", nil)
+	srcConfig := createTestConfig("kubernetes", "https://b.example.com:6443", "ca-b", "admin", "token-b", "kubernetes-admin@kubernetes", nil)
+
+	report := &Report{}
+	if _, err := mergeKubeconfigs(destConfig, srcConfig, "cluster-b", testIconPath, report); err != nil {
+		t.Fatalf("mergeKubeconfigs() error = %v", err)
+	}
+
+	if got := destConfig.Clusters["kubernetes"].Server; got != "https://a.example.com:6443" {
+		t.Errorf("expected existing cluster to be kept, got server %q", got)
+	}
+	if got := destConfig.AuthInfos["admin"].Token; got != "token-a" {
+		t.Errorf("expected existing user to be kept, got token %q", got)
+	}
+
+	context := destConfig.Contexts["cluster-b"]
+	if context.Cluster != "kubernetes-1" || context.AuthInfo != "admin-1" {
+		t.Fatalf("expected context to refer to renamed entries, got cluster %q user %q", context.Cluster, context.AuthInfo)
+	}
+	if got := destConfig.Clusters["kubernetes-1"].Server; got != "https://b.example.com:6443" {
+		t.Errorf("expected renamed cluster to hold the new server, got %q", got)
+	}
+	if got := destConfig.AuthInfos["admin-1"].Token; got != "token-b" {
+		t.Errorf("expected renamed user to hold the new token, got %q", got)
+	}
+	if report.Count(ActionRenamed) != 2 {
+		t.Errorf("expected the cluster and user to be reported as renamed, got %+v", report.Changes)
+	}
+
+	// Another context for the same source reuses the renamed entries.
+	if _, err := mergeKubeconfigs(destConfig, srcConfig, "cluster-b-alias", testIconPath, nil); err != nil {
+		t.Fatalf("mergeKubeconfigs() error = %v", err)
+	}
+	if len(destConfig.Clusters) != 2 || len(destConfig.AuthInfos) != 2 {
+		t.Errorf("expected renamed entries to be reused, got clusters %v users %v", destConfig.Clusters, destConfig.AuthInfos)
+	}
+	if alias := destConfig.Contexts["cluster-b-alias"]; alias.Cluster != "kubernetes-1" || alias.AuthInfo != "admin-1" {
+		t.Errorf("expected alias to refer to the renamed entries, got %+v", alias)
+	}
+}
+
 // TestMakeContextNameUnique tests the makeContextNameUnique function
 func TestMakeContextNameUnique(t *testing.T) {
 	tests := []struct {
@@ -335,3 +425,47 @@ func TestMakeContextNameUnique(t *testing.T) {
 		})
 	}
 }
+
+// TestMergeConfigsLeavesOtherFilesAlone verifies that MergeConfigs only merges
+// the configs it is given and never reads, rewrites or deletes unrelated YAML
+// files a user keeps in ~/.kube.
+func TestMergeConfigsLeavesOtherFilesAlone(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	kubeDir := filepath.Join(home, ".kube")
+	if err := os.MkdirAll(kubeDir, 0700); err != nil {
+		t.Fatalf("failed to create .kube dir: %v", err)
+	}
+
+	userFile := filepath.Join(kubeDir, "personal-kubeconfig.yaml")
+	userContent := "apiVersion: v1\nkind: Config\ncontexts:\n- name: personal\n  context:\n    cluster: personal\n"
+	if err := os.WriteFile(userFile, []byte(userContent), 0600); err != nil {
+		t.Fatalf("failed to write user file: %v", err)
+	}
+
+	downloaded := []DownloadedConfig{{
+		Provider: "Linode",
+		Config:   createTestConfig(testClusterNameMerge, testServerURL, testCAData, testUserName, testToken, testContextName, nil),
+	}}
+	downloaded[0].Cluster.ContextName = "lke-prod"
+
+	if _, err := MergeConfigs(&DownloadResult{Configs: downloaded}, MergeOptions{}); err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+
+	content, err := os.ReadFile(userFile)
+	if err != nil || string(content) != userContent {
+		t.Errorf("expected %s to be left untouched, got %q (err %v)", userFile, content, err)
+	}
+
+	merged, err := clientcmd.LoadFromFile(filepath.Join(kubeDir, "config"))
+	if err != nil {
+		t.Fatalf("failed to load merged config: %v", err)
+	}
+	if _, ok := merged.Contexts["lke-prod"]; !ok {
+		t.Errorf("expected context lke-prod in merged config, got %v", merged.Contexts)
+	}
+	if _, ok := merged.Contexts["personal"]; ok {
+		t.Error("expected unrelated file not to be merged")
+	}
+}
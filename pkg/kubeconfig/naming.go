@@ -0,0 +1,198 @@
+package kubeconfig
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"kubectm/pkg/utils"
+)
+
+// defaultNamingRule is the key in the naming configuration whose rule applies
+// to providers without a rule of their own.
+const defaultNamingRule = "default"
+
+// maxNameLength bounds rendered names; it matches the longest Kubernetes
+// object name.
+const maxNameLength = 253
+
+// NamingRule holds Go templates for the context, cluster and user names given
+// to a provider's clusters. An empty template keeps the provider's name.
+type NamingRule struct {
+	Context string `json:"context,omitempty"`
+	Cluster string `json:"cluster,omitempty"`
+	User    string `json:"user,omitempty"`
+}
+
+// NameFields are the fields available to naming templates, for example
+// {{.Name}}@{{.Region}} or {{.Account}}-{{index .Tags "env"}}-{{.Name}}.
+type NameFields struct {
+	Provider string
+	ID       string
+	Name     string
+	Region   string
+	Account  string
+	Version  string
+	Tags     map[string]string
+}
+
+// namingFuncs are the functions available to naming templates.
+var namingFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"default": func(def, s string) string {
+		if s == "" {
+			return def
+		}
+		return s
+	},
+}
+
+// namingTemplates are the parsed templates of a NamingRule. A nil template
+// keeps the provider's name.
+type namingTemplates struct {
+	context, cluster, user *template.Template
+}
+
+// Namer renders context, cluster and user names from per-provider rules.
+// A nil or empty Namer keeps every provider's own names.
+type Namer struct {
+	rules map[string]namingTemplates
+}
+
+// NewNamer parses naming rules keyed by provider name, matched
+// case-insensitively, or "default" for every other provider.
+func NewNamer(rules map[string]NamingRule) (*Namer, error) {
+	namer := &Namer{rules: make(map[string]namingTemplates, len(rules))}
+	for name, rule := range rules {
+		var parsed namingTemplates
+		for _, field := range []struct {
+			kind string
+			text string
+			dest **template.Template
+		}{
+			{"context", rule.Context, &parsed.context},
+			{"cluster", rule.Cluster, &parsed.cluster},
+			{"user", rule.User, &parsed.user},
+		} {
+			if field.text == "" {
+				continue
+			}
+			tmpl, err := template.New(name + "." + field.kind).Funcs(namingFuncs).Option("missingkey=zero").Parse(field.text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s naming template for %s: %v", field.kind, name, err)
+			}
+			*field.dest = tmpl
+		}
+		namer.rules[strings.ToLower(name)] = parsed
+	}
+	return namer, nil
+}
+
+// LoadNamer returns a Namer for the naming rules in ~/.kubectm/config.json.
+func LoadNamer() (*Namer, error) {
+	config, err := loadKubectmConfig()
+	if err != nil {
+		return nil, err
+	}
+	return NewNamer(config.Naming)
+}
+
+// rule returns the templates that apply to a provider.
+func (n *Namer) rule(providerName string) namingTemplates {
+	if n == nil {
+		return namingTemplates{}
+	}
+	if rule, ok := n.rules[strings.ToLower(providerName)]; ok {
+		return rule
+	}
+	return n.rules[defaultNamingRule]
+}
+
+// renderName executes tmpl with fields, returning fallback if there is no
+// template. A rendered name that is empty, too long or contains whitespace
+// or control characters is an error.
+func renderName(tmpl *template.Template, fields NameFields, fallback string) (string, error) {
+	if tmpl == nil {
+		return fallback, nil
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, fields); err != nil {
+		return "", fmt.Errorf("failed to render %s: %v", tmpl.Name(), err)
+	}
+	name := b.String()
+	if !validName(name) {
+		return "", fmt.Errorf("%s rendered an invalid name %q", tmpl.Name(), name)
+	}
+	return name, nil
+}
+
+// validName reports whether name is usable as a context, cluster or user
+// name: non-empty, not too long and free of whitespace and control
+// characters.
+func validName(name string) bool {
+	return name != "" && len(name) <= maxNameLength && strings.IndexFunc(name, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) < 0
+}
+
+// keyRename renames an entry of a downloaded config.
+type keyRename struct {
+	from, to string
+}
+
+// renderedNames are the names chosen for one downloaded cluster.
+type renderedNames struct {
+	context string
+	// clusters and users rename the downloaded config's keys.
+	clusters []keyRename
+	users    []keyRename
+}
+
+// names renders the context, cluster and user names for a downloaded config.
+// If a template fails, the provider's names are kept for that cluster.
+func (n *Namer) names(d DownloadedConfig) renderedNames {
+	fields := NameFields{
+		Provider: d.Provider,
+		ID:       d.Cluster.ID,
+		Name:     d.Cluster.Name,
+		Region:   d.Cluster.Region,
+		Account:  d.Account,
+		Version:  d.Cluster.Version,
+		Tags:     d.Cluster.Tags,
+	}
+	if fields.Tags == nil {
+		fields.Tags = map[string]string{}
+	}
+	rule := n.rule(d.Provider)
+
+	names := renderedNames{context: d.Cluster.ContextName}
+	context, err := renderName(rule.context, fields, d.Cluster.ContextName)
+	if err != nil {
+		utils.WarnLogger.Printf("%s Keeping the default names for %s cluster %s: %v", utils.Iso8601Time(), d.Provider, d.Cluster.Name, err)
+		return names
+	}
+
+	for _, key := range sortedKeys(d.Config.Contexts) {
+		ctx := d.Config.Contexts[key]
+		if ctx == nil {
+			continue
+		}
+		cluster, err := renderName(rule.cluster, fields, ctx.Cluster)
+		if err == nil {
+			var user string
+			if user, err = renderName(rule.user, fields, ctx.AuthInfo); err == nil {
+				names.clusters = append(names.clusters, keyRename{from: ctx.Cluster, to: cluster})
+				names.users = append(names.users, keyRename{from: ctx.AuthInfo, to: user})
+				continue
+			}
+		}
+		utils.WarnLogger.Printf("%s Keeping the default names for %s cluster %s: %v", utils.Iso8601Time(), d.Provider, d.Cluster.Name, err)
+		return renderedNames{context: d.Cluster.ContextName}
+	}
+	names.context = context
+	return names
+}
@@ -0,0 +1,124 @@
+package kubeconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kubectm/pkg/provider"
+)
+
+func namingTestConfig(providerName string, cluster provider.Cluster) DownloadedConfig {
+	return DownloadedConfig{
+		Provider: providerName,
+		Account:  "staging",
+		Cluster:  cluster,
+		Config:   createTestConfig(cluster.ContextName, testServerURL, testCAData, cluster.ContextName, testToken, cluster.ContextName, nil),
+	}
+}
+
+func TestNamerNames(t *testing.T) {
+	eks := provider.Cluster{
+		ID:          "us-east-1/prod",
+		Name:        "prod",
+		Region:      "us-east-1",
+		ContextName: "prod@us-east-1",
+		Version:     "1.31",
+		Tags:        map[string]string{"team": "Payments"},
+	}
+
+	tests := []struct {
+		name        string
+		rules       map[string]NamingRule
+		wantContext string
+		wantCluster string
+		wantUser    string
+	}{
+		{
+			name:        "no rules keeps provider names",
+			wantContext: "prod@us-east-1",
+			wantCluster: "prod@us-east-1",
+			wantUser:    "prod@us-east-1",
+		},
+		{
+			name: "provider rule",
+			rules: map[string]NamingRule{
+				"aws": {
+					Context: `{{.Account}}-{{.Name}}-{{.Region}}`,
+					Cluster: `eks-{{.Name}}`,
+					User:    `{{.Name}}-{{.Version}}`,
+				},
+			},
+			wantContext: "staging-prod-us-east-1",
+			wantCluster: "eks-prod",
+			wantUser:    "prod-1.31",
+		},
+		{
+			name: "default rule with functions",
+			rules: map[string]NamingRule{
+				"default": {Context: `{{index .Tags "team" | lower}}/{{.Name | upper}}/{{index .Tags "env" | default "none"}}`},
+			},
+			wantContext: "payments/PROD/none",
+			wantCluster: "prod@us-east-1",
+			wantUser:    "prod@us-east-1",
+		},
+		{
+			name:        "invalid rendered name keeps provider names",
+			rules:       map[string]NamingRule{"AWS": {Context: `{{index .Tags "missing"}}`, Cluster: "eks-{{.Name}}"}},
+			wantContext: "prod@us-east-1",
+			wantCluster: "prod@us-east-1",
+			wantUser:    "prod@us-east-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namer, err := NewNamer(tt.rules)
+			if err != nil {
+				t.Fatalf("NewNamer() error = %v", err)
+			}
+			result := &DownloadResult{Configs: []DownloadedConfig{namingTestConfig("AWS", eks)}}
+			RenameConfigs(result, namer)
+
+			d := result.Configs[0]
+			if d.Cluster.ContextName != tt.wantContext {
+				t.Errorf("context name = %q, want %q", d.Cluster.ContextName, tt.wantContext)
+			}
+			context := d.Config.Contexts["prod@us-east-1"]
+			if context.Cluster != tt.wantCluster || d.Config.Clusters[tt.wantCluster] == nil {
+				t.Errorf("cluster = %q (clusters %v), want %q", context.Cluster, d.Config.Clusters, tt.wantCluster)
+			}
+			if context.AuthInfo != tt.wantUser || d.Config.AuthInfos[tt.wantUser] == nil {
+				t.Errorf("user = %q (users %v), want %q", context.AuthInfo, d.Config.AuthInfos, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestNewNamerRejectsInvalidTemplate(t *testing.T) {
+	if _, err := NewNamer(map[string]NamingRule{"AWS": {Context: "{{.Name"}}); err == nil {
+		t.Error("expected error for an unparseable template")
+	}
+}
+
+func TestLoadNamer(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".kubectm")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatalf("failed to create .kubectm dir: %v", err)
+	}
+	config := `{"naming": {"Linode": {"context": "lke-{{.Name}}"}}}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	namer, err := LoadNamer()
+	if err != nil {
+		t.Fatalf("LoadNamer() error = %v", err)
+	}
+	names := namer.names(namingTestConfig("Linode", provider.Cluster{ID: "1", Name: "prod", ContextName: "prod"}))
+	if names.context != "lke-prod" {
+		t.Errorf("expected context lke-prod, got %q", names.context)
+	}
+}
@@ -0,0 +1,450 @@
+package kubeconfig
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	yaml "go.yaml.in/yaml/v3"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// kubeconfigSections are the named lists of a kubeconfig that kubectm
+// patches entry by entry.
+var kubeconfigSections = []string{"clusters", "users", "contexts"}
+
+// currentContextKey is the top-level key holding the current context.
+const currentContextKey = "current-context"
+
+// patchKubeconfig updates the kubeconfig text original so that it holds the
+// content of generated, the clientcmd serialization of the merged config,
+// touching only what changed:
+//
+//   - cluster, user and context entries that did not change keep their
+//     original bytes, including comments and formatting;
+//   - changed entries are rewritten in place, keeping the original value of
+//     every field that did not change and any field clientcmd does not know;
+//   - removed entries are cut out, and new entries are appended to their list
+//     in clientcmd's formatting;
+//   - current-context is rewritten only if it changed.
+//
+// Everything else in the file is left byte-for-byte intact. clientcmd is only
+// used to parse and validate: the result must load to exactly the content of
+// generated, otherwise an error is returned and the caller writes generated
+// instead.
+func patchKubeconfig(original, generated []byte) ([]byte, error) {
+	loaded, err := clientcmd.Load(original)
+	if err != nil {
+		return nil, fmt.Errorf("existing kubeconfig cannot be parsed: %v", err)
+	}
+	normalized, err := clientcmd.Write(*loaded)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(normalized, generated) {
+		return original, nil
+	}
+
+	orig, err := parseYAMLText(original)
+	if err != nil {
+		return nil, err
+	}
+	before, err := parseYAMLText(normalized)
+	if err != nil {
+		return nil, err
+	}
+	after, err := parseYAMLText(generated)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &yamlPatch{text: orig}
+	for _, key := range kubeconfigSections {
+		if err := p.section(key, before, after); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.currentContext(before, after); err != nil {
+		return nil, err
+	}
+	patched := p.apply()
+
+	// Anything the patch could not express, such as a change outside the
+	// entry lists, shows up here and falls back to a full rewrite.
+	check, err := clientcmd.Load(patched)
+	if err != nil {
+		return nil, fmt.Errorf("patched kubeconfig cannot be parsed: %v", err)
+	}
+	if checked, err := clientcmd.Write(*check); err != nil || !bytes.Equal(checked, generated) {
+		return nil, fmt.Errorf("patched kubeconfig does not match the merged kubeconfig")
+	}
+	return patched, nil
+}
+
+// yamlText is a YAML document and the lines it was parsed from.
+type yamlText struct {
+	// lines hold the text, each with its trailing newline.
+	lines []string
+	root  *yaml.Node
+}
+
+// parseYAMLText parses data, which must be a single block-style mapping.
+func parseYAMLText(data []byte) (*yamlText, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig YAML: %v", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode || doc.Content[0].Style&yaml.FlowStyle != 0 {
+		return nil, fmt.Errorf("kubeconfig is not a block-style YAML mapping")
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return &yamlText{lines: lines, root: doc.Content[0]}, nil
+}
+
+// lookup returns the index in the root mapping of key's key node, and its
+// value, or -1 and nil if the key is absent.
+func (t *yamlText) lookup(key string) (int, *yaml.Node) {
+	for i := 0; i+1 < len(t.root.Content); i += 2 {
+		if t.root.Content[i].Value == key {
+			return i, t.root.Content[i+1]
+		}
+	}
+	return -1, nil
+}
+
+// trimEnd moves end back over trailing blank and comment lines, but not
+// before start, so comments between entries stay where they are.
+func (t *yamlText) trimEnd(start, end int) int {
+	for end > start {
+		line := strings.TrimSpace(t.lines[end-1])
+		if line != "" && !strings.HasPrefix(line, "#") {
+			break
+		}
+		end--
+	}
+	return end
+}
+
+// keyRange returns the lines [start, end) of the root key at index i and its
+// value, without trailing comments.
+func (t *yamlText) keyRange(i int) (int, int) {
+	start, end := t.root.Content[i].Line-1, len(t.lines)
+	if i+2 < len(t.root.Content) {
+		end = t.root.Content[i+2].Line - 1
+	}
+	return start, t.trimEnd(start, end)
+}
+
+// listEntry is an entry of a block list: its node, name and lines.
+type listEntry struct {
+	node       *yaml.Node
+	name       string
+	start, end int
+	// dash is the column of the entry's "-".
+	dash int
+}
+
+// entries returns the entries of the block list under the root key at index
+// i. ok is false if the value is not a non-empty block list whose entries
+// each start on the line of their "-".
+func (t *yamlText) entries(i int) ([]listEntry, bool) {
+	seq := t.root.Content[i+1]
+	if seq.Kind != yaml.SequenceNode || seq.Style&yaml.FlowStyle != 0 || len(seq.Content) == 0 {
+		return nil, false
+	}
+	_, sectionEnd := t.keyRange(i)
+
+	entries := make([]listEntry, len(seq.Content))
+	for j, node := range seq.Content {
+		if node.Kind != yaml.MappingNode || node.Line < 1 || node.Line > len(t.lines) {
+			return nil, false
+		}
+		line := t.lines[node.Line-1]
+		if node.Column-1 > len(line) {
+			return nil, false
+		}
+		dash := strings.LastIndex(line[:node.Column-1], "-")
+		if dash < 0 || strings.TrimSpace(line[:dash]) != "" {
+			return nil, false
+		}
+		entries[j] = listEntry{node: node, name: mappingScalar(node, "name"), start: node.Line - 1, dash: dash}
+	}
+	for j := range entries {
+		end := sectionEnd
+		if j+1 < len(entries) {
+			end = entries[j+1].start
+		}
+		entries[j].end = t.trimEnd(entries[j].start, end)
+	}
+	return entries, true
+}
+
+// mappingScalar returns the scalar value under key in a mapping node.
+func mappingScalar(node *yaml.Node, key string) string {
+	if value := mappingValue(node, key); value != nil && value.Kind == yaml.ScalarNode {
+		return value.Value
+	}
+	return ""
+}
+
+// mappingValue returns the value under key in a mapping node, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// yamlPatch collects line edits to a yamlText.
+type yamlPatch struct {
+	text  *yamlText
+	edits []lineEdit
+}
+
+// lineEdit replaces lines [start, end) with text; start == end inserts.
+type lineEdit struct {
+	start, end int
+	text       string
+}
+
+func (p *yamlPatch) replace(start, end int, text string) {
+	p.edits = append(p.edits, lineEdit{start: start, end: end, text: text})
+}
+
+// apply returns the text with every edit made.
+func (p *yamlPatch) apply() []byte {
+	lines := append([]string(nil), p.text.lines...)
+	if n := len(lines); n > 0 && !strings.HasSuffix(lines[n-1], "\n") {
+		lines[n-1] += "\n"
+	}
+	// Edit from the bottom up so earlier line numbers stay valid; at the same
+	// line, replace before inserting so the insertion lands in front.
+	sort.SliceStable(p.edits, func(i, j int) bool {
+		if p.edits[i].start != p.edits[j].start {
+			return p.edits[i].start > p.edits[j].start
+		}
+		return p.edits[i].end > p.edits[j].end
+	})
+	for _, e := range p.edits {
+		replaced := append([]string{e.text}, lines[e.end:]...)
+		lines = append(lines[:e.start], replaced...)
+	}
+	return []byte(strings.Join(lines, ""))
+}
+
+// section patches the list under key from its content in before to its
+// content in after, both clientcmd serializations.
+func (p *yamlPatch) section(key string, before, after *yamlText) error {
+	beforeEntries := namedEntries(before, key)
+	afterIndex, afterSeq := after.lookup(key)
+	afterEntries := namedEntries(after, key)
+	if sameEntries(beforeEntries, afterEntries) {
+		return nil
+	}
+
+	i, value := p.text.lookup(key)
+	entries, ok := []listEntry(nil), false
+	if value != nil {
+		entries, ok = p.text.entries(i)
+	}
+	if !ok {
+		// No block list to patch, e.g. "clusters: []": write the whole
+		// section as clientcmd does.
+		text := ""
+		if afterSeq != nil {
+			start, end := after.keyRange(afterIndex)
+			text = strings.Join(after.lines[start:end], "")
+		}
+		if value == nil {
+			p.replace(len(p.text.lines), len(p.text.lines), text)
+			return nil
+		}
+		start, end := p.text.keyRange(i)
+		p.replace(start, end, text)
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		seen[entry.name] = true
+		beforeEntry, known := beforeEntries[entry.name]
+		afterEntry, kept := afterEntries[entry.name]
+		switch {
+		case !known:
+			// Not an entry clientcmd read, such as one without a name.
+		case !kept:
+			p.replace(entry.start, entry.end, "")
+		case !equalNodes(beforeEntry.node, afterEntry.node):
+			text, err := encodeEntry(mergeNode(entry.node, beforeEntry.node, afterEntry.node), entry.dash)
+			if err != nil {
+				return err
+			}
+			p.replace(entry.start, entry.end, text)
+		}
+	}
+
+	var added strings.Builder
+	last := entries[len(entries)-1]
+	for _, entry := range sortedEntries(afterEntries) {
+		if seen[entry.name] {
+			continue
+		}
+		added.WriteString(indentLines(strings.Join(after.lines[entry.start:entry.end], ""), last.dash-entry.dash))
+	}
+	if added.Len() > 0 {
+		p.replace(last.end, last.end, added.String())
+	}
+	return nil
+}
+
+// currentContext patches current-context if it changed.
+func (p *yamlPatch) currentContext(before, after *yamlText) error {
+	_, beforeValue := before.lookup(currentContextKey)
+	afterIndex, afterValue := after.lookup(currentContextKey)
+	if equalNodes(beforeValue, afterValue) {
+		return nil
+	}
+
+	text := ""
+	if afterValue != nil {
+		start, end := after.keyRange(afterIndex)
+		text = strings.Join(after.lines[start:end], "")
+	}
+	i, value := p.text.lookup(currentContextKey)
+	if value == nil {
+		p.replace(len(p.text.lines), len(p.text.lines), text)
+		return nil
+	}
+	start, end := p.text.keyRange(i)
+	if value.LineComment != "" && end == start+1 {
+		text = strings.TrimSuffix(text, "\n") + " " + value.LineComment + "\n"
+	}
+	p.replace(start, end, text)
+	return nil
+}
+
+// namedEntries returns the entries of the list under key in a clientcmd
+// serialization, by name.
+func namedEntries(t *yamlText, key string) map[string]listEntry {
+	named := map[string]listEntry{}
+	i, _ := t.lookup(key)
+	if i < 0 {
+		return named
+	}
+	entries, _ := t.entries(i)
+	for _, entry := range entries {
+		named[entry.name] = entry
+	}
+	return named
+}
+
+// sortedEntries returns entries in the order they appear in their file.
+func sortedEntries(entries map[string]listEntry) []listEntry {
+	sorted := make([]listEntry, 0, len(entries))
+	for _, entry := range entries {
+		sorted = append(sorted, entry)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].start < sorted[j].start })
+	return sorted
+}
+
+// sameEntries reports whether two lists hold the same entries.
+func sameEntries(a, b map[string]listEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, entry := range a {
+		other, ok := b[name]
+		if !ok || !equalNodes(entry.node, other.node) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalNodes reports whether two nodes hold the same data, whatever their
+// formatting and comments. Two nil nodes are equal.
+func equalNodes(a, b *yaml.Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	var va, vb interface{}
+	if a.Decode(&va) != nil || b.Decode(&vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// mergeNode returns orig, a node from the user's file, changed from before
+// to after, both from clientcmd serializations. Mapping keys whose value did
+// not change keep orig's node, with its comments and formatting; changed
+// keys take after's; keys after dropped are removed if clientcmd knew them,
+// i.e. they are in before, and kept otherwise, as fields clientcmd does not
+// know. Nested mappings are merged the same way.
+func mergeNode(orig, before, after *yaml.Node) *yaml.Node {
+	if orig == nil || before == nil || orig.Kind != yaml.MappingNode || before.Kind != yaml.MappingNode || after.Kind != yaml.MappingNode {
+		return after
+	}
+	merged := *orig
+	merged.Content = nil
+	for i := 0; i+1 < len(orig.Content); i += 2 {
+		key, value := orig.Content[i], orig.Content[i+1]
+		beforeValue, afterValue := mappingValue(before, key.Value), mappingValue(after, key.Value)
+		switch {
+		case afterValue == nil && beforeValue != nil:
+			continue
+		case afterValue == nil || equalNodes(beforeValue, afterValue):
+		default:
+			value = mergeNode(value, beforeValue, afterValue)
+		}
+		merged.Content = append(merged.Content, key, value)
+	}
+	for i := 0; i+1 < len(after.Content); i += 2 {
+		if mappingValue(orig, after.Content[i].Value) == nil {
+			merged.Content = append(merged.Content, after.Content[i], after.Content[i+1])
+		}
+	}
+	return &merged
+}
+
+// encodeEntry serializes a list entry with its "-" at column dash. Comments
+// above the entry stay in the file, so they are not serialized with it.
+func encodeEntry(entry *yaml.Node, dash int) (string, error) {
+	node := *entry
+	node.HeadComment, node.FootComment = "", ""
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{&node}}); err != nil {
+		return "", fmt.Errorf("failed to encode kubeconfig entry: %v", err)
+	}
+	if err := enc.Close(); err != nil {
+		return "", fmt.Errorf("failed to encode kubeconfig entry: %v", err)
+	}
+	return indentLines(buf.String(), dash), nil
+}
+
+// indentLines indents every non-empty line of text by n spaces.
+func indentLines(text string, n int) string {
+	if n <= 0 {
+		return text
+	}
+	lines := strings.SplitAfter(text, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			lines[i] = strings.Repeat(" ", n) + line
+		}
+	}
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,133 @@
+package kubeconfig
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// handWrittenKubeconfig is a kubeconfig as a person might keep it in their
+// dotfiles: commented, in their own order, with a field clientcmd drops.
+const handWrittenKubeconfig = `# Managed in dotfiles.
+apiVersion: v1
+kind: Config
+current-context: personal # default
+
+clusters:
+  # My homelab.
+  - name: personal
+    cluster:
+      server: https://personal.example.com
+  - name: lke1
+    cluster:
+      server: https://lke1.example.com
+      x-team-note: keep me
+
+users:
+  - name: me
+    user:
+      token: mine
+  - name: lke-admin
+    user:
+      token: old-token
+      x-rotated-by: ops
+
+contexts:
+  - name: personal
+    context:
+      cluster: personal
+      user: me
+  - name: lke-old
+    context:
+      cluster: lke1
+      user: lke-admin
+`
+
+// patchTestConfig loads original, lets change modify the config, and returns
+// the patched file.
+func patchTestConfig(t *testing.T, original string, change func(*api.Config)) string {
+	t.Helper()
+	config, err := clientcmd.Load([]byte(original))
+	if err != nil {
+		t.Fatalf("failed to load kubeconfig: %v", err)
+	}
+	change(config)
+	generated, err := clientcmd.Write(*config)
+	if err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+	patched, err := patchKubeconfig([]byte(original), generated)
+	if err != nil {
+		t.Fatalf("patchKubeconfig() error = %v", err)
+	}
+	return string(patched)
+}
+
+func TestPatchKubeconfigUnchanged(t *testing.T) {
+	if got := patchTestConfig(t, handWrittenKubeconfig, func(*api.Config) {}); got != handWrittenKubeconfig {
+		t.Errorf("expected an unchanged kubeconfig to keep its bytes, got:\n%s", got)
+	}
+}
+
+func TestPatchKubeconfig(t *testing.T) {
+	got := patchTestConfig(t, handWrittenKubeconfig, func(config *api.Config) {
+		config.AuthInfos["lke-admin"].Token = "new-token"
+		delete(config.Contexts, "lke-old")
+		config.Contexts["lke-prod"] = &api.Context{Cluster: "lke1", AuthInfo: "lke-admin"}
+		config.Clusters["eks"] = &api.Cluster{Server: "https://eks.example.com"}
+		config.CurrentContext = "lke-prod"
+	})
+
+	// Untouched entries and comments keep their bytes.
+	for _, kept := range []string{
+		"# Managed in dotfiles.\napiVersion: v1\nkind: Config\n",
+		"  # My homelab.\n  - name: personal\n    cluster:\n      server: https://personal.example.com\n",
+		"  - name: lke1\n    cluster:\n      server: https://lke1.example.com\n      x-team-note: keep me\n",
+		"  - name: me\n    user:\n      token: mine\n",
+		"  - name: personal\n    context:\n      cluster: personal\n      user: me\n",
+	} {
+		if !strings.Contains(got, kept) {
+			t.Errorf("expected the patched kubeconfig to keep %q, got:\n%s", kept, got)
+		}
+	}
+
+	// The changed user keeps its unknown field and its place.
+	if !strings.Contains(got, "token: new-token") || !strings.Contains(got, "x-rotated-by: ops") {
+		t.Errorf("expected the rotated token with the unknown field kept, got:\n%s", got)
+	}
+	if strings.Index(got, "name: me") > strings.Index(got, "name: lke-admin") {
+		t.Errorf("expected the entries to keep their order, got:\n%s", got)
+	}
+
+	if strings.Contains(got, "lke-old") {
+		t.Errorf("expected the removed context to be cut out, got:\n%s", got)
+	}
+	if !strings.Contains(got, "  - context:\n      cluster: lke1\n      user: lke-admin\n    name: lke-prod\n") {
+		t.Errorf("expected the new context appended at the list's indentation, got:\n%s", got)
+	}
+	if !strings.Contains(got, "current-context: lke-prod # default\n") {
+		t.Errorf("expected current-context to change with its comment kept, got:\n%s", got)
+	}
+}
+
+func TestPatchKubeconfigFlowLists(t *testing.T) {
+	got := patchTestConfig(t, "# empty\n"+testKubeconfigContent, func(config *api.Config) {
+		config.Clusters["lke1"] = &api.Cluster{Server: "https://lke1.example.com"}
+	})
+	if !strings.HasPrefix(got, "# empty\napiVersion: v1\n") || !strings.Contains(got, "clusters:\n- cluster:\n    server: https://lke1.example.com\n  name: lke1\n") {
+		t.Errorf("expected the empty list to be replaced in clientcmd's format, got:\n%s", got)
+	}
+	if !strings.Contains(got, "contexts: []\n") {
+		t.Errorf("expected untouched empty lists to stay, got:\n%s", got)
+	}
+}
+
+func TestPatchKubeconfigRejectsUnpatchable(t *testing.T) {
+	config, _ := clientcmd.Load([]byte(testKubeconfigContent))
+	generated, _ := clientcmd.Write(*config)
+	if _, err := patchKubeconfig([]byte("{apiVersion: v1, kind: Config, clusters: [], contexts: [], users: [], preferences: {colors: true}}"), generated); err == nil {
+		t.Error("expected a flow-style kubeconfig with other changes to be rejected")
+	}
+}
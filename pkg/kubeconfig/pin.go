@@ -0,0 +1,272 @@
+package kubeconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"kubectm/pkg/utils"
+
+	"github.com/fatih/color"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// pinSet holds the names and glob patterns of pinned contexts. kubectm never
+// modifies, renames or prunes a pinned context, nor the cluster and user
+// entries it refers to.
+type pinSet []string
+
+// matches reports whether the named context is pinned. In a pattern, "*"
+// matches any run of characters, "/" and ":" included, and "?" any single
+// character, so a plain name matches only itself.
+func (p pinSet) matches(name string) bool {
+	for _, pattern := range p {
+		if pattern == name || globPattern(pattern).MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// globPattern compiles a pin pattern into an anchored regular expression.
+func globPattern(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// entries returns the keys of the cluster and user entries pinned contexts
+// in config refer to.
+func (p pinSet) entries(config *api.Config) (clusters, users map[string]bool) {
+	clusters, users = map[string]bool{}, map[string]bool{}
+	for name, context := range config.Contexts {
+		if context != nil && p.matches(name) {
+			clusters[context.Cluster] = true
+			users[context.AuthInfo] = true
+		}
+	}
+	return clusters, users
+}
+
+// loadPins returns the pinned contexts in ~/.kubectm/config.json.
+func loadPins() (pinSet, error) {
+	config, err := loadKubectmConfig()
+	if err != nil {
+		return nil, err
+	}
+	return pinSet(config.Pinned), nil
+}
+
+// validatePin checks that a pin is a usable context name or pattern.
+func validatePin(pattern string) error {
+	if strings.TrimSpace(pattern) == "" || strings.ContainsAny(pattern, "\n\r") {
+		return fmt.Errorf("invalid pin %q", pattern)
+	}
+	return nil
+}
+
+// Pin is a pinned context name or pattern, with the contexts of the target
+// kubeconfig it matches.
+type Pin struct {
+	Pattern  string
+	Contexts []string
+}
+
+// ListPins returns the pinned contexts in ~/.kubectm/config.json, each with
+// the contexts it matches in the target kubeconfig.
+func ListPins() ([]Pin, error) {
+	pins, err := loadPins()
+	if err != nil {
+		return nil, err
+	}
+	var contexts []string
+	if target, err := targetKubeconfig(); err == nil {
+		if config, err := loadKubeconfig(target); err == nil {
+			contexts = sortedKeys(config.Contexts)
+		}
+	}
+
+	listed := make([]Pin, 0, len(pins))
+	for _, pattern := range pins {
+		pin := Pin{Pattern: pattern}
+		for _, name := range contexts {
+			if (pinSet{pattern}).matches(name) {
+				pin.Contexts = append(pin.Contexts, name)
+			}
+		}
+		listed = append(listed, pin)
+	}
+	return listed, nil
+}
+
+// PinContexts adds context names or patterns to the pinned contexts in
+// ~/.kubectm/config.json. Pins already present are left as they are.
+func PinContexts(patterns ...string) error {
+	for _, pattern := range patterns {
+		if err := validatePin(pattern); err != nil {
+			return err
+		}
+	}
+	return updatePins(func(pins pinSet) pinSet {
+		for _, pattern := range patterns {
+			if !containsString(pins, pattern) {
+				pins = append(pins, pattern)
+				utils.ActionLogger.Printf("%s Pinned %s", utils.Iso8601Time(), color.New(color.Bold).Sprint(pattern))
+			}
+		}
+		return pins
+	})
+}
+
+// UnpinContexts removes context names or patterns from the pinned contexts
+// in ~/.kubectm/config.json. It fails if one of them is not pinned.
+func UnpinContexts(patterns ...string) error {
+	return updatePins(func(pins pinSet) pinSet {
+		kept := pinSet{}
+		for _, pin := range pins {
+			if containsString(patterns, pin) {
+				utils.ActionLogger.Printf("%s Unpinned %s", utils.Iso8601Time(), color.New(color.Bold).Sprint(pin))
+				continue
+			}
+			kept = append(kept, pin)
+		}
+		return kept
+	}, patterns...)
+}
+
+// updatePins rewrites the "pinned" list in ~/.kubectm/config.json with
+// update, keeping every other setting as written. Each of required must be
+// pinned beforehand.
+func updatePins(update func(pinSet) pinSet, required ...string) error {
+	return updateSettings(func(settings map[string]json.RawMessage) error {
+		var pins pinSet
+		if raw, ok := settings["pinned"]; ok {
+			if err := json.Unmarshal(raw, &pins); err != nil {
+				return fmt.Errorf("error parsing pinned contexts: %v", err)
+			}
+		}
+		for _, pattern := range required {
+			if !containsString(pins, pattern) {
+				return fmt.Errorf("%s is not pinned", pattern)
+			}
+		}
+
+		pins = update(pins)
+		if len(pins) == 0 {
+			delete(settings, "pinned")
+			return nil
+		}
+		raw, err := json.Marshal(pins)
+		if err != nil {
+			return fmt.Errorf("failed to encode pinned contexts: %v", err)
+		}
+		settings["pinned"] = raw
+		return nil
+	})
+}
+
+// containsString reports whether s is one of values.
+func containsString[S ~[]string](values S, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// reportPinnedDrift leaves a pinned context alone, and reports how the
+// downloaded context, cluster and user differ from the pinned ones, so the
+// user knows when upstream has moved on.
+func reportPinnedDrift(config *api.Config, d DownloadedConfig, name string, report *Report) error {
+	local := config.Contexts[name]
+	var src *api.Context
+	for _, key := range sortedKeys(d.Config.Contexts) {
+		if src = d.Config.Contexts[key]; src != nil {
+			break
+		}
+	}
+
+	var drift []string
+	if src != nil {
+		for _, entry := range []struct {
+			kind          ChangeKind
+			local, remote any
+		}{
+			{KindContext, local, src},
+			{KindCluster, config.Clusters[local.Cluster], d.Config.Clusters[src.Cluster]},
+			{KindUser, config.AuthInfos[local.AuthInfo], d.Config.AuthInfos[src.AuthInfo]},
+		} {
+			fields, err := differingFields(entry.kind, entry.local, entry.remote)
+			if err != nil {
+				return err
+			}
+			for _, field := range fields {
+				drift = append(drift, string(entry.kind)+" "+field)
+			}
+		}
+	}
+
+	if len(drift) == 0 {
+		report.record(KindContext, name, ActionSkipped, "pinned")
+		return nil
+	}
+	utils.WarnLogger.Printf("%s Context %s is pinned; upstream differs in %s", utils.Iso8601Time(), color.New(color.Bold).Sprint(name), strings.Join(drift, ", "))
+	report.record(KindContext, name, ActionSkipped, "pinned, upstream differs in "+strings.Join(drift, ", "))
+	return nil
+}
+
+// differingFields returns the fields that differ between a local entry and
+// its downloaded version. A missing entry on either side differs in nothing.
+func differingFields(kind ChangeKind, local, remote any) ([]string, error) {
+	if isNilEntry(local) || isNilEntry(remote) {
+		return nil, nil
+	}
+	localFields, err := entryFields(kind, local)
+	if err != nil {
+		return nil, err
+	}
+	remoteFields, err := entryFields(kind, remote)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]bool{}
+	for field := range localFields {
+		fields[field] = true
+	}
+	for field := range remoteFields {
+		fields[field] = true
+	}
+	var differing []string
+	for _, field := range sortedKeys(fields) {
+		if fieldHash(localFields, field) != fieldHash(remoteFields, field) {
+			differing = append(differing, field)
+		}
+	}
+	return differing, nil
+}
+
+// isNilEntry reports whether a cluster, user or context entry is missing.
+func isNilEntry(entry any) bool {
+	switch e := entry.(type) {
+	case *api.Cluster:
+		return e == nil
+	case *api.AuthInfo:
+		return e == nil
+	case *api.Context:
+		return e == nil
+	}
+	return entry == nil
+}
@@ -0,0 +1,126 @@
+package kubeconfig
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func TestPinSetMatches(t *testing.T) {
+	pins := pinSet{"prod", "arn:aws:eks:*:cluster/payments-*", "lke-?"}
+	tests := map[string]bool{
+		"prod":   true,
+		"prod-2": false,
+		"arn:aws:eks:us-east-1:123456789012:cluster/payments-api": true,
+		"arn:aws:eks:us-east-1:123456789012:cluster/search":       false,
+		"lke-1":  true,
+		"lke-10": false,
+	}
+	for name, want := range tests {
+		if got := pins.matches(name); got != want {
+			t.Errorf("matches(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestPinContextsKeepsOtherSettings(t *testing.T) {
+	home := setupBackupTestHome(t)
+	configPath := filepath.Join(home, "..", ".kubectm", "config.json")
+	if err := os.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
+		t.Fatalf("failed to create kubectm directory: %v", err)
+	}
+	if err := os.WriteFile(configPath, []byte(`{"prune": "auto", "x-note": {"keep": true}}`), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	if err := PinContexts("prod", "staging-*", "prod"); err != nil {
+		t.Fatalf("PinContexts() error = %v", err)
+	}
+	if err := UnpinContexts("prod"); err != nil {
+		t.Fatalf("UnpinContexts() error = %v", err)
+	}
+	if err := UnpinContexts("dev"); err == nil {
+		t.Error("expected unpinning a context that is not pinned to fail")
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	var settings map[string]any
+	if err := json.Unmarshal(data, &settings); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	if settings["prune"] != "auto" || settings["x-note"] == nil {
+		t.Errorf("expected the other settings to be kept, got %s", data)
+	}
+	if pins, err := loadPins(); err != nil || !reflect.DeepEqual(pins, pinSet{"staging-*"}) {
+		t.Errorf("loadPins() = %v (err %v), want [staging-*]", pins, err)
+	}
+}
+
+func TestMergeConfigsLeavesPinnedContexts(t *testing.T) {
+	kubeDir := setupBackupTestHome(t)
+	configPath := filepath.Join(kubeDir, "config")
+	if _, err := MergeConfigs(&DownloadResult{Configs: []DownloadedConfig{splitDownload("Linode", "1", "lke-prod"), splitDownload("Linode", "2", "lke-dev")}}, MergeOptions{}); err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+	if err := PinContexts("lke-prod"); err != nil {
+		t.Fatalf("PinContexts() error = %v", err)
+	}
+
+	// Upstream rotates the token; a later listing drops the cluster altogether.
+	d := splitDownload("Linode", "1", "lke-prod")
+	d.Config.AuthInfos["lke-prod-admin"].Token = "rotated"
+	report, err := MergeConfigs(&DownloadResult{Configs: []DownloadedConfig{d}}, MergeOptions{})
+	if err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+	config, err := clientcmd.LoadFromFile(configPath)
+	if err != nil {
+		t.Fatalf("failed to load kubeconfig: %v", err)
+	}
+	if config.AuthInfos["lke-prod-admin"].Token != "token-1" {
+		t.Errorf("expected the pinned context's user to keep its token, got %q", config.AuthInfos["lke-prod-admin"].Token)
+	}
+	for _, c := range report.Changes {
+		if c.Name == "lke-prod" && (c.Action != ActionSkipped || !strings.Contains(c.Detail, "pinned, upstream differs in user token")) {
+			t.Errorf("expected the drift from the pinned context to be reported, got %+v", c)
+		}
+	}
+
+	setNow(t, time.Now().Add(48*time.Hour))
+	if _, err := MergeConfigs(&DownloadResult{Listed: map[string]map[string]bool{listingKey("Linode", ""): {}}}, MergeOptions{Prune: PruneOptions{Policy: PruneAuto}}); err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+	config, err = clientcmd.LoadFromFile(configPath)
+	if err != nil {
+		t.Fatalf("failed to load kubeconfig: %v", err)
+	}
+	if config.Contexts["lke-prod"] == nil || config.Clusters["lke-prod"] == nil || config.Contexts["lke-dev"] != nil {
+		t.Errorf("expected only the unpinned stale context to be pruned, got %v", sortedKeys(config.Contexts))
+	}
+}
+
+func TestRenameContextsSkipsPinned(t *testing.T) {
+	rules, err := compileRenameRules([]RenameRule{{Match: `^lke-(.+)$`, Replace: "linode-$1"}})
+	if err != nil {
+		t.Fatalf("compileRenameRules() error = %v", err)
+	}
+	config, state := pruneTestConfig()
+	report := &Report{}
+	renameContexts(config, state, rules, pinSet{"lke-prod"}, RenameOptions{}, report)
+
+	if got := sortedKeys(config.Contexts); strings.Join(got, ",") != "linode-dev,lke-prod,personal" {
+		t.Errorf("expected only the unpinned context to be renamed, got %v", got)
+	}
+	if len(report.Changes) != 2 || report.Changes[1].Detail != "pinned" {
+		t.Errorf("expected the pinned context to be reported as skipped, got %+v", report.Changes)
+	}
+}
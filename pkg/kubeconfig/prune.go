@@ -0,0 +1,213 @@
+package kubeconfig
+
+import (
+	"fmt"
+	"time"
+
+	"kubectm/pkg/utils"
+
+	"github.com/fatih/color"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// PrunePolicy controls what happens to kubectm-created contexts whose cluster
+// no longer exists at the provider.
+type PrunePolicy string
+
+const (
+	// PruneOff reports stale contexts but never removes them.
+	PruneOff PrunePolicy = "off"
+	// PruneConfirm asks before removing stale contexts. Without a way to
+	// ask, nothing is removed.
+	PruneConfirm PrunePolicy = "confirm"
+	// PruneAuto removes stale contexts without asking.
+	PruneAuto PrunePolicy = "auto"
+)
+
+// DefaultPruneGracePeriod is how long a cluster must be missing from complete
+// provider listings before its context is pruned.
+const DefaultPruneGracePeriod = 24 * time.Hour
+
+// PruneOptions configures stale context pruning.
+type PruneOptions struct {
+	Policy PrunePolicy
+	// GracePeriod is how long a cluster must have been missing before its
+	// context is considered stale.
+	GracePeriod time.Duration
+	// Confirm is asked before removing stale contexts under PruneConfirm. A
+	// nil Confirm declines.
+	Confirm func(stale []string) bool
+}
+
+// now returns the current time. It is a variable so tests can fix it.
+var now = time.Now
+
+// ParsePrunePolicy parses a prune policy name.
+func ParsePrunePolicy(s string) (PrunePolicy, error) {
+	switch p := PrunePolicy(s); p {
+	case PruneOff, PruneConfirm, PruneAuto:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid prune policy %q (want off, confirm or auto)", s)
+}
+
+// ResolvePruneOptions returns the prune policy and grace period from the
+// given flag values, falling back to ~/.kubectm/config.json and then to the
+// defaults (confirm, 24h). Empty flag values are treated as unset.
+func ResolvePruneOptions(policy, gracePeriod string) (PruneOptions, error) {
+	opts := PruneOptions{Policy: PruneConfirm, GracePeriod: DefaultPruneGracePeriod}
+
+	config, err := loadKubectmConfig()
+	if err != nil {
+		return opts, err
+	}
+	if policy == "" {
+		policy = config.Prune
+	}
+	if gracePeriod == "" {
+		gracePeriod = config.PruneGracePeriod
+	}
+
+	if policy != "" {
+		if opts.Policy, err = ParsePrunePolicy(policy); err != nil {
+			return opts, err
+		}
+	}
+	if gracePeriod != "" {
+		grace, err := time.ParseDuration(gracePeriod)
+		if err != nil || grace < 0 {
+			return opts, fmt.Errorf("invalid prune grace period %q", gracePeriod)
+		}
+		opts.GracePeriod = grace
+	}
+	return opts, nil
+}
+
+// pruneStaleContexts removes kubectm-created contexts whose cluster is no
+// longer listed by its provider, along with cluster and user entries no
+// other context uses.
+//
+// Only contexts whose provider and account are present in listed, i.e. were
+// listed in this run without errors, are considered, so a failed or partial
+// listing, or a sync with another account, never causes a deletion. A cluster must also have been missing for the grace period.
+// Pinned contexts are reported but never pruned.
+func pruneStaleContexts(config *api.Config, state *kubeconfigState, listed map[string]map[string]bool, pins pinSet, opts PruneOptions, dryRun bool, report *Report) {
+	current := now()
+
+	// Contexts carrying the ownership extension are kubectm's even if the
+	// state file was lost or belongs to another machine. The extension also
+	// supplies the account of contexts recorded before accounts were.
+	for _, name := range sortedKeys(config.Contexts) {
+		context := config.Contexts[name]
+		if context == nil {
+			continue
+		}
+		ext := ownership(context.Extensions)
+		if ext == nil {
+			continue
+		}
+		if managed := state.Contexts[name]; managed != nil {
+			if managed.Account == "" && managed.Provider == ext.Provider && managed.ClusterID == ext.ClusterID {
+				managed.Account = ext.Account
+			}
+			continue
+		}
+		state.Contexts[name] = &ManagedContext{Provider: ext.Provider, Account: ext.Account, ClusterID: ext.ClusterID, Cluster: context.Cluster, User: context.AuthInfo}
+	}
+
+	var stale []string
+	for _, name := range sortedKeys(state.Contexts) {
+		managed := state.Contexts[name]
+		if _, exists := config.Contexts[name]; !exists {
+			// Removed by the user; stop tracking it.
+			delete(state.Contexts, name)
+			continue
+		}
+
+		ids, complete := listed[listingKey(managed.Provider, managed.Account)]
+		if !complete {
+			continue
+		}
+		if ids[managed.ClusterID] {
+			managed.MissingSince = nil
+			continue
+		}
+
+		if managed.MissingSince == nil {
+			missingSince := current
+			managed.MissingSince = &missingSince
+		}
+		if missingFor := current.Sub(*managed.MissingSince); missingFor < opts.GracePeriod {
+			utils.WarnLogger.Printf("%s %s cluster for context %s is missing; it will be pruned after %s", utils.Iso8601Time(), managed.Provider, name, (opts.GracePeriod - missingFor).Round(time.Minute))
+			report.record(KindContext, name, ActionSkipped, "cluster missing, within grace period")
+			continue
+		}
+		if pins.matches(name) {
+			utils.WarnLogger.Printf("%s Context %s refers to a cluster that no longer exists, but it is pinned", utils.Iso8601Time(), name)
+			report.record(KindContext, name, ActionSkipped, "stale, pinned")
+			continue
+		}
+		stale = append(stale, name)
+	}
+
+	if len(stale) == 0 {
+		return
+	}
+
+	switch opts.Policy {
+	case PruneAuto:
+	case PruneConfirm:
+		// A dry run reports the removal it would ask about without asking.
+		if !dryRun && (opts.Confirm == nil || !opts.Confirm(stale)) {
+			for _, name := range stale {
+				report.record(KindContext, name, ActionSkipped, "stale, pruning not confirmed")
+			}
+			return
+		}
+	default:
+		for _, name := range stale {
+			utils.WarnLogger.Printf("%s Context %s refers to a cluster that no longer exists", utils.Iso8601Time(), name)
+			report.record(KindContext, name, ActionSkipped, "stale, pruning disabled")
+		}
+		return
+	}
+
+	for _, name := range stale {
+		removeContext(config, name, state.Contexts[name], report)
+		delete(state.Contexts, name)
+	}
+}
+
+// removeContext deletes a context, and the cluster and user entries kubectm
+// created with it if no remaining context refers to them.
+func removeContext(config *api.Config, name string, managed *ManagedContext, report *Report) {
+	context := config.Contexts[name]
+	if context == nil {
+		return
+	}
+	delete(config.Contexts, name)
+	report.record(KindContext, name, ActionRemoved, "cluster no longer exists")
+	utils.ActionLogger.Printf("%s Pruned context %s: cluster no longer exists", utils.Iso8601Time(), color.New(color.Bold).Sprint(name))
+
+	if config.CurrentContext == name {
+		config.CurrentContext = ""
+		utils.WarnLogger.Printf("%s Current context %s was pruned; current-context is now unset", utils.Iso8601Time(), name)
+	}
+
+	clusterInUse, userInUse := false, false
+	for _, other := range config.Contexts {
+		if other == nil {
+			continue
+		}
+		clusterInUse = clusterInUse || other.Cluster == context.Cluster
+		userInUse = userInUse || other.AuthInfo == context.AuthInfo
+	}
+	if _, exists := config.Clusters[context.Cluster]; exists && !clusterInUse && context.Cluster == managed.Cluster {
+		delete(config.Clusters, context.Cluster)
+		report.record(KindCluster, context.Cluster, ActionRemoved, "orphaned")
+	}
+	if _, exists := config.AuthInfos[context.AuthInfo]; exists && !userInUse && context.AuthInfo == managed.User {
+		delete(config.AuthInfos, context.AuthInfo)
+		report.record(KindUser, context.AuthInfo, ActionRemoved, "orphaned")
+	}
+}
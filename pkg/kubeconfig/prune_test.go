@@ -0,0 +1,315 @@
+package kubeconfig
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// setNow fixes the clock used for grace periods for the rest of the test.
+func setNow(t *testing.T, at time.Time) {
+	t.Helper()
+	orig := now
+	now = func() time.Time { return at }
+	t.Cleanup(func() { now = orig })
+}
+
+// pruneTestConfig returns a kubeconfig with two kubectm-managed LKE contexts
+// sharing one user, and a hand-written context kubectm does not own.
+func pruneTestConfig() (*api.Config, *kubeconfigState) {
+	config := api.NewConfig()
+	config.Clusters["lke1"] = &api.Cluster{Server: "https://lke1.example.com"}
+	config.Clusters["lke2"] = &api.Cluster{Server: "https://lke2.example.com"}
+	config.Clusters["personal"] = &api.Cluster{Server: "https://personal.example.com"}
+	config.AuthInfos["lke-admin"] = &api.AuthInfo{Token: "token"}
+	config.AuthInfos["me"] = &api.AuthInfo{Token: "mine"}
+	config.Contexts["lke-prod"] = &api.Context{Cluster: "lke1", AuthInfo: "lke-admin"}
+	config.Contexts["lke-dev"] = &api.Context{Cluster: "lke2", AuthInfo: "lke-admin"}
+	config.Contexts["personal"] = &api.Context{Cluster: "personal", AuthInfo: "me"}
+	config.CurrentContext = "lke-prod"
+
+	state := &kubeconfigState{Contexts: map[string]*ManagedContext{
+		"lke-prod": {Provider: "Linode", ClusterID: "1", Cluster: "lke1", User: "lke-admin"},
+		"lke-dev":  {Provider: "Linode", ClusterID: "2", Cluster: "lke2", User: "lke-admin"},
+	}}
+	return config, state
+}
+
+func TestPruneStaleContexts(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	onlyDev := map[string]map[string]bool{listingKey("Linode", ""): {"2": true}}
+
+	t.Run("grace period", func(t *testing.T) {
+		config, state := pruneTestConfig()
+		opts := PruneOptions{Policy: PruneAuto, GracePeriod: time.Hour}
+
+		setNow(t, start)
+		report := &Report{}
+		pruneStaleContexts(config, state, onlyDev, nil, opts, false, report)
+		if _, ok := config.Contexts["lke-prod"]; !ok {
+			t.Fatal("expected context to survive within the grace period")
+		}
+		if got := state.Contexts["lke-prod"].MissingSince; got == nil || !got.Equal(start) {
+			t.Errorf("expected missing_since %v, got %v", start, got)
+		}
+
+		setNow(t, start.Add(2*time.Hour))
+		pruneStaleContexts(config, state, onlyDev, nil, opts, false, report)
+		if _, ok := config.Contexts["lke-prod"]; ok {
+			t.Fatal("expected context to be pruned after the grace period")
+		}
+		if _, ok := state.Contexts["lke-prod"]; ok {
+			t.Error("expected pruned context to be dropped from state")
+		}
+		if report.Count(ActionRemoved) != 2 {
+			t.Errorf("expected the context and its orphaned cluster to be removed, got %+v", report.Changes)
+		}
+	})
+
+	t.Run("cluster listed again clears missing_since", func(t *testing.T) {
+		config, state := pruneTestConfig()
+		missingSince := start
+		state.Contexts["lke-prod"].MissingSince = &missingSince
+
+		setNow(t, start.Add(48*time.Hour))
+		pruneStaleContexts(config, state, map[string]map[string]bool{listingKey("Linode", ""): {"1": true, "2": true}}, nil, PruneOptions{Policy: PruneAuto}, false, nil)
+		if _, ok := config.Contexts["lke-prod"]; !ok {
+			t.Fatal("expected listed cluster to be kept")
+		}
+		if state.Contexts["lke-prod"].MissingSince != nil {
+			t.Error("expected missing_since to be cleared")
+		}
+	})
+
+	t.Run("incomplete listing never prunes", func(t *testing.T) {
+		config, state := pruneTestConfig()
+		setNow(t, start)
+		pruneStaleContexts(config, state, map[string]map[string]bool{}, nil, PruneOptions{Policy: PruneAuto}, false, nil)
+		if len(config.Contexts) != 3 {
+			t.Errorf("expected no contexts pruned without a complete listing, got %v", config.Contexts)
+		}
+		if state.Contexts["lke-prod"].MissingSince != nil {
+			t.Error("expected missing_since to stay unset without a complete listing")
+		}
+	})
+
+	t.Run("auto keeps shared and unowned entries", func(t *testing.T) {
+		config, state := pruneTestConfig()
+		setNow(t, start)
+		pruneStaleContexts(config, state, onlyDev, nil, PruneOptions{Policy: PruneAuto}, false, nil)
+
+		if _, ok := config.Contexts["lke-prod"]; ok {
+			t.Error("expected stale context to be removed")
+		}
+		if _, ok := config.Clusters["lke1"]; ok {
+			t.Error("expected orphaned cluster to be removed")
+		}
+		if _, ok := config.AuthInfos["lke-admin"]; !ok {
+			t.Error("expected user shared with lke-dev to be kept")
+		}
+		if _, ok := config.Contexts["personal"]; !ok {
+			t.Error("expected unowned context to be kept")
+		}
+		if config.CurrentContext != "" {
+			t.Errorf("expected pruned current-context to be unset, got %q", config.CurrentContext)
+		}
+	})
+
+	t.Run("confirm without a prompt declines", func(t *testing.T) {
+		config, state := pruneTestConfig()
+		setNow(t, start)
+		report := &Report{}
+		pruneStaleContexts(config, state, onlyDev, nil, PruneOptions{Policy: PruneConfirm}, false, report)
+		if _, ok := config.Contexts["lke-prod"]; !ok {
+			t.Error("expected context to be kept when pruning is not confirmed")
+		}
+		if report.Count(ActionSkipped) != 1 {
+			t.Errorf("expected the stale context to be reported, got %+v", report.Changes)
+		}
+
+		var asked []string
+		opts := PruneOptions{Policy: PruneConfirm, Confirm: func(stale []string) bool {
+			asked = stale
+			return true
+		}}
+		pruneStaleContexts(config, state, onlyDev, nil, opts, false, nil)
+		if len(asked) != 1 || asked[0] != "lke-prod" {
+			t.Errorf("expected to be asked about lke-prod, got %v", asked)
+		}
+		if _, ok := config.Contexts["lke-prod"]; ok {
+			t.Error("expected confirmed context to be removed")
+		}
+	})
+
+	t.Run("off only reports", func(t *testing.T) {
+		config, state := pruneTestConfig()
+		setNow(t, start)
+		report := &Report{}
+		pruneStaleContexts(config, state, onlyDev, nil, PruneOptions{Policy: PruneOff}, false, report)
+		if _, ok := config.Contexts["lke-prod"]; !ok {
+			t.Error("expected context to be kept with pruning off")
+		}
+		if len(report.Changes) != 1 || report.Changes[0].Action != ActionSkipped {
+			t.Errorf("expected the stale context to be reported as skipped, got %+v", report.Changes)
+		}
+	})
+
+	t.Run("contexts removed by the user are forgotten", func(t *testing.T) {
+		config, state := pruneTestConfig()
+		delete(config.Contexts, "lke-dev")
+		setNow(t, start)
+		pruneStaleContexts(config, state, nil, nil, PruneOptions{Policy: PruneAuto}, false, nil)
+		if _, ok := state.Contexts["lke-dev"]; ok {
+			t.Error("expected state for a user-removed context to be dropped")
+		}
+	})
+}
+
+func TestResolvePruneOptions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	opts, err := ResolvePruneOptions("", "")
+	if err != nil || opts.Policy != PruneConfirm || opts.GracePeriod != DefaultPruneGracePeriod {
+		t.Errorf("expected defaults, got %+v (err %v)", opts, err)
+	}
+	opts, err = ResolvePruneOptions("auto", "1h")
+	if err != nil || opts.Policy != PruneAuto || opts.GracePeriod != time.Hour {
+		t.Errorf("expected auto/1h, got %+v (err %v)", opts, err)
+	}
+	if _, err := ResolvePruneOptions("always", ""); err == nil {
+		t.Error("expected error for an invalid policy")
+	}
+	if _, err := ResolvePruneOptions("", "-1h"); err == nil {
+		t.Error("expected error for a negative grace period")
+	}
+}
+
+// TestMergeConfigsPrunesOnlyOwnedContexts runs two syncs: the first adopts
+// the contexts it writes, the second prunes the one whose cluster was deleted
+// while leaving a same-named hand-written context alone.
+func TestMergeConfigsPrunesOnlyOwnedContexts(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	setNow(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	download := func(id, name string) DownloadedConfig {
+		d := DownloadedConfig{
+			Provider: "Linode",
+			Config:   createTestConfig(name, "https://"+name+".example.com", testCAData, name+"-admin", testToken, name+"-ctx", nil),
+		}
+		d.Cluster.ID = id
+		d.Cluster.ContextName = name
+		return d
+	}
+	opts := MergeOptions{Prune: PruneOptions{Policy: PruneAuto}}
+
+	first := &DownloadResult{
+		Configs: []DownloadedConfig{download("1", "lke-prod"), download("2", "lke-dev")},
+		Listed:  map[string]map[string]bool{listingKey("Linode", ""): {"1": true, "2": true}},
+	}
+	if _, err := MergeConfigs(first, opts); err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+
+	second := &DownloadResult{
+		Configs: []DownloadedConfig{download("2", "lke-dev")},
+		Listed:  map[string]map[string]bool{listingKey("Linode", ""): {"2": true}},
+	}
+	report, err := MergeConfigs(second, opts)
+	if err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+	if report.Count(ActionRemoved) == 0 {
+		t.Errorf("expected lke-prod to be pruned, got %+v", report.Changes)
+	}
+
+	merged, err := clientcmd.LoadFromFile(filepath.Join(home, ".kube", "config"))
+	if err != nil {
+		t.Fatalf("failed to load merged config: %v", err)
+	}
+	if _, ok := merged.Contexts["lke-prod"]; ok {
+		t.Error("expected lke-prod to be pruned")
+	}
+	if _, ok := merged.Contexts["lke-dev"]; !ok {
+		t.Error("expected lke-dev to be kept")
+	}
+
+	state, err := loadSyncState()
+	if err != nil {
+		t.Fatalf("loadSyncState() error = %v", err)
+	}
+	contexts := state.forKubeconfig(filepath.Join(home, ".kube", "config")).Contexts
+	if _, ok := contexts["lke-prod"]; ok || contexts["lke-dev"] == nil {
+		t.Errorf("unexpected state after pruning: %+v", contexts)
+	}
+}
+
+// TestMergeConfigsPrunesPerAccount syncs two Linode accounts one after the
+// other. Cluster IDs are only unique per account, so the second sync must not
+// treat the first account's context as missing.
+func TestMergeConfigsPrunesPerAccount(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	setNow(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	download := func(account, id, name string) DownloadedConfig {
+		d := DownloadedConfig{
+			Provider: "Linode",
+			Account:  account,
+			Config:   createTestConfig(name, "https://"+name+".example.com", testCAData, name+"-admin", testToken, name+"-ctx", nil),
+		}
+		d.Cluster.ID = id
+		d.Cluster.ContextName = name
+		return d
+	}
+	opts := MergeOptions{Prune: PruneOptions{Policy: PruneAuto}}
+
+	work := &DownloadResult{
+		Configs: []DownloadedConfig{download("work", "1", "lke-work")},
+		Listed:  map[string]map[string]bool{listingKey("Linode", "work"): {"1": true}},
+	}
+	if _, err := MergeConfigs(work, opts); err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+
+	personal := &DownloadResult{
+		Configs: []DownloadedConfig{download("personal", "2", "lke-personal")},
+		Listed:  map[string]map[string]bool{listingKey("Linode", "personal"): {"2": true}},
+	}
+	report, err := MergeConfigs(personal, opts)
+	if err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+	if report.Count(ActionRemoved) != 0 {
+		t.Errorf("expected nothing to be pruned, got %+v", report.Changes)
+	}
+
+	path := filepath.Join(home, ".kube", "config")
+	merged, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("failed to load merged config: %v", err)
+	}
+	if _, ok := merged.Contexts["lke-work"]; !ok {
+		t.Error("expected lke-work to be kept when only the personal account was listed")
+	}
+	state, err := loadSyncState()
+	if err != nil {
+		t.Fatalf("loadSyncState() error = %v", err)
+	}
+	managed := state.forKubeconfig(path).Contexts["lke-work"]
+	if managed == nil || managed.Account != "work" || managed.MissingSince != nil {
+		t.Errorf("expected lke-work to be tracked for account work and not missing, got %+v", managed)
+	}
+
+	// A complete listing of the work account without the cluster prunes it.
+	deleted := &DownloadResult{Listed: map[string]map[string]bool{listingKey("Linode", "work"): {}}}
+	if report, err = MergeConfigs(deleted, opts); err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+	if report.Count(ActionRemoved) == 0 {
+		t.Errorf("expected lke-work to be pruned, got %+v", report.Changes)
+	}
+}
@@ -1,15 +1,512 @@
 package kubeconfig
 
 import (
-    "log"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"text/template"
+
+	"kubectm/pkg/utils"
+
+	"github.com/fatih/color"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd/api"
 )
 
-// RenameConfigs renames clusters and contexts in the kubeconfig files.
+// RenameConfigs applies the naming rules to the downloaded kubeconfigs before
+// they are merged. Each cluster's context, cluster and user names are rendered
+// from its provider's rule, or kept as the provider named them. A cluster
+// whose rule fails to render keeps the provider's names, with a warning, so
+// one cluster's tags or fields cannot stop a sync.
+//
+// When different clusters end up with the same name, each of them gets a
+// suffix derived from its provider and cluster ID, so the names do not
+// depend on the order clusters were listed in and are the same on every
+// machine that syncs the same clusters.
+func RenameConfigs(downloaded *DownloadResult, namer *Namer) {
+	if downloaded == nil {
+		return
+	}
+
+	rendered := make([]renderedNames, len(downloaded.Configs))
+	for i, d := range downloaded.Configs {
+		if d.Config == nil {
+			continue
+		}
+		rendered[i] = namer.names(d)
+	}
+
+	// Disambiguate context names, and the cluster and user keys the rules
+	// produced, that are shared by different clusters.
+	disambiguate(downloaded.Configs, func(i int) []*string {
+		return []*string{&rendered[i].context}
+	})
+	disambiguate(downloaded.Configs, func(i int) []*string {
+		return renameTargets(rendered[i].clusters)
+	})
+	disambiguate(downloaded.Configs, func(i int) []*string {
+		return renameTargets(rendered[i].users)
+	})
+
+	for i := range downloaded.Configs {
+		d := &downloaded.Configs[i]
+		if d.Config == nil {
+			continue
+		}
+		if d.Cluster.ContextName != rendered[i].context {
+			utils.ActionLogger.Printf("%s Naming %s cluster %s as %s", utils.Iso8601Time(), d.Provider, d.Cluster.Name, rendered[i].context)
+		}
+		d.Cluster.ContextName = rendered[i].context
+		renameEntries(d.Config, rendered[i].clusters, rendered[i].users)
+	}
+}
+
+// disambiguate appends a cluster-specific suffix to every name that is shared
+// by more than one distinct cluster. names returns pointers to the names of
+// config i so they can be rewritten in place.
+func disambiguate(configs []DownloadedConfig, names func(i int) []*string) {
+	owners := map[string]map[string]bool{}
+	for i, d := range configs {
+		if d.Config == nil {
+			continue
+		}
+		for _, name := range names(i) {
+			if owners[*name] == nil {
+				owners[*name] = map[string]bool{}
+			}
+			owners[*name][clusterIdentity(d)] = true
+		}
+	}
+	for i, d := range configs {
+		if d.Config == nil {
+			continue
+		}
+		for _, name := range names(i) {
+			if len(owners[*name]) > 1 {
+				*name = *name + "-" + shortClusterHash(d)
+			}
+		}
+	}
+}
+
+// clusterIdentity identifies a downloaded cluster across providers.
+func clusterIdentity(d DownloadedConfig) string {
+	return d.Provider + "/" + d.Cluster.ID
+}
+
+// shortClusterHash returns six hex digits derived from a cluster's identity.
+func shortClusterHash(d DownloadedConfig) string {
+	sum := sha256.Sum256([]byte(clusterIdentity(d)))
+	return hex.EncodeToString(sum[:])[:6]
+}
+
+// renameTargets returns pointers to the new keys of renames.
+func renameTargets(renames []keyRename) []*string {
+	targets := make([]*string, len(renames))
+	for i := range renames {
+		targets[i] = &renames[i].to
+	}
+	return targets
+}
+
+// renameEntries renames cluster and user keys in config and rewrites the
+// context references to match.
+func renameEntries(config *api.Config, clusterRenames, userRenames []keyRename) {
+	clusters := make(map[string]string, len(clusterRenames))
+	for _, r := range clusterRenames {
+		clusters[r.from] = r.to
+	}
+	users := make(map[string]string, len(userRenames))
+	for _, r := range userRenames {
+		users[r.from] = r.to
+	}
+
+	renamedClusters := make(map[string]*api.Cluster, len(config.Clusters))
+	for key, cluster := range config.Clusters {
+		if renamed, ok := clusters[key]; ok {
+			key = renamed
+		}
+		renamedClusters[key] = cluster
+	}
+	config.Clusters = renamedClusters
+
+	renamedUsers := make(map[string]*api.AuthInfo, len(config.AuthInfos))
+	for key, authInfo := range config.AuthInfos {
+		if renamed, ok := users[key]; ok {
+			key = renamed
+		}
+		renamedUsers[key] = authInfo
+	}
+	config.AuthInfos = renamedUsers
+
+	for _, context := range config.Contexts {
+		if context == nil {
+			continue
+		}
+		if renamed, ok := clusters[context.Cluster]; ok {
+			context.Cluster = renamed
+		}
+		if renamed, ok := users[context.AuthInfo]; ok {
+			context.AuthInfo = renamed
+		}
+	}
+}
+
+// migrateContext finds a context kubectm created earlier for the same cluster
+// under a different name, for example before a naming rule changed, and
+// renames it to the downloaded config's context name. Its cluster and user
+// entries are renamed to the downloaded keys too, where kubectm owns them and
+// no other context uses them.
 //
-// No parameters are accepted.
-// Returns an error if the renaming process fails.
-func RenameConfigs() error {
-    log.Println("Renaming clusters and contexts...")
-    // Logic to rename cluster and context names in the kubeconfig files
-    return nil
+// It returns the context name to merge the download into: the new name, or
+// the existing context's name if it is pinned or the new one is already taken.
+func migrateContext(config *api.Config, state *kubeconfigState, d DownloadedConfig, pins pinSet, report *Report) string {
+	target := d.Cluster.ContextName
+	if d.Cluster.ID == "" || isContextFor(config, state, target, d) {
+		return target
+	}
+
+	old := ""
+	for _, name := range sortedKeys(config.Contexts) {
+		if isContextFor(config, state, name, d) {
+			old = name
+			break
+		}
+	}
+	if old == "" {
+		return target
+	}
+	if pins.matches(old) {
+		return old
+	}
+	if _, taken := config.Contexts[target]; taken {
+		utils.WarnLogger.Printf("%s Context %s for %s cluster %s cannot be renamed to %s: the name is in use", utils.Iso8601Time(), old, d.Provider, d.Cluster.Name, target)
+		return old
+	}
+
+	context := config.Contexts[old]
+	delete(config.Contexts, old)
+	config.Contexts[target] = context
+	if config.CurrentContext == old {
+		config.CurrentContext = target
+	}
+	managed := state.Contexts[old]
+	delete(state.Contexts, old)
+	if managed != nil {
+		state.Contexts[target] = managed
+	}
+	report.record(KindContext, target, ActionRenamed, "from "+old)
+	utils.ActionLogger.Printf("%s Renamed context %s to %s", utils.Iso8601Time(), old, color.New(color.Bold).Sprint(target))
+
+	for _, key := range sortedKeys(d.Config.Contexts) {
+		src := d.Config.Contexts[key]
+		if src == nil {
+			continue
+		}
+		if renamed, ok := migrateEntry(config, config.Clusters, target, context.Cluster, src.Cluster, func(c *api.Context) string { return c.Cluster }, KindCluster, report); ok {
+			context.Cluster = renamed
+		}
+		if renamed, ok := migrateEntry(config, config.AuthInfos, target, context.AuthInfo, src.AuthInfo, func(c *api.Context) string { return c.AuthInfo }, KindUser, report); ok {
+			context.AuthInfo = renamed
+		}
+		break
+	}
+	if managed != nil {
+		managed.Cluster, managed.User = context.Cluster, context.AuthInfo
+	}
+	return target
+}
+
+// migrateEntry moves a kubectm-owned cluster or user entry from oldKey to
+// newKey if only the named context refers to it and newKey is free.
+func migrateEntry[V interface{ *api.Cluster | *api.AuthInfo }](config *api.Config, entries map[string]V, contextName, oldKey, newKey string, ref func(*api.Context) string, kind ChangeKind, report *Report) (string, bool) {
+	if entry, exists := entries[oldKey]; !exists || ownership(entryExtensions(entry)) == nil {
+		return "", false
+	}
+	return moveEntry(config, entries, contextName, oldKey, newKey, ref, kind, report)
+}
+
+// moveEntry moves a cluster or user entry from oldKey to newKey if only the
+// named context refers to it and newKey is free.
+func moveEntry[V interface{ *api.Cluster | *api.AuthInfo }](config *api.Config, entries map[string]V, contextName, oldKey, newKey string, ref func(*api.Context) string, kind ChangeKind, report *Report) (string, bool) {
+	entry, exists := entries[oldKey]
+	if !exists || oldKey == newKey {
+		return "", false
+	}
+	if _, taken := entries[newKey]; taken || !referencedOnlyBy(config, contextName, ref, oldKey) {
+		return "", false
+	}
+	delete(entries, oldKey)
+	entries[newKey] = entry
+	report.record(kind, newKey, ActionRenamed, "from "+oldKey)
+	return newKey, true
+}
+
+// entryExtensions returns the extensions of a cluster or user entry.
+func entryExtensions[V interface{ *api.Cluster | *api.AuthInfo }](entry V) map[string]runtime.Object {
+	switch e := any(entry).(type) {
+	case *api.Cluster:
+		return e.Extensions
+	case *api.AuthInfo:
+		return e.Extensions
+	}
+	return nil
+}
+
+// isContextFor reports whether the named context is one kubectm created for
+// the downloaded cluster, according to the state or its ownership extension.
+func isContextFor(config *api.Config, state *kubeconfigState, name string, d DownloadedConfig) bool {
+	context := config.Contexts[name]
+	if context == nil {
+		return false
+	}
+	if managed := state.Contexts[name]; managed != nil {
+		return managed.Provider == d.Provider && managed.ClusterID == d.Cluster.ID
+	}
+	ext := ownership(context.Extensions)
+	return ext != nil && ext.Provider == d.Provider && ext.ClusterID == d.Cluster.ID
+}
+
+// RenameRule rewrites the names of contexts that match a regular expression.
+// Each match in the name is replaced with Replace, expanded like
+// regexp.Regexp.Expand (so "$1" or "${region}" refer to submatches), keeping
+// the rest of the name; anchor the expression with ^ and $ to replace the
+// whole name. If Template is set, the new name is instead a Go template
+// executed with RenameFields.
+type RenameRule struct {
+	Match    string `json:"match"`
+	Replace  string `json:"replace,omitempty"`
+	Template string `json:"template,omitempty"`
+}
+
+// RenameFields are the fields available to rename templates, for example
+// {{index .Groups 1}}-{{.Namespace | default "default"}}.
+type RenameFields struct {
+	// Name is the context's current name.
+	Name      string
+	Cluster   string
+	User      string
+	Namespace string
+	// Server is the API server of the context's cluster.
+	Server string
+	// Groups are the submatches of the rule's expression; Groups[0] is the
+	// whole match.
+	Groups []string
+}
+
+// RenameOptions control RenameContexts.
+type RenameOptions struct {
+	// Rules are tried in order; the first one that matches a context renames it.
+	Rules []RenameRule
+	// Clusters and Users also rename the cluster and user entries a renamed
+	// context refers to, where no other context shares them.
+	Clusters bool
+	Users    bool
+	// DryRun reports the renames without writing anything.
+	DryRun bool
+	// BackupCount is passed to BackupConfig before the kubeconfig is written.
+	BackupCount int
+}
+
+// renameRule is a compiled RenameRule.
+type renameRule struct {
+	match   *regexp.Regexp
+	replace string
+	tmpl    *template.Template
+}
+
+// compileRenameRules parses the expressions and templates of rules.
+func compileRenameRules(rules []RenameRule) ([]renameRule, error) {
+	compiled := make([]renameRule, 0, len(rules))
+	for i, rule := range rules {
+		if rule.Match == "" {
+			return nil, fmt.Errorf("rename rule %d has no match expression", i+1)
+		}
+		if rule.Replace != "" && rule.Template != "" {
+			return nil, fmt.Errorf("rename rule %d sets both replace and template", i+1)
+		}
+		match, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid match expression in rename rule %d: %v", i+1, err)
+		}
+		c := renameRule{match: match, replace: rule.Replace}
+		if rule.Template != "" {
+			c.tmpl, err = template.New(fmt.Sprintf("rename rule %d", i+1)).Funcs(namingFuncs).Option("missingkey=zero").Parse(rule.Template)
+			if err != nil {
+				return nil, fmt.Errorf("invalid template in rename rule %d: %v", i+1, err)
+			}
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// LoadRenameRules returns the rename rules in ~/.kubectm/config.json.
+func LoadRenameRules() ([]RenameRule, error) {
+	config, err := loadKubectmConfig()
+	if err != nil {
+		return nil, err
+	}
+	return config.Rename, nil
+}
+
+// RenameContexts applies rename rules to the contexts in the target kubeconfig,
+// keeping current-context and kubectm's state pointing at the renamed
+// contexts. Pinned contexts keep their names. Unless opts.DryRun is set, the kubeconfig is backed up with
+// BackupConfig before it is written, and both the kubectm-wide lock and the
+// kubeconfig's <file>.lock are held from loading it until it is written.
+func RenameContexts(opts RenameOptions) (*Report, error) {
+	rules, err := compileRenameRules(opts.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := targetKubeconfig()
+	if err != nil {
+		return nil, err
+	}
+	if !opts.DryRun {
+		lock, err := lockKubectm()
+		if err != nil {
+			return nil, err
+		}
+		defer lock.release()
+		fileLock, err := lockKubeconfig(path)
+		if err != nil {
+			return nil, err
+		}
+		defer fileLock.release()
+	}
+	config, err := loadKubeconfig(path)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{DryRun: opts.DryRun, Path: path, before: config.DeepCopy(), after: config}
+
+	state, err := loadSyncState()
+	if err != nil {
+		return nil, err
+	}
+	pins, err := loadPins()
+	if err != nil {
+		return nil, err
+	}
+	renameContexts(config, state.forKubeconfig(path), rules, pins, opts, report)
+
+	if opts.DryRun {
+		utils.InfoLogger.Printf("%s Dry run: %s was not modified", utils.Iso8601Time(), path)
+		return report, nil
+	}
+	if len(report.Changes) == 0 {
+		utils.InfoLogger.Printf("%s No contexts matched the rename rules", utils.Iso8601Time())
+		return report, nil
+	}
+
+	if _, err := BackupConfig(opts.BackupCount); err != nil {
+		return nil, fmt.Errorf("failed to back up kubeconfig: %v", err)
+	}
+	tx := &transaction{}
+	if err := saveKubeconfig(tx, config, path); err != nil {
+		return nil, tx.fail(fmt.Errorf("failed to save renamed kubeconfig: %v", err))
+	}
+	if err := state.save(tx); err != nil {
+		return nil, tx.fail(fmt.Errorf("failed to save kubectm state: %v", err))
+	}
+	return report, nil
+}
+
+// renameContexts renames every context a rule matches, in name order. A
+// context that is pinned, or whose new name is invalid or already taken,
+// keeps its name.
+func renameContexts(config *api.Config, state *kubeconfigState, rules []renameRule, pins pinSet, opts RenameOptions, report *Report) {
+	for _, old := range sortedKeys(config.Contexts) {
+		context := config.Contexts[old]
+		if context == nil {
+			continue
+		}
+		target, ok, err := renameTarget(config, old, context, rules)
+		if err != nil {
+			utils.WarnLogger.Printf("%s Not renaming context %s: %v", utils.Iso8601Time(), old, err)
+			continue
+		}
+		if !ok || target == old {
+			continue
+		}
+		if pins.matches(old) {
+			utils.WarnLogger.Printf("%s Not renaming context %s: it is pinned", utils.Iso8601Time(), old)
+			report.record(KindContext, old, ActionSkipped, "pinned")
+			continue
+		}
+		if _, taken := config.Contexts[target]; taken {
+			utils.WarnLogger.Printf("%s Not renaming context %s to %s: the name is in use", utils.Iso8601Time(), old, target)
+			continue
+		}
+
+		delete(config.Contexts, old)
+		config.Contexts[target] = context
+		if config.CurrentContext == old {
+			config.CurrentContext = target
+		}
+		managed := state.Contexts[old]
+		delete(state.Contexts, old)
+		if managed != nil {
+			state.Contexts[target] = managed
+		}
+		report.record(KindContext, target, ActionRenamed, "from "+old)
+
+		if opts.Clusters {
+			if renamed, ok := moveEntry(config, config.Clusters, target, context.Cluster, target, func(c *api.Context) string { return c.Cluster }, KindCluster, report); ok {
+				context.Cluster = renamed
+			} else if context.Cluster != target {
+				utils.WarnLogger.Printf("%s Not renaming cluster %s: it is shared with another context or %s is in use", utils.Iso8601Time(), context.Cluster, target)
+			}
+		}
+		if opts.Users {
+			if renamed, ok := moveEntry(config, config.AuthInfos, target, context.AuthInfo, target, func(c *api.Context) string { return c.AuthInfo }, KindUser, report); ok {
+				context.AuthInfo = renamed
+			} else if context.AuthInfo != target {
+				utils.WarnLogger.Printf("%s Not renaming user %s: it is shared with another context or %s is in use", utils.Iso8601Time(), context.AuthInfo, target)
+			}
+		}
+		if managed != nil {
+			managed.Cluster, managed.User = context.Cluster, context.AuthInfo
+		}
+	}
+}
+
+// renameTarget returns the new name the first matching rule gives a context,
+// and whether any rule matched.
+func renameTarget(config *api.Config, name string, context *api.Context, rules []renameRule) (string, bool, error) {
+	for _, rule := range rules {
+		if !rule.match.MatchString(name) {
+			continue
+		}
+		var target string
+		if rule.tmpl == nil {
+			target = rule.match.ReplaceAllString(name, rule.replace)
+		} else {
+			fields := RenameFields{
+				Name:      name,
+				Cluster:   context.Cluster,
+				User:      context.AuthInfo,
+				Namespace: context.Namespace,
+				Groups:    rule.match.FindStringSubmatch(name),
+			}
+			if cluster := config.Clusters[context.Cluster]; cluster != nil {
+				fields.Server = cluster.Server
+			}
+			var b bytes.Buffer
+			if err := rule.tmpl.Execute(&b, fields); err != nil {
+				return "", true, fmt.Errorf("failed to render %s: %v", rule.tmpl.Name(), err)
+			}
+			target = b.String()
+		}
+		if !validName(target) {
+			return "", true, fmt.Errorf("the new name %q is invalid", target)
+		}
+		return target, true, nil
+	}
+	return "", false, nil
 }
@@ -0,0 +1,286 @@
+package kubeconfig
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kubectm/pkg/provider"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestRenameConfigsDisambiguatesDeterministically(t *testing.T) {
+	namer, err := NewNamer(map[string]NamingRule{"default": {Context: "{{.Name}}"}})
+	if err != nil {
+		t.Fatalf("NewNamer() error = %v", err)
+	}
+	east := namingTestConfig("AWS", provider.Cluster{ID: "us-east-1/prod", Name: "prod", ContextName: "prod@us-east-1"})
+	west := namingTestConfig("AWS", provider.Cluster{ID: "us-west-2/prod", Name: "prod", ContextName: "prod@us-west-2"})
+	dev := namingTestConfig("AWS", provider.Cluster{ID: "us-east-1/dev", Name: "dev", ContextName: "dev@us-east-1"})
+
+	rename := func(configs ...DownloadedConfig) map[string]string {
+		t.Helper()
+		result := &DownloadResult{}
+		for _, c := range configs {
+			c.Config = c.Config.DeepCopy()
+			result.Configs = append(result.Configs, c)
+		}
+		RenameConfigs(result, namer)
+		names := map[string]string{}
+		for _, d := range result.Configs {
+			names[d.Cluster.ID] = d.Cluster.ContextName
+		}
+		return names
+	}
+
+	first := rename(east, west, dev)
+	second := rename(dev, west, east)
+	for id, name := range first {
+		if second[id] != name {
+			t.Errorf("expected %s to get the same name regardless of order, got %q and %q", id, name, second[id])
+		}
+	}
+	if first["us-east-1/dev"] != "dev" {
+		t.Errorf("expected unique name to be kept, got %q", first["us-east-1/dev"])
+	}
+	if first["us-east-1/prod"] == first["us-west-2/prod"] || !strings.HasPrefix(first["us-east-1/prod"], "prod-") {
+		t.Errorf("expected colliding names to be disambiguated, got %v", first)
+	}
+}
+
+func TestMigrateContextRenamesOwnedContext(t *testing.T) {
+	d := namingTestConfig("Linode", provider.Cluster{ID: "1", Name: "prod", ContextName: "lke-prod"})
+	d.Config = createTestConfig("lke-prod-cluster", testServerURL, testCAData, "lke-prod-user", testToken, "lke-prod", nil)
+
+	// The same cluster synced earlier under the provider's default names.
+	config := createTestConfig("lke1", testServerURL, testCAData, "lke1-admin", testToken, "prod", nil)
+	ext := &KubectmExtension{Provider: "Linode", ClusterID: "1"}
+	config.Contexts["prod"].Extensions = setOwnership(nil, ext)
+	config.Clusters["lke1"].Extensions = setOwnership(nil, ext)
+	config.AuthInfos["lke1-admin"].Extensions = setOwnership(nil, ext)
+	config.CurrentContext = "prod"
+	state := &kubeconfigState{Contexts: map[string]*ManagedContext{
+		"prod": {Provider: "Linode", ClusterID: "1", Cluster: "lke1", User: "lke1-admin"},
+	}}
+
+	report := &Report{}
+	if err := mergeDownloadedConfig(config, d, testIconPath, state, nil, MergeOptions{}, report); err != nil {
+		t.Fatalf("mergeDownloadedConfig() error = %v", err)
+	}
+
+	if _, ok := config.Contexts["prod"]; ok || len(config.Contexts) != 1 {
+		t.Fatalf("expected the old context to be renamed, got %v", config.Contexts)
+	}
+	context := config.Contexts["lke-prod"]
+	if context == nil || context.Cluster != "lke-prod-cluster" || context.AuthInfo != "lke-prod-user" {
+		t.Fatalf("expected context lke-prod with renamed entries, got %+v", context)
+	}
+	if len(config.Clusters) != 1 || len(config.AuthInfos) != 1 {
+		t.Errorf("expected entries to be moved rather than copied, got clusters %v users %v", config.Clusters, config.AuthInfos)
+	}
+	if config.CurrentContext != "lke-prod" {
+		t.Errorf("expected current-context to follow the rename, got %q", config.CurrentContext)
+	}
+	if managed := state.Contexts["lke-prod"]; managed == nil || managed.Cluster != "lke-prod-cluster" {
+		t.Errorf("expected state to follow the rename, got %+v", state.Contexts)
+	}
+	if report.Count(ActionRenamed) != 3 {
+		t.Errorf("expected context, cluster and user renames to be reported, got %+v", report.Changes)
+	}
+}
+
+func TestMigrateContextKeepsNameInUse(t *testing.T) {
+	d := namingTestConfig("Linode", provider.Cluster{ID: "1", Name: "prod", ContextName: "lke-prod"})
+	config := api.NewConfig()
+	config.Contexts["prod"] = &api.Context{Cluster: "lke1", Extensions: setOwnership(nil, &KubectmExtension{Provider: "Linode", ClusterID: "1"})}
+	config.Contexts["lke-prod"] = &api.Context{Cluster: "mine"}
+	state := &kubeconfigState{Contexts: map[string]*ManagedContext{}}
+
+	if got := migrateContext(config, state, d, nil, nil); got != "prod" {
+		t.Errorf("expected the download to merge into the existing context, got %q", got)
+	}
+	if config.Contexts["lke-prod"].Cluster != "mine" {
+		t.Error("expected the hand-written context to be left alone")
+	}
+}
+
+func TestRenameContexts(t *testing.T) {
+	baseConfig := func() *api.Config {
+		config := api.NewConfig()
+		config.Clusters["eks-prod"] = &api.Cluster{Server: testServerURL}
+		config.Clusters["shared"] = &api.Cluster{Server: testServerURL2}
+		config.AuthInfos["eks-prod-user"] = &api.AuthInfo{Token: testToken}
+		config.AuthInfos["shared-user"] = &api.AuthInfo{Token: testToken}
+		config.Contexts["arn:aws:eks:us-east-1:123456789012:cluster/prod"] = &api.Context{Cluster: "eks-prod", AuthInfo: "eks-prod-user", Namespace: "payments"}
+		config.Contexts["arn:aws:eks:eu-west-1:123456789012:cluster/dev"] = &api.Context{Cluster: "shared", AuthInfo: "shared-user"}
+		config.Contexts["dev@eu-west-1"] = &api.Context{Cluster: "shared", AuthInfo: "shared-user"}
+		config.CurrentContext = "arn:aws:eks:us-east-1:123456789012:cluster/prod"
+		return config
+	}
+
+	tests := []struct {
+		name        string
+		rule        RenameRule
+		opts        RenameOptions
+		wantNames   []string
+		wantCurrent string
+		wantCluster string
+		wantUser    string
+	}{
+		{
+			name:        "regex replacement",
+			rule:        RenameRule{Match: `^arn:aws:eks:([^:]+):\d+:cluster/(.+)$`, Replace: "$2@$1"},
+			wantNames:   []string{"arn:aws:eks:eu-west-1:123456789012:cluster/dev", "dev@eu-west-1", "prod@us-east-1"},
+			wantCurrent: "prod@us-east-1",
+			wantCluster: "eks-prod",
+			wantUser:    "eks-prod-user",
+		},
+		{
+			name:        "partial match keeps the rest of the name",
+			rule:        RenameRule{Match: `us-east-1`, Replace: "use1"},
+			wantNames:   []string{"arn:aws:eks:eu-west-1:123456789012:cluster/dev", "arn:aws:eks:use1:123456789012:cluster/prod", "dev@eu-west-1"},
+			wantCurrent: "arn:aws:eks:use1:123456789012:cluster/prod",
+			wantCluster: "eks-prod",
+			wantUser:    "eks-prod-user",
+		},
+		{
+			name:        "template with entries",
+			rule:        RenameRule{Match: `cluster/(prod)$`, Template: `{{index .Groups 1 | upper}}-{{.Namespace}}`},
+			opts:        RenameOptions{Clusters: true, Users: true},
+			wantNames:   []string{"PROD-payments", "arn:aws:eks:eu-west-1:123456789012:cluster/dev", "dev@eu-west-1"},
+			wantCurrent: "PROD-payments",
+			wantCluster: "PROD-payments",
+			wantUser:    "PROD-payments",
+		},
+		{
+			name:        "invalid name keeps context",
+			rule:        RenameRule{Match: `cluster/prod$`, Template: `{{.Missing}}`},
+			wantNames:   []string{"arn:aws:eks:eu-west-1:123456789012:cluster/dev", "arn:aws:eks:us-east-1:123456789012:cluster/prod", "dev@eu-west-1"},
+			wantCurrent: "arn:aws:eks:us-east-1:123456789012:cluster/prod",
+			wantCluster: "eks-prod",
+			wantUser:    "eks-prod-user",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := compileRenameRules([]RenameRule{tt.rule})
+			if err != nil {
+				t.Fatalf("compileRenameRules() error = %v", err)
+			}
+			config := baseConfig()
+			state := &kubeconfigState{Contexts: map[string]*ManagedContext{
+				"arn:aws:eks:us-east-1:123456789012:cluster/prod": {Provider: "AWS", ClusterID: "us-east-1/prod", Cluster: "eks-prod", User: "eks-prod-user"},
+			}}
+			renameContexts(config, state, rules, nil, tt.opts, &Report{})
+
+			if got := sortedKeys(config.Contexts); strings.Join(got, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("contexts = %v, want %v", got, tt.wantNames)
+			}
+			if config.CurrentContext != tt.wantCurrent {
+				t.Errorf("current-context = %q, want %q", config.CurrentContext, tt.wantCurrent)
+			}
+			context := config.Contexts[tt.wantCurrent]
+			if context.Cluster != tt.wantCluster || config.Clusters[tt.wantCluster] == nil {
+				t.Errorf("cluster = %q (clusters %v), want %q", context.Cluster, config.Clusters, tt.wantCluster)
+			}
+			if context.AuthInfo != tt.wantUser || config.AuthInfos[tt.wantUser] == nil {
+				t.Errorf("user = %q (users %v), want %q", context.AuthInfo, config.AuthInfos, tt.wantUser)
+			}
+			if managed := state.Contexts[tt.wantCurrent]; managed == nil || managed.Cluster != tt.wantCluster {
+				t.Errorf("expected state to follow the rename, got %+v", state.Contexts)
+			}
+		})
+	}
+}
+
+func TestRenameContextsKeepsNameInUseAndSharedEntries(t *testing.T) {
+	rules, err := compileRenameRules([]RenameRule{{Match: `^arn:aws:eks:([^:]+):\d+:cluster/(.+)$`, Replace: "$2@$1"}})
+	if err != nil {
+		t.Fatalf("compileRenameRules() error = %v", err)
+	}
+	config := api.NewConfig()
+	config.Clusters["shared"] = &api.Cluster{Server: testServerURL}
+	config.Contexts["arn:aws:eks:eu-west-1:1:cluster/dev"] = &api.Context{Cluster: "shared"}
+	config.Contexts["arn:aws:eks:eu-west-1:1:cluster/prod"] = &api.Context{Cluster: "shared"}
+	config.Contexts["dev@eu-west-1"] = &api.Context{Cluster: "mine"}
+
+	renameContexts(config, &kubeconfigState{Contexts: map[string]*ManagedContext{}}, rules, nil, RenameOptions{Clusters: true}, &Report{})
+
+	if config.Contexts["dev@eu-west-1"].Cluster != "mine" || config.Contexts["arn:aws:eks:eu-west-1:1:cluster/dev"] == nil {
+		t.Errorf("expected a rename onto an existing context to be skipped, got %v", config.Contexts)
+	}
+	if context := config.Contexts["prod@eu-west-1"]; context == nil || context.Cluster != "shared" {
+		t.Errorf("expected prod to be renamed but keep its shared cluster, got %v", config.Contexts)
+	}
+}
+
+func TestCompileRenameRulesRejectsInvalidRules(t *testing.T) {
+	for _, rule := range []RenameRule{
+		{Replace: "x"},
+		{Match: "("},
+		{Match: "a", Replace: "b", Template: "c"},
+		{Match: "a", Template: "{{.Name"},
+	} {
+		if _, err := compileRenameRules([]RenameRule{rule}); err == nil {
+			t.Errorf("expected error for rule %+v", rule)
+		}
+	}
+}
+
+func TestRenameContextsPreviewAndBackup(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	kubeDir := filepath.Join(home, ".kube")
+	if err := os.MkdirAll(kubeDir, 0700); err != nil {
+		t.Fatalf("failed to create .kube dir: %v", err)
+	}
+	configPath := filepath.Join(kubeDir, "config")
+	config := createTestConfig(testClusterNameMerge, testServerURL, testCAData, testUserName, testToken, "lke123-ctx", nil)
+	config.CurrentContext = "lke123-ctx"
+	if err := clientcmd.WriteToFile(*config, configPath); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+	original, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("failed to read kubeconfig: %v", err)
+	}
+	opts := RenameOptions{Rules: []RenameRule{{Match: `^lke(\d+)-ctx$`, Replace: "lke-$1"}}, DryRun: true, BackupCount: 2}
+
+	report, err := RenameContexts(opts)
+	if err != nil {
+		t.Fatalf("RenameContexts() preview error = %v", err)
+	}
+	if report.Count(ActionRenamed) != 1 {
+		t.Errorf("expected the preview to report one rename, got %+v", report.Changes)
+	}
+	if after, _ := os.ReadFile(configPath); !bytes.Equal(after, original) {
+		t.Error("expected the preview to leave the kubeconfig unchanged")
+	}
+	if entries, _ := os.ReadDir(kubeDir); len(entries) != 1 {
+		t.Errorf("expected no backup from a preview, got %d entries", len(entries))
+	}
+
+	opts.DryRun = false
+	if _, err := RenameContexts(opts); err != nil {
+		t.Fatalf("RenameContexts() error = %v", err)
+	}
+	renamed, err := clientcmd.LoadFromFile(configPath)
+	if err != nil {
+		t.Fatalf("failed to load renamed kubeconfig: %v", err)
+	}
+	if renamed.CurrentContext != "lke-123" || renamed.Contexts["lke-123"] == nil {
+		t.Errorf("expected lke-123 to be the current context, got %q and %v", renamed.CurrentContext, renamed.Contexts)
+	}
+	backups, _ := filepath.Glob(filepath.Join(kubeDir, backupPrefix("config")+"*"))
+	if len(backups) != 1 {
+		t.Fatalf("expected one backup, got %v", backups)
+	}
+	if backup, _ := os.ReadFile(backups[0]); !bytes.Equal(backup, original) {
+		t.Error("expected the backup to hold the kubeconfig from before the rename")
+	}
+}
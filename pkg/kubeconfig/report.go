@@ -0,0 +1,247 @@
+package kubeconfig
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ChangeKind identifies the kubeconfig section a change applies to.
+type ChangeKind string
+
+const (
+	KindContext ChangeKind = "context"
+	KindCluster ChangeKind = "cluster"
+	KindUser    ChangeKind = "user"
+)
+
+// ChangeAction describes what a merge did, or would do, to an entry.
+type ChangeAction string
+
+const (
+	ActionAdded       ChangeAction = "added"
+	ActionOverwritten ChangeAction = "overwritten"
+	ActionUpdated     ChangeAction = "updated"
+	ActionSkipped     ChangeAction = "skipped"
+	ActionRenamed     ChangeAction = "renamed"
+	ActionRemoved     ChangeAction = "removed"
+)
+
+// Change is a single entry in a merge Report.
+type Change struct {
+	Kind   ChangeKind
+	Name   string
+	Action ChangeAction
+	// Detail is optional context, such as the original name of a renamed entry.
+	Detail string
+}
+
+// Report records the changes a merge made, or would make in a dry run.
+// A nil *Report is valid and records nothing.
+type Report struct {
+	DryRun  bool
+	Path    string
+	Changes []Change
+	// Files holds a report per kubeconfig file in split output mode, where
+	// Path is the kubectm.d directory.
+	Files []*Report
+	// Kubeconfig is, in split output mode, the KUBECONFIG value that covers
+	// the target kubeconfig and every file in kubectm.d.
+	Kubeconfig string
+	// CurrentContext is the kubeconfig's current-context after the merge, and
+	// CurrentContextReason says how the current-context policy chose it.
+	CurrentContext       string
+	CurrentContextReason string
+
+	before *api.Config
+	after  *api.Config
+}
+
+// record adds a change to the report. A later change to the same entry
+// replaces the earlier one, so the report reflects the final outcome, except
+// that a skip never hides a change already made to the entry.
+func (r *Report) record(kind ChangeKind, name string, action ChangeAction, detail string) {
+	if r == nil {
+		return
+	}
+	for i, c := range r.Changes {
+		if c.Kind == kind && c.Name == name {
+			if action == ActionSkipped && c.Action != ActionSkipped {
+				return
+			}
+			r.Changes[i] = Change{Kind: kind, Name: name, Action: action, Detail: detail}
+			return
+		}
+	}
+	r.Changes = append(r.Changes, Change{Kind: kind, Name: name, Action: action, Detail: detail})
+}
+
+// Count returns how many changes in the report have the given action.
+func (r *Report) Count(action ChangeAction) int {
+	if r == nil {
+		return 0
+	}
+	n := 0
+	for _, c := range r.Changes {
+		if c.Action == action {
+			n++
+		}
+	}
+	for _, f := range r.Files {
+		n += f.Count(action)
+	}
+	return n
+}
+
+// Summary returns a one-line count of the changes by action.
+func (r *Report) Summary() string {
+	return fmt.Sprintf("%d added, %d overwritten, %d updated, %d skipped, %d renamed, %d removed",
+		r.Count(ActionAdded), r.Count(ActionOverwritten), r.Count(ActionUpdated), r.Count(ActionSkipped), r.Count(ActionRenamed), r.Count(ActionRemoved))
+}
+
+// Print writes the report as a table followed by the summary line.
+func (r *Report) Print(w io.Writer) {
+	if r == nil {
+		return
+	}
+	if len(r.Files) > 0 {
+		for _, f := range r.Files {
+			if len(f.Changes) > 0 {
+				f.Print(w)
+			}
+		}
+		fmt.Fprintf(w, "Total for %s: %s\n", r.Path, r.Summary())
+		return
+	}
+	if r.DryRun {
+		fmt.Fprintf(w, "Planned changes to %s (dry run, nothing written):\n", r.Path)
+	} else {
+		fmt.Fprintf(w, "Changes to %s:\n", r.Path)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range r.Changes {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", changeSymbol(c.Action), c.Kind, c.Name, changeDescription(c))
+	}
+	tw.Flush()
+
+	if r.CurrentContextReason != "" {
+		current := r.CurrentContext
+		if current == "" {
+			current = "(none)"
+		}
+		fmt.Fprintf(w, "Current context: %s (%s)\n", current, r.CurrentContextReason)
+	}
+	fmt.Fprintf(w, "Summary: %s\n", r.Summary())
+}
+
+func changeSymbol(action ChangeAction) string {
+	switch action {
+	case ActionAdded:
+		return "+"
+	case ActionOverwritten:
+		return "~"
+	case ActionUpdated:
+		return "*"
+	case ActionRenamed:
+		return ">"
+	case ActionRemoved:
+		return "-"
+	default:
+		return "="
+	}
+}
+
+func changeDescription(c Change) string {
+	if c.Detail == "" {
+		return string(c.Action)
+	}
+	return fmt.Sprintf("%s (%s)", c.Action, c.Detail)
+}
+
+// Diff returns a unified diff between the kubeconfig before and after the
+// merge, with credentials redacted. In split output mode it is the diff of
+// every file, a removed file diffing to nothing. It returns "" when nothing
+// changed.
+func (r *Report) Diff() (string, error) {
+	if r == nil {
+		return "", nil
+	}
+	if len(r.Files) > 0 {
+		var diffs []string
+		for _, f := range r.Files {
+			diff, err := f.Diff()
+			if err != nil {
+				return "", err
+			}
+			if diff != "" {
+				diffs = append(diffs, diff)
+			}
+		}
+		return strings.Join(diffs, ""), nil
+	}
+	if r.before == nil && r.after == nil {
+		return "", nil
+	}
+
+	before, after := []byte{}, []byte{}
+	var err error
+	if r.before != nil {
+		if before, err = redactedYAML(r.before); err != nil {
+			return "", err
+		}
+	}
+	if r.after != nil {
+		if after, err = redactedYAML(r.after); err != nil {
+			return "", err
+		}
+	}
+
+	return unifiedDiff(r.Path, r.Path, string(before), string(after)), nil
+}
+
+// secretLinePattern matches YAML lines holding credential material in
+// serialized kubeconfigs, including auth-provider config entries.
+var secretLinePattern = regexp.MustCompile(`^(\s*(?:- )?(?:token|password|client-key-data|client-secret|refresh-token|access-token|id-token|secret)): (.+)$`)
+
+// redactedYAML serializes config with every credential value replaced by a
+// short fingerprint, so changed secrets still show up in a diff without
+// being revealed.
+func redactedYAML(config *api.Config) ([]byte, error) {
+	config = config.DeepCopy()
+	for _, authInfo := range config.AuthInfos {
+		if authInfo == nil || authInfo.Exec == nil {
+			continue
+		}
+		for i := range authInfo.Exec.Env {
+			authInfo.Exec.Env[i].Value = redactedValue(authInfo.Exec.Env[i].Value)
+		}
+	}
+
+	content, err := clientcmd.Write(*config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize kubeconfig: %v", err)
+	}
+
+	lines := splitLines(string(content))
+	for i, line := range lines {
+		if m := secretLinePattern.FindStringSubmatch(line); m != nil {
+			lines[i] = m[1] + ": " + redactedValue(m[2])
+		}
+	}
+	return []byte(joinLines(lines)), nil
+}
+
+// redactedValue replaces a secret with a placeholder carrying the first
+// eight hex digits of its SHA-256.
+func redactedValue(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "REDACTED-" + hex.EncodeToString(sum[:])[:8]
+}
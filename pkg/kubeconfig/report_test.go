@@ -0,0 +1,121 @@
+package kubeconfig
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestReportRecordKeepsFinalAction(t *testing.T) {
+	report := &Report{}
+	report.record(KindCluster, "prod", ActionSkipped, "already exists")
+	report.record(KindUser, "admin", ActionAdded, "")
+	report.record(KindCluster, "prod", ActionOverwritten, "")
+	report.record(KindCluster, "prod", ActionSkipped, "already exists")
+
+	if len(report.Changes) != 2 {
+		t.Fatalf("expected 2 changes, got %+v", report.Changes)
+	}
+	if report.Changes[0].Action != ActionOverwritten {
+		t.Errorf("expected later change to replace earlier one, and a skip not to hide it, got %+v", report.Changes[0])
+	}
+	if got := report.Summary(); got != "1 added, 1 overwritten, 0 updated, 0 skipped, 0 renamed, 0 removed" {
+		t.Errorf("unexpected summary %q", got)
+	}
+
+	var nilReport *Report
+	nilReport.record(KindContext, "ignored", ActionAdded, "")
+	nilReport.Print(&bytes.Buffer{})
+}
+
+func TestMergeConfigsDryRun(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	kubeDir := filepath.Join(home, ".kube")
+	if err := os.MkdirAll(kubeDir, 0700); err != nil {
+		t.Fatalf("failed to create .kube dir: %v", err)
+	}
+
+	existing := createTestConfig("old-cluster", "https://old.example.com:6443", "old-ca-data", "old-user", "old-secret-token", "shared", nil)
+	existing.Clusters["kept"] = &api.Cluster{Server: "https://kept.example.com"}
+	configPath := filepath.Join(kubeDir, "config")
+	if err := clientcmd.WriteToFile(*existing, configPath); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+	original, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("failed to read kubeconfig: %v", err)
+	}
+
+	replaced := DownloadedConfig{
+		Provider: "Linode",
+		Config:   createTestConfig("old-cluster", "https://new.example.com:6443", "new-ca-data", "old-user", "new-secret-token", "shared", nil),
+	}
+	replaced.Cluster.ContextName = "shared"
+	added := DownloadedConfig{
+		Provider: "AWS",
+		Config:   createTestConfig("eks", testServerURL, testCAData, "eks-user", testToken, "eks", nil),
+	}
+	added.Cluster.ContextName = "eks@us-east-1"
+
+	report, err := MergeConfigs(&DownloadResult{Configs: []DownloadedConfig{replaced, added}}, MergeOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+
+	// Nothing may be written: the kubeconfig is unchanged and no icon or
+	// other file appears in ~/.kube.
+	after, err := os.ReadFile(configPath)
+	if err != nil || !bytes.Equal(after, original) {
+		t.Errorf("expected %s to be unchanged by a dry run", configPath)
+	}
+	entries, _ := os.ReadDir(kubeDir)
+	if len(entries) != 1 {
+		t.Errorf("expected only the kubeconfig in ~/.kube, got %d entries", len(entries))
+	}
+
+	want := map[string]ChangeAction{
+		"context/shared":        ActionOverwritten,
+		"cluster/old-cluster":   ActionOverwritten,
+		"user/old-user":         ActionOverwritten,
+		"context/eks@us-east-1": ActionAdded,
+		"cluster/eks":           ActionAdded,
+		"user/eks-user":         ActionAdded,
+	}
+	got := make(map[string]ChangeAction)
+	for _, c := range report.Changes {
+		got[string(c.Kind)+"/"+c.Name] = c.Action
+	}
+	for key, action := range want {
+		if got[key] != action {
+			t.Errorf("expected %s to be %s, got %q", key, action, got[key])
+		}
+	}
+
+	var out bytes.Buffer
+	report.Print(&out)
+	if !strings.Contains(out.String(), "dry run") || !strings.Contains(out.String(), "Summary: 3 added, 3 overwritten") {
+		t.Errorf("unexpected report output:\n%s", out.String())
+	}
+
+	diff, err := report.Diff()
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if !strings.Contains(diff, "+    server: https://new.example.com:6443") {
+		t.Errorf("expected diff to show the new server, got:\n%s", diff)
+	}
+	for _, secret := range []string{"old-secret-token", "new-secret-token", testToken} {
+		if strings.Contains(diff, secret) {
+			t.Errorf("diff leaks secret %q:\n%s", secret, diff)
+		}
+	}
+	if !strings.Contains(diff, "token: REDACTED-") {
+		t.Errorf("expected redacted token lines in diff, got:\n%s", diff)
+	}
+}
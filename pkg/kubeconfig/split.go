@@ -0,0 +1,181 @@
+package kubeconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"kubectm/pkg/utils"
+)
+
+// OutputMode controls where a sync writes the downloaded kubeconfigs.
+type OutputMode string
+
+const (
+	// OutputMerge merges every cluster into the target kubeconfig.
+	OutputMerge OutputMode = "merge"
+	// OutputProvider writes one kubeconfig per provider to kubectm.d.
+	OutputProvider OutputMode = "provider"
+	// OutputCluster writes one kubeconfig per cluster to kubectm.d.
+	OutputCluster OutputMode = "cluster"
+)
+
+// splitDirName is the directory, next to the target kubeconfig, that holds
+// the files written in split output mode.
+const splitDirName = "kubectm.d"
+
+// kubeconfigEnvName is the file in kubectm.d that kubectm keeps up to date
+// with the KUBECONFIG value covering every split file.
+const kubeconfigEnvName = "kubeconfig.env"
+
+// split reports whether the mode writes kubectm.d files rather than merging.
+func (m OutputMode) split() bool {
+	return m == OutputProvider || m == OutputCluster
+}
+
+// ParseOutputMode parses an output mode name.
+func ParseOutputMode(s string) (OutputMode, error) {
+	switch m := OutputMode(s); m {
+	case OutputMerge, OutputProvider, OutputCluster:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid output mode %q (want merge, provider or cluster)", s)
+}
+
+// ResolveOutputMode returns the output mode from the given flag value,
+// falling back to ~/.kubectm/config.json and then to merge. An empty flag
+// value is treated as unset.
+func ResolveOutputMode(mode string) (OutputMode, error) {
+	if mode == "" {
+		config, err := loadKubectmConfig()
+		if err != nil {
+			return OutputMerge, err
+		}
+		mode = config.Output
+	}
+	if mode == "" {
+		return OutputMerge, nil
+	}
+	return ParseOutputMode(mode)
+}
+
+// splitInMemory merges the downloaded configs into one kubeconfig per
+// provider or per cluster in the kubectm.d directory next to target, which
+// is left alone. It shares mergeInto with the merge path, so naming,
+// ownership extensions and pruning behave the same.
+//
+// Files from earlier syncs are revisited even if nothing was downloaded for
+// them, so their stale contexts are pruned; a file left without contexts is
+// removed. The plan also rewrites kubectm.d/kubeconfig.env with a KUBECONFIG
+// that lists target followed by every remaining file.
+func splitInMemory(downloaded *DownloadResult, target, iconPath string, state *syncState, pins pinSet, opts MergeOptions) (*mergePlan, error) {
+	dir := filepath.Join(filepath.Dir(target), splitDirName)
+
+	groups := map[string][]DownloadedConfig{}
+	for _, d := range downloaded.Configs {
+		path, err := splitFile(dir, opts.Output, d, state)
+		if err != nil {
+			return nil, err
+		}
+		groups[path] = append(groups[path], d)
+	}
+	for path, ks := range state.Kubeconfigs {
+		if _, ok := groups[path]; !ok && filepath.Dir(path) == dir && len(ks.Contexts) > 0 {
+			groups[path] = nil
+		}
+	}
+
+	report := &Report{DryRun: opts.DryRun, Path: dir}
+	plan := &mergePlan{report: report, state: state}
+	kubeconfigs := []string{target}
+	for _, path := range sortedKeys(groups) {
+		f, err := loadPlannedFile(path)
+		if err != nil {
+			return nil, err
+		}
+		fileReport := &Report{DryRun: opts.DryRun, Path: path, before: f.before, after: f.config}
+		if err := mergeInto(f.config, groups[path], downloaded.Listed, iconPath, state.forKubeconfig(path), pins, opts, fileReport); err != nil {
+			return nil, err
+		}
+
+		if len(f.config.Contexts) == 0 {
+			// Every context in the file was pruned, so the file goes too.
+			f.config, fileReport.after = nil, nil
+			delete(state.Kubeconfigs, path)
+			if f.loadedHash != "" {
+				utils.ActionLogger.Printf("%s Removing %s: it has no contexts left", utils.Iso8601Time(), path)
+			}
+		} else {
+			kubeconfigs = append(kubeconfigs, path)
+		}
+		report.Files = append(report.Files, fileReport)
+		plan.files = append(plan.files, f)
+	}
+
+	report.Kubeconfig = strings.Join(kubeconfigs, string(os.PathListSeparator))
+	plan.envPath = filepath.Join(dir, kubeconfigEnvName)
+	plan.envData = kubeconfigEnv(plan.envPath, report.Kubeconfig)
+	return plan, nil
+}
+
+// splitFile returns the kubectm.d file a downloaded config is written to:
+// <provider>.yaml, or <provider>-<context>.yaml per cluster. A cluster
+// already written to a file by an earlier sync stays in that file, so
+// renaming its context does not leave a duplicate behind.
+func splitFile(dir string, mode OutputMode, d DownloadedConfig, state *syncState) (string, error) {
+	name := d.Provider
+	if mode == OutputCluster {
+		if d.Cluster.ID != "" {
+			for _, path := range sortedKeys(state.Kubeconfigs) {
+				if filepath.Dir(path) != dir {
+					continue
+				}
+				for _, managed := range state.Kubeconfigs[path].Contexts {
+					if managed.Provider == d.Provider && managed.ClusterID == d.Cluster.ID {
+						return path, nil
+					}
+				}
+			}
+		}
+		name += "-" + d.Cluster.ContextName
+	}
+
+	path := filepath.Join(dir, fileNameFor(name)+".yaml")
+	if filepath.Dir(path) != dir {
+		return "", fmt.Errorf("invalid kubeconfig path outside %s: %s", dir, path)
+	}
+	return path, nil
+}
+
+// fileNameFor turns a provider or context name into a safe file name:
+// lower case, with anything but letters, digits, dots, dashes and
+// underscores replaced by underscores, and no leading dot.
+func fileNameFor(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '_'
+	}, name)
+	name = strings.TrimLeft(name, ".")
+	if name == "" {
+		return "cluster"
+	}
+	return name
+}
+
+// kubeconfigEnv returns the content of kubectm.d/kubeconfig.env, a shell
+// snippet that exports the given KUBECONFIG value.
+func kubeconfigEnv(path, value string) []byte {
+	return []byte(fmt.Sprintf("# Written by kubectm. Add this to your shell profile to use the kubeconfigs in %s:\n#   . %s\nexport KUBECONFIG=%s\n",
+		filepath.Dir(path), shellQuote(path), shellQuote(value)))
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,127 @@
+package kubeconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kubectm/pkg/provider"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// splitDownload returns a downloaded config for a cluster with its own
+// server, user and token.
+func splitDownload(providerName, id, contextName string) DownloadedConfig {
+	server := "https://" + id + ".example.com:6443"
+	return DownloadedConfig{
+		Provider: providerName,
+		Cluster:  provider.Cluster{ID: id, ContextName: contextName},
+		Config:   createTestConfig(contextName, server, testCAData, contextName+"-admin", "token-"+id, contextName, nil),
+	}
+}
+
+func TestMergeConfigsSplitByProvider(t *testing.T) {
+	kubeDir := setupBackupTestHome(t)
+	writeTestConfig(t, kubeDir)
+	configPath := filepath.Join(kubeDir, "config")
+
+	downloaded := &DownloadResult{Configs: []DownloadedConfig{
+		splitDownload("Linode", "1", "lke-prod"),
+		splitDownload("Linode", "2", "lke-dev"),
+		splitDownload("AWS", "arn:1", "eks-prod"),
+	}}
+	report, err := MergeConfigs(downloaded, MergeOptions{Output: OutputProvider})
+	if err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+
+	if content, _ := os.ReadFile(configPath); string(content) != testKubeconfigContent {
+		t.Errorf("expected %s to be left alone, got %q", configPath, content)
+	}
+	if backups := listBackups(t, kubeDir); len(backups) != 0 {
+		t.Errorf("expected no backup of an untouched kubeconfig, got %v", backups)
+	}
+
+	dir := filepath.Join(kubeDir, splitDirName)
+	linode, err := clientcmd.LoadFromFile(filepath.Join(dir, "linode.yaml"))
+	if err != nil {
+		t.Fatalf("failed to load linode.yaml: %v", err)
+	}
+	if len(linode.Contexts) != 2 || ownership(linode.Contexts["lke-prod"].Extensions) == nil {
+		t.Errorf("expected both owned Linode contexts in linode.yaml, got %v", linode.Contexts)
+	}
+	aws, err := clientcmd.LoadFromFile(filepath.Join(dir, "aws.yaml"))
+	if err != nil || len(aws.Contexts) != 1 {
+		t.Fatalf("expected aws.yaml with one context, got %v (err %v)", aws, err)
+	}
+
+	want := strings.Join([]string{configPath, filepath.Join(dir, "aws.yaml"), filepath.Join(dir, "linode.yaml")}, string(os.PathListSeparator))
+	if report.Kubeconfig != want {
+		t.Errorf("report.Kubeconfig = %q, want %q", report.Kubeconfig, want)
+	}
+	env, err := os.ReadFile(filepath.Join(dir, kubeconfigEnvName))
+	if err != nil || !strings.Contains(string(env), "export KUBECONFIG="+shellQuote(want)) {
+		t.Errorf("expected %s to export KUBECONFIG, got %q (err %v)", kubeconfigEnvName, env, err)
+	}
+	if report.Count(ActionAdded) == 0 || len(report.Files) != 2 {
+		t.Errorf("expected a report per file with the added entries, got %+v", report)
+	}
+}
+
+func TestMergeConfigsSplitByClusterRemovesPrunedFile(t *testing.T) {
+	kubeDir := setupBackupTestHome(t)
+	dir := filepath.Join(kubeDir, splitDirName)
+	opts := MergeOptions{Output: OutputCluster, Prune: PruneOptions{Policy: PruneAuto}}
+
+	downloaded := &DownloadResult{
+		Configs: []DownloadedConfig{splitDownload("Linode", "1", "lke-prod"), splitDownload("Linode", "2", "lke-dev")},
+		Listed:  map[string]map[string]bool{listingKey("Linode", ""): {"1": true, "2": true}},
+	}
+	if _, err := MergeConfigs(downloaded, opts); err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+	for _, name := range []string{"linode-lke-prod.yaml", "linode-lke-dev.yaml"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("expected %s to be written, got %v", name, err)
+		}
+	}
+
+	// Cluster 2 is deleted at the provider.
+	downloaded = &DownloadResult{
+		Configs: []DownloadedConfig{splitDownload("Linode", "1", "lke-prod")},
+		Listed:  map[string]map[string]bool{listingKey("Linode", ""): {"1": true}},
+	}
+	report, err := MergeConfigs(downloaded, opts)
+	if err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "linode-lke-dev.yaml")); !os.IsNotExist(err) {
+		t.Errorf("expected the pruned cluster's file to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "linode-lke-prod.yaml")); err != nil {
+		t.Errorf("expected the listed cluster's file to be kept, got %v", err)
+	}
+	if strings.Contains(report.Kubeconfig, "lke-dev") {
+		t.Errorf("expected the removed file to be dropped from KUBECONFIG, got %q", report.Kubeconfig)
+	}
+	if diff, err := report.Diff(); err != nil || !strings.Contains(diff, "-- name: lke-dev") {
+		t.Errorf("expected the diff to show the removed file's content going, got %q (err %v)", diff, err)
+	}
+}
+
+func TestFileNameFor(t *testing.T) {
+	tests := map[string]string{
+		"Linode":                "linode",
+		"AWS-prod@eu-west-1":    "aws-prod_eu-west-1",
+		"../escape":             "_escape",
+		"GCP-gke_proj_zone_one": "gcp-gke_proj_zone_one",
+		"":                      "cluster",
+	}
+	for input, want := range tests {
+		if got := fileNameFor(input); got != want {
+			t.Errorf("fileNameFor(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
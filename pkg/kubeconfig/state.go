@@ -0,0 +1,124 @@
+package kubeconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// stateFileName is the file in ~/.kubectm that records which contexts kubectm
+// created in each kubeconfig.
+const stateFileName = "state.json"
+
+// ManagedContext records a context kubectm created, and where it came from.
+type ManagedContext struct {
+	Provider string `json:"provider"`
+	// Account is the profile, project or subscription the cluster belongs
+	// to. A cluster ID is only unique within its provider and account.
+	Account   string `json:"account,omitempty"`
+	ClusterID string `json:"cluster_id"`
+	// Cluster and User are the kubeconfig entries the context was created with.
+	Cluster string `json:"cluster"`
+	User    string `json:"user"`
+	// MissingSince is when a complete listing of the provider first omitted
+	// the cluster. It is cleared as soon as the cluster is listed again.
+	MissingSince *time.Time `json:"missing_since,omitempty"`
+	// Synced is the context, cluster and user as last downloaded, the base
+	// of the three-way merge that keeps local edits on the next sync.
+	Synced *SyncedFields `json:"synced,omitempty"`
+}
+
+// kubeconfigState is the state kept for a single kubeconfig file.
+type kubeconfigState struct {
+	Contexts map[string]*ManagedContext `json:"contexts"`
+}
+
+// syncState is the persisted ~/.kubectm/state.json, keyed by kubeconfig path.
+type syncState struct {
+	Kubeconfigs map[string]*kubeconfigState `json:"kubeconfigs"`
+}
+
+// statePath returns the path of ~/.kubectm/state.json.
+func statePath() (string, error) {
+	dir, err := kubectmDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Clean(filepath.Join(dir, stateFileName))
+	if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid state path outside kubectm directory")
+	}
+	return path, nil
+}
+
+// loadSyncState reads the state file. A missing file yields an empty state.
+func loadSyncState() (*syncState, error) {
+	path, err := statePath()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &syncState{Kubeconfigs: map[string]*kubeconfigState{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read state file: %v", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %v", path, err)
+	}
+	if state.Kubeconfigs == nil {
+		state.Kubeconfigs = map[string]*kubeconfigState{}
+	}
+	return state, nil
+}
+
+// forKubeconfig returns the state for the kubeconfig at path, creating it if needed.
+// State recorded under a symlink to path, before symlinks were followed, is
+// moved to path.
+func (s *syncState) forKubeconfig(path string) *kubeconfigState {
+	ks := s.Kubeconfigs[path]
+	if ks == nil {
+		for _, recorded := range sortedKeys(s.Kubeconfigs) {
+			if resolved, err := followSymlink(recorded, "state"); err == nil && resolved == path && recorded != path {
+				ks = s.Kubeconfigs[recorded]
+				delete(s.Kubeconfigs, recorded)
+				s.Kubeconfigs[path] = ks
+				break
+			}
+		}
+	}
+	if ks == nil {
+		ks = &kubeconfigState{}
+		s.Kubeconfigs[path] = ks
+	}
+	if ks.Contexts == nil {
+		ks.Contexts = map[string]*ManagedContext{}
+	}
+	return ks
+}
+
+// save writes the state file with 0600 permissions as part of tx.
+func (s *syncState) save(tx *transaction) error {
+	path, err := statePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create kubectm directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %v", err)
+	}
+	if err := tx.writeFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package kubeconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// KubeconfigPath is the kubeconfig kubectm reads and writes, set from the
+// --kubeconfig flag. When empty, targetKubeconfig falls back to
+// KUBECTM_KUBECONFIG, then KUBECONFIG, then ~/.kube/config.
+var KubeconfigPath string
+
+// kubectmKubeconfigEnv names a kubeconfig for kubectm to sync into without
+// changing the KUBECONFIG that kubectl reads.
+const kubectmKubeconfigEnv = "KUBECTM_KUBECONFIG"
+
+// targetKubeconfig returns the absolute path of the kubeconfig kubectm reads
+// and writes. In order of precedence it is KubeconfigPath, the file named by
+// KUBECTM_KUBECONFIG, the file kubectl writes new entries to when KUBECONFIG
+// is set, and ~/.kube/config. A kubeconfig that is a symlink resolves to the
+// file it links to, so locking, backups and writes all use the real file.
+func targetKubeconfig() (string, error) {
+	if KubeconfigPath != "" {
+		return resolveKubeconfigPath(KubeconfigPath, "--kubeconfig")
+	}
+	if path := os.Getenv(kubectmKubeconfigEnv); path != "" {
+		return resolveKubeconfigPath(path, kubectmKubeconfigEnv)
+	}
+	if path := kubeconfigFromEnv(os.Getenv(clientcmd.RecommendedConfigPathEnvVar)); path != "" {
+		return resolveKubeconfigPath(path, clientcmd.RecommendedConfigPathEnvVar)
+	}
+	path, err := defaultKubeconfig()
+	if err != nil {
+		return "", err
+	}
+	return followSymlink(path, "~/.kube/config")
+}
+
+// kubeconfigFromEnv returns the file of a KUBECONFIG list that kubectl
+// writes new entries to, following clientcmd's PathOptions: a single file is
+// used as is; otherwise the first file that exists, or the last file if none
+// does. It returns "" for an empty list.
+func kubeconfigFromEnv(value string) string {
+	var paths []string
+	seen := map[string]bool{}
+	for _, path := range filepath.SplitList(value) {
+		if path == "" || seen[path] {
+			continue
+		}
+		seen[path] = true
+		paths = append(paths, path)
+	}
+	if len(paths) == 0 {
+		return ""
+	}
+	if len(paths) > 1 {
+		for _, path := range paths {
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+		}
+	}
+	return paths[len(paths)-1]
+}
+
+// resolveKubeconfigPath makes path absolute, expanding a leading ~, follows
+// a symlink to the file it links to, and checks that it does not name a
+// directory. source names where the path came from, for error messages.
+func resolveKubeconfigPath(path, source string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~"+string(filepath.Separator)) || strings.HasPrefix(path, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf(errHomeDirFmt, err)
+		}
+		path = filepath.Join(homeDir, path[1:])
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid kubeconfig path %q from %s: %v", path, source, err)
+	}
+	if abs, err = followSymlink(abs, source); err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(abs); err == nil && info.IsDir() {
+		return "", fmt.Errorf("kubeconfig path %s from %s is a directory", abs, source)
+	}
+	return abs, nil
+}
+
+// maxSymlinks bounds how many symlinks followSymlink follows, to stop at
+// cycles.
+const maxSymlinks = 40
+
+// followSymlink returns the file path links to if path is a symlink, such as
+// a kubeconfig kept in a dotfiles repository, and path otherwise. Writing
+// through a temporary file and rename would replace the link itself. A link
+// to a file that does not exist yet resolves to that file, so the first sync
+// creates it. source names where the path came from, for error messages.
+func followSymlink(path, source string) (string, error) {
+	for range maxSymlinks {
+		info, err := os.Lstat(path)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			// Missing files and regular files are used as they are.
+			return path, nil
+		}
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			return resolved, nil
+		} else if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to resolve kubeconfig symlink %s from %s: %v", path, source, err)
+		}
+		// A dangling link: follow it one step towards the missing file.
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve kubeconfig symlink %s from %s: %v", path, source, err)
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		path = filepath.Clean(target)
+	}
+	return "", fmt.Errorf("too many levels of symlinks at kubeconfig %s from %s", path, source)
+}
+
+// isWithinDir reports whether path is dir itself or inside it, once both are
+// cleaned.
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,189 @@
+package kubeconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain clears the variables that redirect kubectm to another kubeconfig,
+// so tests that set HOME never write to the developer's own kubeconfig.
+func TestMain(m *testing.M) {
+	os.Unsetenv("KUBECONFIG")
+	os.Unsetenv(kubectmKubeconfigEnv)
+	os.Exit(m.Run())
+}
+
+func TestKubeconfigFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing")
+	if err := os.WriteFile(existing, []byte(testKubeconfigContent), 0600); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+	missingA, missingB := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	list := func(paths ...string) string { return strings.Join(paths, string(os.PathListSeparator)) }
+
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "unset", value: "", want: ""},
+		{name: "only separators", value: list("", ""), want: ""},
+		{name: "single missing file", value: missingA, want: missingA},
+		{name: "first existing file", value: list(missingA, existing, missingB), want: existing},
+		{name: "last file when none exists", value: list(missingA, missingB), want: missingB},
+		{name: "duplicates and empty entries ignored", value: list(missingA, "", missingA), want: missingA},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := kubeconfigFromEnv(tt.value); got != tt.want {
+				t.Errorf("kubeconfigFromEnv(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetKubeconfigPrecedence(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Cleanup(func() { KubeconfigPath = "" })
+
+	fromEnv := filepath.Join(home, "env.yaml")
+	fromKubectmEnv := filepath.Join(home, "kubectm.yaml")
+	fromFlag := filepath.Join(home, "flag.yaml")
+
+	check := func(want string) {
+		t.Helper()
+		got, err := targetKubeconfig()
+		if err != nil {
+			t.Fatalf("targetKubeconfig() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("targetKubeconfig() = %q, want %q", got, want)
+		}
+	}
+
+	check(filepath.Join(home, ".kube", "config"))
+	t.Setenv("KUBECONFIG", fromEnv)
+	check(fromEnv)
+	t.Setenv(kubectmKubeconfigEnv, fromKubectmEnv)
+	check(fromKubectmEnv)
+	KubeconfigPath = fromFlag
+	check(fromFlag)
+
+	KubeconfigPath = "~/project/config"
+	check(filepath.Join(home, "project", "config"))
+
+	KubeconfigPath = home
+	if _, err := targetKubeconfig(); err == nil {
+		t.Error("expected a directory to be rejected as the kubeconfig")
+	}
+}
+
+// TestBackupConfigNextToTarget verifies that a kubeconfig other than
+// ~/.kube/config is backed up in its own directory, under its own name.
+func TestBackupConfigNextToTarget(t *testing.T) {
+	kubeDir := setupBackupTestHome(t)
+	writeTestConfig(t, kubeDir)
+
+	projectDir := t.TempDir()
+	target := filepath.Join(projectDir, "project.yaml")
+	if err := os.WriteFile(target, []byte(testKubeconfigContent), 0600); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+	t.Setenv(kubectmKubeconfigEnv, target)
+
+	backupPath, err := BackupConfig(DefaultBackupCount)
+	if err != nil {
+		t.Fatalf("BackupConfig() error = %v", err)
+	}
+	if filepath.Dir(backupPath) != projectDir || !strings.HasPrefix(filepath.Base(backupPath), "project.yaml.bak.") {
+		t.Errorf("expected the backup next to %s, got %s", target, backupPath)
+	}
+	if backups := listBackups(t, kubeDir); len(backups) != 0 {
+		t.Errorf("expected ~/.kube/config not to be backed up, got %v", backups)
+	}
+
+	backups, err := ListBackups()
+	if err != nil || len(backups) != 1 || backups[0].Path != backupPath {
+		t.Errorf("expected ListBackups to list %s, got %v (err %v)", backupPath, backups, err)
+	}
+}
+
+// TestTargetKubeconfigFollowsSymlinks verifies that a kubeconfig kept
+// elsewhere and linked in is resolved to the real file, even before it
+// exists.
+func TestTargetKubeconfigFollowsSymlinks(t *testing.T) {
+	kubeDir := setupBackupTestHome(t)
+	dotfiles := t.TempDir()
+	real := filepath.Join(dotfiles, "kubeconfig")
+	if err := os.Symlink(real, filepath.Join(kubeDir, "config")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	if got, err := targetKubeconfig(); err != nil || got != real {
+		t.Errorf("dangling link: targetKubeconfig() = %q, %v, want %q", got, err, real)
+	}
+
+	if err := os.WriteFile(real, []byte(testKubeconfigContent), 0600); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+	if got, err := targetKubeconfig(); err != nil || got != real {
+		t.Errorf("~/.kube/config link: targetKubeconfig() = %q, %v, want %q", got, err, real)
+	}
+
+	relative := filepath.Join(t.TempDir(), "relative")
+	rel, err := filepath.Rel(filepath.Dir(relative), real)
+	if err != nil {
+		t.Fatalf("failed to make a relative link: %v", err)
+	}
+	if err := os.Symlink(rel, relative); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	t.Setenv("KUBECONFIG", relative)
+	if got, err := targetKubeconfig(); err != nil || got != real {
+		t.Errorf("KUBECONFIG link: targetKubeconfig() = %q, %v, want %q", got, err, real)
+	}
+}
+
+// TestMergeConfigsWritesThroughSymlink verifies that a sync writes and backs
+// up the file a symlinked ~/.kube/config points to, and keeps the link.
+func TestMergeConfigsWritesThroughSymlink(t *testing.T) {
+	kubeDir := setupBackupTestHome(t)
+	dotfiles := t.TempDir()
+	real := filepath.Join(dotfiles, "kubeconfig")
+	if err := os.WriteFile(real, []byte(testKubeconfigContent), 0600); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+	link := filepath.Join(kubeDir, "config")
+	if err := os.Symlink(real, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	backupPath, err := BackupConfig(DefaultBackupCount)
+	if err != nil {
+		t.Fatalf("BackupConfig() error = %v", err)
+	}
+	if filepath.Dir(backupPath) != dotfiles {
+		t.Errorf("expected the backup next to %s, got %s", real, backupPath)
+	}
+	if _, err := MergeConfigs(&DownloadResult{Configs: []DownloadedConfig{splitDownload("Linode", "1", "lke-prod")}}, MergeOptions{}); err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("expected %s to stay a symlink, got %v (err %v)", link, info, err)
+	}
+	data, err := os.ReadFile(real)
+	if err != nil {
+		t.Fatalf("failed to read kubeconfig: %v", err)
+	}
+	if !strings.Contains(string(data), "lke-prod") {
+		t.Errorf("expected the real kubeconfig to be updated, got:\n%s", data)
+	}
+	if backups := listBackups(t, kubeDir); len(backups) != 0 {
+		t.Errorf("expected no backups in %s, got %v", kubeDir, backups)
+	}
+}
@@ -0,0 +1,405 @@
+package kubeconfig
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"kubectm/pkg/utils"
+
+	"github.com/fatih/color"
+	"go.yaml.in/yaml/v3"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ConflictPolicy controls what a sync does with a field of a kubectm-managed
+// entry that was edited locally and changed upstream to a different value.
+type ConflictPolicy string
+
+const (
+	// ConflictPreferLocal keeps the local value.
+	ConflictPreferLocal ConflictPolicy = "prefer-local"
+	// ConflictPreferRemote takes the upstream value.
+	ConflictPreferRemote ConflictPolicy = "prefer-remote"
+	// ConflictPrompt asks which value to keep. Without a way to ask, the
+	// local value is kept.
+	ConflictPrompt ConflictPolicy = "prompt"
+)
+
+// ConflictOptions configures how conflicting edits are resolved.
+type ConflictOptions struct {
+	Policy ConflictPolicy
+	// Resolve is asked under ConflictPrompt whether to take the upstream
+	// values of a conflict. A nil Resolve keeps the local values.
+	Resolve func(Conflict) bool
+}
+
+// Conflict is a kubectm-managed entry with fields that were edited locally
+// and changed upstream to different values since the last sync.
+type Conflict struct {
+	Kind ChangeKind
+	Name string
+	// Context is the managed context the entry belongs to.
+	Context string
+	// Fields are the conflicting fields, by their kubeconfig names.
+	Fields []string
+}
+
+// ParseConflictPolicy parses a conflict policy name.
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(s); p {
+	case ConflictPreferLocal, ConflictPreferRemote, ConflictPrompt:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid conflict policy %q (want prefer-local, prefer-remote or prompt)", s)
+}
+
+// ResolveConflictOptions returns the conflict policy from the given flag
+// value, falling back to ~/.kubectm/config.json and then to prompt. An empty
+// flag value is treated as unset.
+func ResolveConflictOptions(policy string) (ConflictOptions, error) {
+	opts := ConflictOptions{Policy: ConflictPrompt}
+	if policy == "" {
+		config, err := loadKubectmConfig()
+		if err != nil {
+			return opts, err
+		}
+		policy = config.Conflicts
+	}
+	if policy != "" {
+		var err error
+		if opts.Policy, err = ParseConflictPolicy(policy); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// SyncedFields records a managed context, and its cluster and user, as they
+// were last downloaded: a hash of each field, keyed by its kubeconfig name.
+// Only hashes are kept, so the state file holds no credentials. Extensions,
+// and the context's cluster and user references, are not included.
+type SyncedFields struct {
+	Context map[string]string `json:"context,omitempty"`
+	Cluster map[string]string `json:"cluster,omitempty"`
+	User    map[string]string `json:"user,omitempty"`
+}
+
+// fieldsEntryName is the name entryFields and entryFromFields give an entry
+// in the single-entry kubeconfig they serialize it through.
+const fieldsEntryName = "entry"
+
+// entrySections maps each kind of entry to its list and its field in a
+// kubeconfig file.
+var entrySections = map[ChangeKind][2]string{
+	KindCluster: {"clusters", "cluster"},
+	KindUser:    {"users", "user"},
+	KindContext: {"contexts", "context"},
+}
+
+// newSyncedFields returns the synced fields of the first context in a
+// downloaded config, and of its cluster and user.
+func newSyncedFields(config *api.Config) (*SyncedFields, error) {
+	synced := &SyncedFields{}
+	for _, key := range sortedKeys(config.Contexts) {
+		context := config.Contexts[key]
+		if context == nil {
+			continue
+		}
+		fields, err := entryFields(KindContext, context)
+		if err != nil {
+			return nil, err
+		}
+		synced.Context = fieldHashes(fields)
+		if cluster := config.Clusters[context.Cluster]; cluster != nil {
+			if fields, err = entryFields(KindCluster, cluster); err != nil {
+				return nil, err
+			}
+			synced.Cluster = fieldHashes(fields)
+		}
+		if authInfo := config.AuthInfos[context.AuthInfo]; authInfo != nil {
+			if fields, err = entryFields(KindUser, authInfo); err != nil {
+				return nil, err
+			}
+			synced.User = fieldHashes(fields)
+		}
+		break
+	}
+	return synced, nil
+}
+
+// syncManagedContext updates a context kubectm synced before with its downloaded version by a
+// three-way merge of the last-synced, local and downloaded fields of the context and of its
+// cluster and user. Upstream changes are applied, local edits are kept, and fields changed on
+// both sides are resolved by opts.Conflicts. The context keeps its cluster and user references;
+// a referenced entry kubectm does not own is left alone.
+func syncManagedContext(config *api.Config, d DownloadedConfig, name string, synced *SyncedFields, imagePath string, opts MergeOptions, report *Report) error {
+	var src *api.Context
+	for _, key := range sortedKeys(d.Config.Contexts) {
+		if src = d.Config.Contexts[key]; src != nil {
+			break
+		}
+	}
+	if src == nil {
+		return fmt.Errorf("no context in the kubeconfig downloaded for %s cluster %s", d.Provider, name)
+	}
+
+	updated, err := syncEntry(KindContext, name, name, synced.Context, config.Contexts[name], src, opts, report)
+	if err != nil {
+		return err
+	}
+	if updated != nil {
+		context := updated.(*api.Context)
+		context.Cluster, context.AuthInfo = config.Contexts[name].Cluster, config.Contexts[name].AuthInfo
+		config.Contexts[name] = context
+	}
+	context := config.Contexts[name]
+	ensureAptakubeExtension(context, imagePath)
+
+	if remote := d.Config.Clusters[src.Cluster]; remote != nil {
+		switch existing := config.Clusters[context.Cluster]; {
+		case existing == nil:
+			// The cluster entry was removed locally; restore it.
+			context.Cluster = mergeCluster(config, src.Cluster, remote, "", report)
+		case ownership(existing.Extensions) != nil:
+			updated, err := syncEntry(KindCluster, context.Cluster, name, synced.Cluster, existing, remote, opts, report)
+			if err != nil {
+				return err
+			}
+			if updated != nil {
+				config.Clusters[context.Cluster] = updated.(*api.Cluster)
+			}
+		}
+	}
+	if remote := d.Config.AuthInfos[src.AuthInfo]; remote != nil {
+		switch existing := config.AuthInfos[context.AuthInfo]; {
+		case existing == nil:
+			context.AuthInfo = mergeAuthInfo(config, src.AuthInfo, remote, "", report)
+		case ownership(existing.Extensions) != nil:
+			updated, err := syncEntry(KindUser, context.AuthInfo, name, synced.User, existing, remote, opts, report)
+			if err != nil {
+				return err
+			}
+			if updated != nil {
+				config.AuthInfos[context.AuthInfo] = updated.(*api.AuthInfo)
+			}
+		}
+	}
+
+	report.record(KindContext, name, ActionSkipped, "same cluster")
+	return nil
+}
+
+// syncEntry three-way merges a local entry with its downloaded version, given the hashes of its
+// fields as last synced. It records the outcome in report and returns the merged entry, carrying
+// the local entry's extensions, or nil if the local entry is kept as it is.
+func syncEntry(kind ChangeKind, name, contextName string, base map[string]string, local, remote any, opts MergeOptions, report *Report) (any, error) {
+	localFields, err := entryFields(kind, local)
+	if err != nil {
+		return nil, err
+	}
+	remoteFields, err := entryFields(kind, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	merged, upstream, conflicts, edited := mergeFields(base, localFields, remoteFields)
+	var details []string
+	if len(conflicts) > 0 {
+		conflict := Conflict{Kind: kind, Name: name, Context: contextName, Fields: conflicts}
+		if takeUpstream(conflict, opts) {
+			for _, field := range conflicts {
+				if value, ok := remoteFields[field]; ok {
+					merged[field] = value
+				} else {
+					delete(merged, field)
+				}
+			}
+			upstream = append(upstream, conflicts...)
+			sort.Strings(upstream)
+			details = append(details, "took upstream "+strings.Join(conflicts, ", ")+" over local edits")
+			utils.WarnLogger.Printf("%s Context %s: %s %s was edited locally; took the upstream %s", utils.Iso8601Time(), color.New(color.Bold).Sprint(contextName), kind, name, strings.Join(conflicts, ", "))
+		} else {
+			edited = append(edited, conflicts...)
+			sort.Strings(edited)
+			details = append(details, "kept local "+strings.Join(conflicts, ", ")+", which conflicts with upstream")
+			utils.WarnLogger.Printf("%s Context %s: %s %s was edited locally and upstream; kept the local %s", utils.Iso8601Time(), color.New(color.Bold).Sprint(contextName), kind, name, strings.Join(conflicts, ", "))
+		}
+	}
+
+	if len(upstream) == 0 {
+		if len(edited) > 0 {
+			report.record(kind, name, ActionSkipped, "kept local edits to "+strings.Join(edited, ", "))
+		}
+		return nil, nil
+	}
+
+	updated, err := entryFromFields(kind, merged, local)
+	if err != nil {
+		return nil, err
+	}
+	if len(details) == 0 {
+		details = append(details, "upstream changed "+strings.Join(upstream, ", "))
+	}
+	utils.ActionLogger.Printf("%s Context %s: updated %s %s from upstream (%s)", utils.Iso8601Time(), color.New(color.Bold).Sprint(contextName), kind, name, strings.Join(upstream, ", "))
+	report.record(kind, name, ActionUpdated, strings.Join(details, "; "))
+	return updated, nil
+}
+
+// takeUpstream reports whether a conflict is resolved in favour of the upstream values. A dry
+// run reports the conflict it would ask about without asking, and keeps the local values.
+func takeUpstream(conflict Conflict, opts MergeOptions) bool {
+	switch opts.Conflicts.Policy {
+	case ConflictPreferRemote:
+		return true
+	case ConflictPrompt:
+		return !opts.DryRun && opts.Conflicts.Resolve != nil && opts.Conflicts.Resolve(conflict)
+	}
+	return false
+}
+
+// mergeFields merges the fields of a local entry with the upstream fields, given the hashes of
+// the fields as last synced; a field absent on one side counts as changed there if the base has
+// it. A field changed on one side only takes that side's value. It returns the merged fields,
+// the fields taken from upstream, the fields that changed on both sides to different values,
+// which keep their local value, and the fields edited only locally.
+func mergeFields(base map[string]string, local, remote map[string]any) (merged map[string]any, upstream, conflicts, edited []string) {
+	merged = make(map[string]any, len(local))
+	for field, value := range local {
+		merged[field] = value
+	}
+
+	fields := map[string]bool{}
+	for field := range local {
+		fields[field] = true
+	}
+	for field := range remote {
+		fields[field] = true
+	}
+	for _, field := range sortedKeys(fields) {
+		localHash, remoteHash := fieldHash(local, field), fieldHash(remote, field)
+		switch {
+		case localHash == remoteHash:
+		case localHash == base[field]:
+			if value, ok := remote[field]; ok {
+				merged[field] = value
+			} else {
+				delete(merged, field)
+			}
+			upstream = append(upstream, field)
+		case remoteHash == base[field]:
+			edited = append(edited, field)
+		default:
+			conflicts = append(conflicts, field)
+		}
+	}
+	return merged, upstream, conflicts, edited
+}
+
+// fieldHashes returns the hash of each field.
+func fieldHashes(fields map[string]any) map[string]string {
+	hashes := make(map[string]string, len(fields))
+	for field := range fields {
+		hashes[field] = fieldHash(fields, field)
+	}
+	return hashes
+}
+
+// fieldHash returns a short hash of a field's value, or "" if the field is absent.
+func fieldHash(fields map[string]any, field string) string {
+	value, ok := fields[field]
+	if !ok {
+		return ""
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		data = []byte(fmt.Sprint(value))
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// entryFields returns the fields of a cluster, user or context entry as clientcmd writes them to
+// a kubeconfig, keyed by their kubeconfig names, without extensions. A context's cluster and
+// user references are left out.
+func entryFields(kind ChangeKind, entry any) (map[string]any, error) {
+	config := api.NewConfig()
+	switch e := entry.(type) {
+	case *api.Cluster:
+		copied := *e
+		copied.Extensions = nil
+		config.Clusters[fieldsEntryName] = &copied
+	case *api.AuthInfo:
+		copied := *e
+		copied.Extensions = nil
+		config.AuthInfos[fieldsEntryName] = &copied
+	case *api.Context:
+		copied := *e
+		copied.Extensions = nil
+		config.Contexts[fieldsEntryName] = &copied
+	default:
+		return nil, fmt.Errorf("unsupported kubeconfig entry %T", entry)
+	}
+	data, err := clientcmd.Write(*config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize %s: %v", kind, err)
+	}
+
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", kind, err)
+	}
+	section := entrySections[kind]
+	list, _ := doc[section[0]].([]any)
+	if len(list) != 1 {
+		return nil, fmt.Errorf("failed to serialize %s: expected a single entry", kind)
+	}
+	item, _ := list[0].(map[string]any)
+	fields, _ := item[section[1]].(map[string]any)
+	if fields == nil {
+		fields = map[string]any{}
+	}
+	if kind == KindContext {
+		delete(fields, "cluster")
+		delete(fields, "user")
+	}
+	return fields, nil
+}
+
+// entryFromFields builds an entry of the same kind as local from its fields, and gives it the
+// local entry's extensions and origin.
+func entryFromFields(kind ChangeKind, fields map[string]any, local any) (any, error) {
+	section := entrySections[kind]
+	data, err := yaml.Marshal(map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Config",
+		section[0]:   []any{map[string]any{"name": fieldsEntryName, section[1]: fields}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize merged %s: %v", kind, err)
+	}
+	config, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load merged %s: %v", kind, err)
+	}
+
+	switch l := local.(type) {
+	case *api.Cluster:
+		entry := config.Clusters[fieldsEntryName]
+		entry.Extensions, entry.LocationOfOrigin = l.Extensions, l.LocationOfOrigin
+		return entry, nil
+	case *api.AuthInfo:
+		entry := config.AuthInfos[fieldsEntryName]
+		entry.Extensions, entry.LocationOfOrigin = l.Extensions, l.LocationOfOrigin
+		return entry, nil
+	case *api.Context:
+		entry := config.Contexts[fieldsEntryName]
+		entry.Extensions, entry.LocationOfOrigin = l.Extensions, l.LocationOfOrigin
+		return entry, nil
+	}
+	return nil, fmt.Errorf("unsupported kubeconfig entry %T", local)
+}
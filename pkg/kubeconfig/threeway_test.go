@@ -0,0 +1,161 @@
+package kubeconfig
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// editKubeconfig loads the kubeconfig at path, lets edit change it, and
+// writes it back, the way a user editing the file by hand would.
+func editKubeconfig(t *testing.T, path string, edit func(*api.Config)) {
+	t.Helper()
+	config, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("failed to load kubeconfig: %v", err)
+	}
+	edit(config)
+	if err := clientcmd.WriteToFile(*config, path); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+}
+
+func TestMergeFields(t *testing.T) {
+	base := fieldHashes(map[string]any{"server": "a", "namespace": "default", "token": "old"})
+	local := map[string]any{"server": "a", "namespace": "team", "token": "mine", "proxy-url": "http://proxy"}
+	remote := map[string]any{"server": "b", "namespace": "default", "token": "new"}
+
+	merged, upstream, conflicts, edited := mergeFields(base, local, remote)
+	want := map[string]any{"server": "b", "namespace": "team", "token": "mine", "proxy-url": "http://proxy"}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("merged = %v, want %v", merged, want)
+	}
+	if !reflect.DeepEqual(upstream, []string{"server"}) {
+		t.Errorf("upstream = %v, want [server]", upstream)
+	}
+	if !reflect.DeepEqual(conflicts, []string{"token"}) {
+		t.Errorf("conflicts = %v, want [token]", conflicts)
+	}
+	if !reflect.DeepEqual(edited, []string{"namespace", "proxy-url"}) {
+		t.Errorf("edited = %v, want [namespace proxy-url]", edited)
+	}
+}
+
+func TestMergeConfigsKeepsLocalEdits(t *testing.T) {
+	kubeDir := setupBackupTestHome(t)
+	configPath := filepath.Join(kubeDir, "config")
+
+	first := splitDownload("Linode", "1", "lke-prod")
+	if _, err := MergeConfigs(&DownloadResult{Configs: []DownloadedConfig{first}}, MergeOptions{}); err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+	editKubeconfig(t, configPath, func(config *api.Config) {
+		config.Contexts["lke-prod"].Namespace = "team"
+		config.Clusters["lke-prod"].ProxyURL = "http://proxy.example.com:3128"
+	})
+
+	// Upstream moves the API server and rotates the token.
+	second := splitDownload("Linode", "1", "lke-prod")
+	second.Config.Clusters["lke-prod"].Server = "https://moved.example.com:6443"
+	second.Config.AuthInfos["lke-prod-admin"].Token = "rotated"
+	report, err := MergeConfigs(&DownloadResult{Configs: []DownloadedConfig{second}}, MergeOptions{})
+	if err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+
+	config, err := clientcmd.LoadFromFile(configPath)
+	if err != nil {
+		t.Fatalf("failed to load kubeconfig: %v", err)
+	}
+	if len(config.Contexts) != 1 || config.Contexts["lke-prod"].Namespace != "team" {
+		t.Errorf("expected the local namespace to be kept, got %+v", config.Contexts)
+	}
+	cluster := config.Clusters["lke-prod"]
+	if cluster.ProxyURL != "http://proxy.example.com:3128" || cluster.Server != "https://moved.example.com:6443" {
+		t.Errorf("expected the local proxy-url and the upstream server, got %+v", cluster)
+	}
+	if config.AuthInfos["lke-prod-admin"].Token != "rotated" {
+		t.Errorf("expected the rotated token, got %q", config.AuthInfos["lke-prod-admin"].Token)
+	}
+	if ownership(cluster.Extensions) == nil {
+		t.Error("expected the merged cluster to stay owned by kubectm")
+	}
+
+	var clusterChange Change
+	for _, c := range report.Changes {
+		if c.Kind == KindCluster {
+			clusterChange = c
+		}
+	}
+	if clusterChange.Action != ActionUpdated || !strings.Contains(clusterChange.Detail, "server") {
+		t.Errorf("expected the cluster reported as updated upstream, got %+v", clusterChange)
+	}
+}
+
+func TestMergeConfigsResolvesConflicts(t *testing.T) {
+	tests := []struct {
+		name       string
+		conflicts  ConflictOptions
+		wantServer string
+		wantAction ChangeAction
+	}{
+		{name: "prefer local", conflicts: ConflictOptions{Policy: ConflictPreferLocal}, wantServer: "https://local.example.com", wantAction: ActionSkipped},
+		{name: "prefer remote", conflicts: ConflictOptions{Policy: ConflictPreferRemote}, wantServer: "https://upstream.example.com", wantAction: ActionUpdated},
+		{name: "prompt declined", conflicts: ConflictOptions{Policy: ConflictPrompt, Resolve: func(Conflict) bool { return false }}, wantServer: "https://local.example.com", wantAction: ActionSkipped},
+		{name: "prompt without a way to ask", conflicts: ConflictOptions{Policy: ConflictPrompt}, wantServer: "https://local.example.com", wantAction: ActionSkipped},
+		{name: "prompt accepted", conflicts: ConflictOptions{Policy: ConflictPrompt, Resolve: func(c Conflict) bool {
+			return c.Kind == KindCluster && c.Context == "lke-prod" && reflect.DeepEqual(c.Fields, []string{"server"})
+		}}, wantServer: "https://upstream.example.com", wantAction: ActionUpdated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeDir := setupBackupTestHome(t)
+			configPath := filepath.Join(kubeDir, "config")
+
+			if _, err := MergeConfigs(&DownloadResult{Configs: []DownloadedConfig{splitDownload("Linode", "1", "lke-prod")}}, MergeOptions{}); err != nil {
+				t.Fatalf("MergeConfigs() error = %v", err)
+			}
+			editKubeconfig(t, configPath, func(config *api.Config) {
+				config.Clusters["lke-prod"].Server = "https://local.example.com"
+			})
+
+			d := splitDownload("Linode", "1", "lke-prod")
+			d.Config.Clusters["lke-prod"].Server = "https://upstream.example.com"
+			report, err := MergeConfigs(&DownloadResult{Configs: []DownloadedConfig{d}}, MergeOptions{Conflicts: tt.conflicts})
+			if err != nil {
+				t.Fatalf("MergeConfigs() error = %v", err)
+			}
+
+			config, err := clientcmd.LoadFromFile(configPath)
+			if err != nil {
+				t.Fatalf("failed to load kubeconfig: %v", err)
+			}
+			if got := config.Clusters["lke-prod"].Server; got != tt.wantServer {
+				t.Errorf("server = %q, want %q", got, tt.wantServer)
+			}
+			for _, c := range report.Changes {
+				if c.Kind == KindCluster && (c.Action != tt.wantAction || !strings.Contains(c.Detail, "server")) {
+					t.Errorf("expected the conflict reported as %s, got %+v", tt.wantAction, c)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveConflictOptions(t *testing.T) {
+	setupBackupTestHome(t)
+	opts, err := ResolveConflictOptions("")
+	if err != nil || opts.Policy != ConflictPrompt {
+		t.Errorf("expected prompt by default, got %v (err %v)", opts.Policy, err)
+	}
+	if opts, err = ResolveConflictOptions("prefer-remote"); err != nil || opts.Policy != ConflictPreferRemote {
+		t.Errorf("expected the flag value, got %v (err %v)", opts.Policy, err)
+	}
+	if _, err := ResolveConflictOptions("theirs"); err == nil {
+		t.Error("expected an invalid policy to be rejected")
+	}
+}
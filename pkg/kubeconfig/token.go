@@ -0,0 +1,71 @@
+package kubeconfig
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"kubectm/pkg/credentials"
+)
+
+// tokenCacheTTL bounds how long a cached access token is reused. Provider
+// tokens are valid for around an hour; a sync finishes well within this.
+const tokenCacheTTL = 10 * time.Minute
+
+// tokenCache memoises provider access tokens so that listing clusters and
+// downloading each cluster's kubeconfig share a single token exchange.
+type tokenCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedToken
+}
+
+type cachedToken struct {
+	token   string
+	expires time.Time
+}
+
+// get returns the cached token for cred, calling fetch when there is none or
+// the cached one has expired.
+func (c *tokenCache) get(cred credentials.Credential, fetch func() (string, error)) (string, error) {
+	key := credentialFingerprint(cred)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[key]; ok && time.Now().Before(entry.expires) {
+		return entry.token, nil
+	}
+
+	token, err := fetch()
+	if err != nil {
+		return "", err
+	}
+
+	if c.entries == nil {
+		c.entries = make(map[string]cachedToken)
+	}
+	c.entries[key] = cachedToken{token: token, expires: time.Now().Add(tokenCacheTTL)}
+	return token, nil
+}
+
+// credentialFingerprint hashes a credential's details so tokens can be cached
+// per credential without keeping the secrets themselves as map keys.
+func credentialFingerprint(cred credentials.Credential) string {
+	keys := make([]string, 0, len(cred.Details))
+	for k := range cred.Details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	h.Write([]byte(cred.Provider))
+	for _, k := range keys {
+		h.Write([]byte{0})
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(cred.Details[k]))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
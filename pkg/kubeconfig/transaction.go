@@ -0,0 +1,226 @@
+package kubeconfig
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"kubectm/pkg/utils"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// transaction records the files a sync writes, so that if a later step
+// fails every file can be put back the way it was.
+type transaction struct {
+	undo []fileSnapshot
+}
+
+// fileSnapshot is the content a file had before the transaction wrote it.
+type fileSnapshot struct {
+	path    string
+	existed bool
+	data    []byte
+	perm    os.FileMode
+}
+
+// writeFile atomically replaces path with data, first recording what the
+// file held so rollback can restore it. Writing content the file already
+// has is a no-op.
+func (t *transaction) writeFile(path string, data []byte, perm os.FileMode) error {
+	snapshot := fileSnapshot{path: path, perm: perm}
+	if info, err := os.Stat(path); err == nil {
+		previous, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		if bytes.Equal(previous, data) {
+			return nil
+		}
+		snapshot.existed, snapshot.data, snapshot.perm = true, previous, info.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to stat %s: %v", path, err)
+	}
+
+	if err := atomicWrite(path, data, perm); err != nil {
+		return err
+	}
+	t.undo = append(t.undo, snapshot)
+	return nil
+}
+
+// removeFile removes path, first recording what it held so rollback can
+// restore it. Removing a file that does not exist is a no-op.
+func (t *transaction) removeFile(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %v", path, err)
+	}
+	previous, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove %s: %v", path, err)
+	}
+	t.undo = append(t.undo, fileSnapshot{path: path, existed: true, data: previous, perm: info.Mode().Perm()})
+	return nil
+}
+
+// rollback restores every file the transaction wrote, newest first. It
+// returns a description of each file put back and of each that could not be.
+func (t *transaction) rollback() (rolledBack, failed []string) {
+	for i := len(t.undo) - 1; i >= 0; i-- {
+		s := t.undo[i]
+		if s.existed {
+			if err := writeFileAtomic(s.path, s.data, s.perm); err != nil {
+				failed = append(failed, fmt.Sprintf("could not restore %s: %v", s.path, err))
+				continue
+			}
+			rolledBack = append(rolledBack, "restored "+s.path)
+			continue
+		}
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			failed = append(failed, fmt.Sprintf("could not remove %s: %v", s.path, err))
+			continue
+		}
+		rolledBack = append(rolledBack, "removed "+s.path)
+	}
+	t.undo = nil
+	return rolledBack, failed
+}
+
+// fail rolls the transaction back and wraps err in a RollbackError that
+// describes what was undone.
+func (t *transaction) fail(err error) error {
+	rolledBack, failed := t.rollback()
+	for _, r := range rolledBack {
+		utils.ActionLogger.Printf("%s Rolled back: %s", utils.Iso8601Time(), r)
+	}
+	for _, f := range failed {
+		utils.ErrorLogger.Printf("%s Rollback failed: %s", utils.Iso8601Time(), f)
+	}
+	return &RollbackError{Err: err, RolledBack: rolledBack, Failed: failed}
+}
+
+// RollbackError is returned when a sync fails while writing its files. The
+// files written before the failure have been put back.
+type RollbackError struct {
+	Err error
+	// RolledBack describes each file that was restored or removed.
+	RolledBack []string
+	// Failed describes each file that could not be put back.
+	Failed []string
+}
+
+func (e *RollbackError) Error() string {
+	msg := e.Err.Error()
+	if len(e.RolledBack) == 0 && len(e.Failed) == 0 {
+		return msg + "; nothing had been written, no rollback needed"
+	}
+	if len(e.RolledBack) > 0 {
+		msg += "; rolled back: " + strings.Join(e.RolledBack, ", ")
+	}
+	if len(e.Failed) > 0 {
+		msg += "; rollback incomplete: " + strings.Join(e.Failed, ", ")
+	}
+	return msg
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+// atomicWrite writes the files of a transaction; tests replace it to
+// simulate a failed write.
+var atomicWrite = writeFileAtomic
+
+// writeFileAtomic writes data to a temporary file next to path, syncs it to
+// disk and renames it over path, so readers see either the old or the new
+// content and never a partial write.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %v", path, err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %v", tmpPath, err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set permissions on %s: %v", tmpPath, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync %s: %v", tmpPath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %v", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", path, err)
+	}
+
+	// Sync the directory so the rename itself survives a crash. Not every
+	// platform supports this, so failures are ignored.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// validateMerged checks the merged kubeconfig with clientcmd.Validate. Only
+// problems the merge introduced are errors; problems the kubeconfig already
+// had, such as a certificate file that no longer exists, are left for the
+// user to fix and do not block a sync.
+func validateMerged(before, after *api.Config) error {
+	if api.IsConfigEmpty(after) {
+		return nil
+	}
+	existing := map[string]bool{}
+	if before != nil && !api.IsConfigEmpty(before) {
+		for _, err := range validationErrors(before) {
+			existing[err] = true
+		}
+	}
+
+	var introduced []string
+	for _, err := range validationErrors(after) {
+		if !existing[err] {
+			introduced = append(introduced, err)
+		}
+	}
+	if len(introduced) > 0 {
+		return fmt.Errorf("merged kubeconfig is invalid: %s", strings.Join(introduced, "; "))
+	}
+	return nil
+}
+
+// validationErrors returns the messages of the errors clientcmd.Validate
+// finds in config.
+func validationErrors(config *api.Config) []string {
+	err := clientcmd.Validate(*config)
+	if err == nil {
+		return nil
+	}
+	var messages []string
+	if aggregate, ok := err.(interface{ Errors() []error }); ok {
+		for _, e := range aggregate.Errors() {
+			messages = append(messages, e.Error())
+		}
+		return messages
+	}
+	return []string{err.Error()}
+}
@@ -0,0 +1,127 @@
+package kubeconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestTransactionRollback(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "config")
+	created := filepath.Join(dir, "lke.png")
+	unchanged := filepath.Join(dir, "state.json")
+	for path, content := range map[string]string{existing: "old", unchanged: "same"} {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+
+	tx := &transaction{}
+	for path, content := range map[string]string{existing: "new", created: "icon", unchanged: "same"} {
+		if err := tx.writeFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("writeFile(%s) error = %v", path, err)
+		}
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "new" {
+		t.Fatalf("expected %s to be written, got %q", existing, data)
+	}
+
+	err := tx.fail(errors.New("failed to save kubectm state"))
+	var rollbackErr *RollbackError
+	if !errors.As(err, &rollbackErr) {
+		t.Fatalf("expected a *RollbackError, got %T", err)
+	}
+	if len(rollbackErr.RolledBack) != 2 || len(rollbackErr.Failed) != 0 {
+		t.Errorf("expected two files rolled back, got %+v", rollbackErr)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "restored "+existing) || !strings.Contains(msg, "removed "+created) {
+		t.Errorf("expected the message to name what was rolled back, got %q", msg)
+	}
+
+	if data, _ := os.ReadFile(existing); string(data) != "old" {
+		t.Errorf("expected %s to be restored, got %q", existing, data)
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got %v", created, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("expected no temporary files to be left behind, got %d entries", len(entries))
+	}
+
+	if msg := (&transaction{}).fail(errors.New("invalid")).Error(); !strings.Contains(msg, "no rollback needed") {
+		t.Errorf("expected an empty transaction to say nothing was rolled back, got %q", msg)
+	}
+}
+
+func TestValidateMerged(t *testing.T) {
+	valid := createTestConfig(testClusterNameMerge, testServerURL, testCAData, testUserName, testToken, testContextName, nil)
+
+	// A problem the kubeconfig already had does not block the sync.
+	broken := valid.DeepCopy()
+	broken.Contexts["dangling"] = &api.Context{Cluster: "missing", AuthInfo: testUserName}
+	if err := validateMerged(broken, broken.DeepCopy()); err != nil {
+		t.Errorf("expected existing problems to be ignored, got %v", err)
+	}
+
+	// A problem the merge introduced does.
+	merged := broken.DeepCopy()
+	merged.CurrentContext = "gone"
+	if err := validateMerged(broken, merged); err == nil || !strings.Contains(err.Error(), "gone") {
+		t.Errorf("expected the new problem to be reported, got %v", err)
+	}
+
+	if err := validateMerged(nil, api.NewConfig()); err != nil {
+		t.Errorf("expected an empty kubeconfig to be accepted, got %v", err)
+	}
+}
+
+func TestMergeConfigsRollsBackOnFailure(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	kubeDir := filepath.Join(home, ".kube")
+	if err := os.MkdirAll(kubeDir, 0700); err != nil {
+		t.Fatalf("failed to create .kube dir: %v", err)
+	}
+	configPath := filepath.Join(kubeDir, "config")
+	existing := createTestConfig("old-cluster", testServerURL2, testCAData2, "old-user", testToken, "old", nil)
+	if err := clientcmd.WriteToFile(*existing, configPath); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+	original, _ := os.ReadFile(configPath)
+
+	// Fail the state file write, which comes after the icon and the
+	// kubeconfig have been written.
+	atomicWrite = func(path string, data []byte, perm os.FileMode) error {
+		if filepath.Base(path) == stateFileName {
+			return errors.New("disk full")
+		}
+		return writeFileAtomic(path, data, perm)
+	}
+	t.Cleanup(func() { atomicWrite = writeFileAtomic })
+	d := DownloadedConfig{
+		Provider: "Linode",
+		Config:   createTestConfig(testClusterNameMerge, testServerURL, testCAData, testUserName, testToken, testContextName, nil),
+	}
+	d.Cluster.ContextName = testContextName
+
+	_, err := MergeConfigs(&DownloadResult{Configs: []DownloadedConfig{d}}, MergeOptions{})
+	var rollbackErr *RollbackError
+	if !errors.As(err, &rollbackErr) {
+		t.Fatalf("expected a *RollbackError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "restored "+configPath) || !strings.Contains(err.Error(), "removed "+filepath.Join(kubeDir, "lke.png")) {
+		t.Errorf("expected the kubeconfig and icon to be rolled back, got %q", err.Error())
+	}
+	if after, _ := os.ReadFile(configPath); string(after) != string(original) {
+		t.Error("expected the kubeconfig to be restored")
+	}
+	if backups, _ := filepath.Glob(filepath.Join(kubeDir, backupPrefix("config")+"*")); len(backups) != 1 {
+		t.Errorf("expected the backup taken before the sync to be kept, got %v", backups)
+	}
+}
@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"kubectm/pkg/credentials"
+	"kubectm/pkg/utils"
+)
+
+// DiscoverAll asks every registered provider for credentials.
+// Credential failures are non-fatal: each provider is attempted independently,
+// errors are logged and skipped. Returns an error only if no credentials are found at all.
+func DiscoverAll(ctx context.Context) ([]credentials.Credential, error) {
+	var creds []credentials.Credential
+
+	for _, p := range All() {
+		cred, err := p.Discover(ctx)
+		if err != nil {
+			utils.ErrorLogger.Printf("%s Error retrieving %s credentials: %v", utils.Iso8601Time(), p.Name(), err)
+			continue
+		}
+		if cred != nil {
+			creds = append(creds, *cred)
+		}
+	}
+
+	if len(creds) == 0 {
+		return nil, errors.New("no credentials found")
+	}
+
+	return creds, nil
+}
+
+// Unavailable is a selected provider DiscoverSelected could not use, and why.
+type Unavailable struct {
+	Name string
+	Err  error
+}
+
+// DiscoverSelected retrieves credentials for the specified providers.
+// All selected built-in providers are required: if any provider fails, an error is returned
+// immediately. Use this when the user has explicitly chosen providers.
+// An external plugin that fails, and a provider that is not registered, such as a plugin
+// no longer on $PATH, are returned as unavailable instead, so they cannot abort the run
+// but the caller can still report them as failed.
+func DiscoverSelected(ctx context.Context, selectedProviders []string) ([]credentials.Credential, []Unavailable, error) {
+	var creds []credentials.Credential
+	var unavailable []Unavailable
+
+	for _, name := range selectedProviders {
+		p, ok := Get(name)
+		if !ok {
+			err := fmt.Errorf("not a built-in provider, and no kubectm-provider-%s plugin on $PATH", name)
+			unavailable = append(unavailable, Unavailable{Name: name, Err: err})
+			continue
+		}
+
+		cred, err := p.Discover(ctx)
+		if _, isPlugin := p.(*Plugin); isPlugin && (err != nil || cred == nil) {
+			if err == nil {
+				err = errors.New("no credentials found")
+			}
+			unavailable = append(unavailable, Unavailable{Name: name, Err: err})
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error retrieving %s credentials: %v", name, err)
+		}
+		if cred == nil {
+			return nil, nil, fmt.Errorf("%s credentials not found", name)
+		}
+		creds = append(creds, *cred)
+	}
+
+	return creds, unavailable, nil
+}
@@ -0,0 +1,327 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"kubectm/pkg/credentials"
+	"kubectm/pkg/utils"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	// PluginPrefix is the executable name prefix kubectm looks for on $PATH.
+	// A plugin named kubectm-provider-acme registers the provider "acme".
+	PluginPrefix = "kubectm-provider-"
+
+	// PluginProtocolVersion is the version of the JSON protocol spoken over a
+	// plugin's stdin and stdout. Plugins must echo it in every response.
+	PluginProtocolVersion = 1
+
+	// pluginMaxOutput caps how much a plugin may write to stdout or stderr.
+	pluginMaxOutput = 16 << 20
+)
+
+// Plugin commands sent in PluginRequest.Command.
+const (
+	PluginCommandDiscover      = "discover"
+	PluginCommandListClusters  = "list-clusters"
+	PluginCommandGetKubeconfig = "get-kubeconfig"
+)
+
+// PluginTimeout bounds a single plugin invocation. It is a variable so tests
+// can shorten it.
+var PluginTimeout = 60 * time.Second
+
+// pluginNamePattern restricts plugin provider names to those that are safe to
+// use in file names, context names and saved selections.
+var pluginNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// PluginRequest is written as a single JSON document to a plugin's stdin.
+type PluginRequest struct {
+	ProtocolVersion int               `json:"protocolVersion"`
+	Command         string            `json:"command"`
+	Credential      map[string]string `json:"credential,omitempty"`
+	Cluster         *Cluster          `json:"cluster,omitempty"`
+}
+
+// PluginResponse is read as a single JSON document from a plugin's stdout.
+// Only the field matching the command is used; a non-empty Error fails it.
+type PluginResponse struct {
+	ProtocolVersion int `json:"protocolVersion"`
+	// Credential is the discovered credential details, or null when the
+	// plugin has nothing configured.
+	Credential map[string]string `json:"credential,omitempty"`
+	Clusters   []Cluster         `json:"clusters,omitempty"`
+	// Kubeconfig is a complete kubeconfig document for one cluster.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// PluginError reports a failed plugin invocation. Callers treat it as
+// isolated to that plugin rather than fatal to the whole run.
+type PluginError struct {
+	Plugin  string
+	Command string
+	Err     error
+}
+
+func (e *PluginError) Error() string {
+	return fmt.Sprintf("plugin %s %s: %v", e.Plugin, e.Command, e.Err)
+}
+
+func (e *PluginError) Unwrap() error {
+	return e.Err
+}
+
+// IsPluginError reports whether err came from an external provider plugin.
+func IsPluginError(err error) bool {
+	var pluginErr *PluginError
+	return errors.As(err, &pluginErr)
+}
+
+// Plugin is a Provider backed by an external kubectm-provider-<name>
+// executable.
+type Plugin struct {
+	name string
+	path string
+}
+
+// NewPlugin returns a Plugin for the executable at path.
+func NewPlugin(name, path string) *Plugin {
+	return &Plugin{name: name, path: path}
+}
+
+// Name returns the provider name taken from the executable name.
+func (p *Plugin) Name() string {
+	return p.name
+}
+
+// Path returns the plugin executable's path.
+func (p *Plugin) Path() string {
+	return p.path
+}
+
+// Discover asks the plugin for credentials.
+func (p *Plugin) Discover(ctx context.Context) (*credentials.Credential, error) {
+	resp, err := p.call(ctx, PluginRequest{Command: PluginCommandDiscover})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Credential == nil {
+		return nil, nil
+	}
+	return &credentials.Credential{Provider: p.name, Details: resp.Credential}, nil
+}
+
+// ListClusters asks the plugin for the clusters the credential can see.
+func (p *Plugin) ListClusters(ctx context.Context, cred credentials.Credential) ([]Cluster, error) {
+	resp, err := p.call(ctx, PluginRequest{Command: PluginCommandListClusters, Credential: cred.Details})
+	if err != nil {
+		return nil, err
+	}
+
+	clusters := make([]Cluster, 0, len(resp.Clusters))
+	for _, cluster := range resp.Clusters {
+		if cluster.ContextName == "" {
+			cluster.ContextName = cluster.Name
+		}
+		if cluster.ID == "" || cluster.ContextName == "" {
+			return nil, p.errorf(PluginCommandListClusters, "cluster %q is missing an id or name", cluster.Name)
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters, nil
+}
+
+// Kubeconfig asks the plugin for one cluster's kubeconfig and parses it.
+func (p *Plugin) Kubeconfig(ctx context.Context, cred credentials.Credential, cluster Cluster) (*api.Config, error) {
+	resp, err := p.call(ctx, PluginRequest{Command: PluginCommandGetKubeconfig, Credential: cred.Details, Cluster: &cluster})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Kubeconfig == "" {
+		return nil, p.errorf(PluginCommandGetKubeconfig, "empty kubeconfig for cluster %s", cluster.ID)
+	}
+
+	config, err := clientcmd.Load([]byte(resp.Kubeconfig))
+	if err != nil {
+		return nil, p.errorf(PluginCommandGetKubeconfig, "invalid kubeconfig for cluster %s: %v", cluster.ID, err)
+	}
+	return config, nil
+}
+
+// call runs the plugin once with req on stdin and decodes its response. The
+// invocation is bounded by PluginTimeout and by the output size cap.
+func (p *Plugin) call(ctx context.Context, req PluginRequest) (*PluginResponse, error) {
+	req.ProtocolVersion = PluginProtocolVersion
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, p.errorf(req.Command, "failed to encode request: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, PluginTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, p.path)
+	cmd.Stdin = bytes.NewReader(input)
+	stdout := &cappedBuffer{limit: pluginMaxOutput}
+	stderr := &cappedBuffer{limit: pluginMaxOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// Stop waiting on stdout/stderr shortly after the plugin is killed, even if
+	// a child process it spawned still holds them open.
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, p.errorf(req.Command, "timed out after %s", PluginTimeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, p.errorf(req.Command, "%v: %s", err, msg)
+		}
+		return nil, p.errorf(req.Command, "%v", err)
+	}
+	if stdout.overflow {
+		return nil, p.errorf(req.Command, "response exceeds %d bytes", pluginMaxOutput)
+	}
+
+	var resp PluginResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return nil, p.errorf(req.Command, "invalid response: %v", err)
+	}
+	if resp.ProtocolVersion != PluginProtocolVersion {
+		return nil, p.errorf(req.Command, "unsupported protocol version %d (want %d)", resp.ProtocolVersion, PluginProtocolVersion)
+	}
+	if resp.Error != "" {
+		return nil, p.errorf(req.Command, "%s", resp.Error)
+	}
+	return &resp, nil
+}
+
+func (p *Plugin) errorf(command, format string, args ...interface{}) error {
+	return &PluginError{Plugin: p.name, Command: command, Err: fmt.Errorf(format, args...)}
+}
+
+// cappedBuffer is an io.Writer that keeps at most limit bytes and records
+// whether more were written.
+type cappedBuffer struct {
+	bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.overflow = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// FindPlugins scans $PATH for kubectm-provider-<name> executables. As with
+// $PATH lookup, the first executable found for a name wins.
+func FindPlugins() []*Plugin {
+	seen := make(map[string]bool)
+	var plugins []*Plugin
+
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := pluginName(entry.Name())
+			if !ok || seen[name] {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if !isExecutable(path) {
+				continue
+			}
+			seen[name] = true
+			plugins = append(plugins, NewPlugin(name, path))
+		}
+	}
+
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].name < plugins[j].name })
+	return plugins
+}
+
+// RegisterPlugins registers every plugin found on $PATH. Plugins whose name
+// matches an already registered provider (case-insensitively) are skipped
+// with a warning so they cannot shadow built-in providers.
+func RegisterPlugins() []*Plugin {
+	var registered []*Plugin
+	for _, plugin := range FindPlugins() {
+		if conflict := lookupFold(plugin.name); conflict != "" {
+			utils.WarnLogger.Printf("%s Ignoring provider plugin %s: conflicts with provider %s", utils.Iso8601Time(), plugin.path, conflict)
+			continue
+		}
+		Register(plugin)
+		registered = append(registered, plugin)
+		utils.InfoLogger.Printf("%s Registered provider plugin %s (%s)", utils.Iso8601Time(), plugin.name, plugin.path)
+	}
+	return registered
+}
+
+// lookupFold returns the name of a registered provider equal to name under
+// case folding, or "".
+func lookupFold(name string) string {
+	for _, existing := range Names() {
+		if strings.EqualFold(existing, name) {
+			return existing
+		}
+	}
+	return ""
+}
+
+// pluginName extracts the provider name from a plugin executable's file name.
+func pluginName(fileName string) (string, bool) {
+	if !strings.HasPrefix(fileName, PluginPrefix) {
+		return "", false
+	}
+	name := strings.TrimPrefix(fileName, PluginPrefix)
+	if runtime.GOOS == "windows" {
+		ext := filepath.Ext(name)
+		if !strings.EqualFold(ext, ".exe") {
+			return "", false
+		}
+		name = strings.TrimSuffix(name, ext)
+	}
+	if !pluginNamePattern.MatchString(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// isExecutable reports whether path is a regular file the user may execute.
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	return info.Mode().Perm()&0111 != 0
+}
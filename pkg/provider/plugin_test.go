@@ -0,0 +1,201 @@
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"kubectm/pkg/credentials"
+)
+
+const testPluginKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://acme.example.com
+  name: acme-prod
+contexts:
+- context:
+    cluster: acme-prod
+    user: acme-prod
+  name: acme-prod
+current-context: acme-prod
+users:
+- name: acme-prod
+  user:
+    token: plugin-token
+`
+
+// testPluginScript answers each protocol command with a canned response.
+const testPluginScript = `#!/bin/sh
+req=$(cat)
+case "$req" in
+*'"command":"discover"'*)
+  echo '{"protocolVersion":1,"credential":{"Token":"secret"}}' ;;
+*'"command":"list-clusters"'*)
+  case "$req" in
+  *'"Token":"secret"'*) echo '{"protocolVersion":1,"clusters":[{"id":"42","name":"acme-prod","region":"lab"}]}' ;;
+  *) echo '{"protocolVersion":1,"error":"missing token"}' ;;
+  esac ;;
+*'"command":"get-kubeconfig"'*)
+  printf '{"protocolVersion":1,"kubeconfig":%s}\n' "$(cat "$(dirname "$0")/kubeconfig.json")" ;;
+esac
+`
+
+// writeTestPlugin writes an executable plugin script into dir.
+func writeTestPlugin(t *testing.T, dir, name, script string) string {
+	t.Helper()
+	path := filepath.Join(dir, PluginPrefix+name)
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write plugin: %v", err)
+	}
+	return path
+}
+
+func skipWithoutShell(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin scripts require a POSIX shell")
+	}
+}
+
+func TestPluginProtocol(t *testing.T) {
+	skipWithoutShell(t)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "kubeconfig.json"), []byte(`"`+strings.ReplaceAll(testPluginKubeconfig, "\n", `\n`)+`"`), 0600); err != nil {
+		t.Fatalf("failed to write kubeconfig fixture: %v", err)
+	}
+	plugin := NewPlugin("acme", writeTestPlugin(t, dir, "acme", testPluginScript))
+	ctx := context.Background()
+
+	cred, err := plugin.Discover(ctx)
+	if err != nil {
+		t.Fatalf("Discover: unexpected error: %v", err)
+	}
+	if cred == nil || cred.Provider != "acme" || cred.Details["Token"] != "secret" {
+		t.Fatalf("Discover: unexpected credential %+v", cred)
+	}
+
+	clusters, err := plugin.ListClusters(ctx, *cred)
+	if err != nil {
+		t.Fatalf("ListClusters: unexpected error: %v", err)
+	}
+	if len(clusters) != 1 || clusters[0].ID != "42" || clusters[0].ContextName != "acme-prod" {
+		t.Fatalf("ListClusters: unexpected clusters %+v", clusters)
+	}
+
+	config, err := plugin.Kubeconfig(ctx, *cred, clusters[0])
+	if err != nil {
+		t.Fatalf("Kubeconfig: unexpected error: %v", err)
+	}
+	if user := config.AuthInfos["acme-prod"]; user == nil || user.Token != "plugin-token" {
+		t.Errorf("Kubeconfig: unexpected user %+v", user)
+	}
+
+	_, err = plugin.ListClusters(ctx, credentials.Credential{Provider: "acme"})
+	if !IsPluginError(err) || !strings.Contains(err.Error(), "missing token") {
+		t.Errorf("expected plugin error to be reported, got %v", err)
+	}
+}
+
+func TestPluginFailuresAreIsolated(t *testing.T) {
+	skipWithoutShell(t)
+	dir := t.TempDir()
+
+	origTimeout := PluginTimeout
+	PluginTimeout = 500 * time.Millisecond
+	t.Cleanup(func() { PluginTimeout = origTimeout })
+
+	tests := []struct {
+		name      string
+		script    string
+		expectErr string
+	}{
+		{name: "exit status", script: "#!/bin/sh\necho boom >&2\nexit 3\n", expectErr: "boom"},
+		{name: "timeout", script: "#!/bin/sh\nsleep 10\n", expectErr: "timed out"},
+		{name: "invalid json", script: "#!/bin/sh\necho not-json\n", expectErr: "invalid response"},
+		{name: "protocol version", script: "#!/bin/sh\necho '{\"protocolVersion\":2}'\n", expectErr: "unsupported protocol version 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := strings.ReplaceAll(tt.name, " ", "-")
+			plugin := NewPlugin(name, writeTestPlugin(t, dir, name, tt.script))
+
+			_, err := plugin.Discover(context.Background())
+			if !IsPluginError(err) {
+				t.Fatalf("expected a PluginError, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.expectErr) {
+				t.Errorf("expected error containing %q, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestFindPlugins(t *testing.T) {
+	skipWithoutShell(t)
+	first, second := t.TempDir(), t.TempDir()
+	t.Setenv("PATH", first+string(os.PathListSeparator)+second)
+
+	writeTestPlugin(t, first, "acme", "#!/bin/sh\n")
+	writeTestPlugin(t, second, "acme", "#!/bin/sh\n")
+	writeTestPlugin(t, second, "beta", "#!/bin/sh\n")
+	writeTestPlugin(t, second, "Bad.Name", "#!/bin/sh\n")
+	if err := os.WriteFile(filepath.Join(second, PluginPrefix+"noexec"), []byte("#!/bin/sh\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	plugins := FindPlugins()
+	if len(plugins) != 2 {
+		t.Fatalf("expected 2 plugins, got %d", len(plugins))
+	}
+	if plugins[0].Name() != "acme" || filepath.Dir(plugins[0].Path()) != first {
+		t.Errorf("expected acme from the first PATH entry, got %s at %s", plugins[0].Name(), plugins[0].Path())
+	}
+	if plugins[1].Name() != "beta" {
+		t.Errorf("expected beta, got %s", plugins[1].Name())
+	}
+}
+
+func TestRegisterPluginsSkipsConflicts(t *testing.T) {
+	skipWithoutShell(t)
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+	withRegistry(t, fakeProvider{name: "Linode"})
+
+	writeTestPlugin(t, dir, "linode", "#!/bin/sh\n")
+	writeTestPlugin(t, dir, "acme", "#!/bin/sh\n")
+
+	registered := RegisterPlugins()
+	if len(registered) != 1 || registered[0].Name() != "acme" {
+		t.Fatalf("expected only acme to register, got %+v", registered)
+	}
+	if p, _ := Get("Linode"); p == nil || p.Name() != "Linode" {
+		t.Error("expected the built-in Linode provider to remain registered")
+	}
+}
+
+func TestDiscoverSelectedReportsFailingPlugin(t *testing.T) {
+	skipWithoutShell(t)
+	dir := t.TempDir()
+	withRegistry(t,
+		fakeProvider{name: "Found", cred: &credentials.Credential{Provider: "Found"}},
+		NewPlugin("broken", writeTestPlugin(t, dir, "broken", "#!/bin/sh\nexit 1\n")),
+	)
+
+	creds, unavailable, err := DiscoverSelected(context.Background(), []string{"Found", "broken"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(creds) != 1 || creds[0].Provider != "Found" {
+		t.Errorf("expected only the Found credential, got %+v", creds)
+	}
+	if len(unavailable) != 1 || unavailable[0].Name != "broken" || unavailable[0].Err == nil {
+		t.Errorf("expected broken to be unavailable, got %+v", unavailable)
+	}
+}
@@ -0,0 +1,141 @@
+// Package provider defines the interface every Kubernetes cluster source
+// implements and the registry kubectm iterates over to discover credentials,
+// list clusters and download kubeconfigs.
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"kubectm/pkg/credentials"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Cluster describes a Kubernetes cluster reported by a provider.
+type Cluster struct {
+	// ID uniquely identifies the cluster within its provider.
+	ID string `json:"id"`
+	// Name is the cluster's name or label at the provider.
+	Name string `json:"name"`
+	// Region is the region, location or resource group the cluster lives in.
+	Region string `json:"region,omitempty"`
+	// ContextName is the kubeconfig context name kubectm gives the cluster.
+	ContextName string `json:"contextName,omitempty"`
+	// Version is the cluster's Kubernetes version, if the provider reports it.
+	Version string `json:"version,omitempty"`
+	// Status is the cluster's state at the provider, such as "ready" or
+	// "ACTIVE", if the provider reports it.
+	Status string `json:"status,omitempty"`
+	// Endpoint is the URL of the cluster's API server, if the provider
+	// reports it when listing.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Tags holds the cluster's tags or labels at the provider.
+	Tags map[string]string `json:"tags,omitempty"`
+	// Details holds provider-specific values needed to build the kubeconfig.
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Provider is a source of Kubernetes clusters, such as a cloud provider.
+type Provider interface {
+	// Name returns the provider name used in credentials and selections.
+	Name() string
+	// Discover looks for credentials for this provider. It returns nil, nil
+	// when none are configured.
+	Discover(ctx context.Context) (*credentials.Credential, error)
+	// ListClusters lists the clusters the credential has access to.
+	ListClusters(ctx context.Context, cred credentials.Credential) ([]Cluster, error)
+	// Kubeconfig returns a kubeconfig for a single cluster.
+	Kubeconfig(ctx context.Context, cred credentials.Credential, cluster Cluster) (*api.Config, error)
+}
+
+var (
+	mu        sync.RWMutex
+	providers []Provider
+)
+
+// Register makes a provider available to kubectm. Providers are iterated in
+// registration order. Registering two providers with the same name panics.
+func Register(p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, existing := range providers {
+		if existing.Name() == p.Name() {
+			panic(fmt.Sprintf("provider: Register called twice for provider %s", p.Name()))
+		}
+	}
+	providers = append(providers, p)
+}
+
+// Swap replaces the registered providers with ps and returns a function that
+// restores the previous ones. Tests use it to register providers of their
+// own without leaking them into other tests.
+func Swap(ps ...Provider) (restore func()) {
+	mu.Lock()
+	orig := providers
+	providers = nil
+	mu.Unlock()
+	for _, p := range ps {
+		Register(p)
+	}
+	return func() {
+		mu.Lock()
+		providers = orig
+		mu.Unlock()
+	}
+}
+
+// Get returns the registered provider with the given name.
+func Get(name string) (Provider, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, p := range providers {
+		if p.Name() == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// All returns every registered provider in registration order.
+func All() []Provider {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return append([]Provider(nil), providers...)
+}
+
+// Names returns the names of every registered provider in registration order.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(providers))
+	for _, p := range providers {
+		names = append(names, p.Name())
+	}
+	return names
+}
+
+// PartialListError is returned by ListClusters, together with the clusters
+// that could be listed, when part of a listing failed (for example one region
+// or subscription). Callers may use the clusters but must not treat the
+// listing as complete, e.g. when deciding which clusters no longer exist.
+type PartialListError struct {
+	Failures []string
+}
+
+func (e *PartialListError) Error() string {
+	return fmt.Sprintf("incomplete cluster listing: %s", strings.Join(e.Failures, "; "))
+}
+
+// IsPartialList reports whether err marks an incomplete cluster listing.
+func IsPartialList(err error) bool {
+	var partial *PartialListError
+	return errors.As(err, &partial)
+}
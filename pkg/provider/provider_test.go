@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"kubectm/pkg/credentials"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// fakeProvider is a Provider whose Discover result is fixed by the test.
+type fakeProvider struct {
+	name string
+	cred *credentials.Credential
+	err  error
+}
+
+func (f fakeProvider) Name() string { return f.name }
+
+func (f fakeProvider) Discover(ctx context.Context) (*credentials.Credential, error) {
+	return f.cred, f.err
+}
+
+func (f fakeProvider) ListClusters(ctx context.Context, cred credentials.Credential) ([]Cluster, error) {
+	return nil, nil
+}
+
+func (f fakeProvider) Kubeconfig(ctx context.Context, cred credentials.Credential, cluster Cluster) (*api.Config, error) {
+	return api.NewConfig(), nil
+}
+
+// withRegistry swaps the package registry for the duration of a test.
+func withRegistry(t *testing.T, ps ...Provider) {
+	t.Helper()
+	t.Cleanup(Swap(ps...))
+}
+
+func TestRegistry(t *testing.T) {
+	withRegistry(t, fakeProvider{name: "B"}, fakeProvider{name: "A"})
+
+	if got, want := Names(), []string{"B", "A"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+	if p, ok := Get("A"); !ok || p.Name() != "A" {
+		t.Errorf("Get(A) = %v, %v", p, ok)
+	}
+	if _, ok := Get("missing"); ok {
+		t.Error("expected Get to report unknown provider as missing")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected duplicate Register to panic")
+		}
+	}()
+	Register(fakeProvider{name: "A"})
+}
+
+func TestDiscoverAll(t *testing.T) {
+	withRegistry(t,
+		fakeProvider{name: "Found", cred: &credentials.Credential{Provider: "Found"}},
+		fakeProvider{name: "Missing"},
+		fakeProvider{name: "Broken", err: context.DeadlineExceeded},
+	)
+
+	creds, err := DiscoverAll(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(creds) != 1 || creds[0].Provider != "Found" {
+		t.Errorf("expected only the Found credential, got %+v", creds)
+	}
+
+	withRegistry(t, fakeProvider{name: "Missing"})
+	if _, err := DiscoverAll(context.Background()); err == nil {
+		t.Error("expected error when no credentials are found")
+	}
+}
+
+func TestDiscoverSelected(t *testing.T) {
+	withRegistry(t,
+		fakeProvider{name: "Found", cred: &credentials.Credential{Provider: "Found"}},
+		fakeProvider{name: "Missing"},
+	)
+
+	tests := []struct {
+		name      string
+		selected  []string
+		expectErr string
+		// expectCreds defaults to one credential per selected provider.
+		expectCreds       int
+		expectUnavailable []string
+	}{
+		{name: "found", selected: []string{"Found"}},
+		{name: "not configured", selected: []string{"Found", "Missing"}, expectErr: "Missing credentials not found"},
+		{name: "unregistered unavailable", selected: []string{"Other", "Found"}, expectCreds: 1, expectUnavailable: []string{"Other"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			creds, unavailable, err := DiscoverSelected(context.Background(), tt.selected)
+			if tt.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			expectCreds := tt.expectCreds
+			if expectCreds == 0 {
+				expectCreds = len(tt.selected)
+			}
+			if len(creds) != expectCreds {
+				t.Errorf("expected %d credentials, got %d", expectCreds, len(creds))
+			}
+			var names []string
+			for _, u := range unavailable {
+				names = append(names, u.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.expectUnavailable, ",") {
+				t.Errorf("expected unavailable providers %v, got %+v", tt.expectUnavailable, unavailable)
+			}
+		})
+	}
+}
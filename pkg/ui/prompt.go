@@ -3,11 +3,28 @@ package ui
 import (
     "fmt"
     "kubectm/pkg/credentials"
+    "kubectm/pkg/kubeconfig"
     "kubectm/pkg/utils"  // Import the utils package
 
+    "os"
+    "strings"
+
     "github.com/AlecAivazis/survey/v2"
+    "golang.org/x/term"
 )
 
+// NonInteractive disables every prompt, as if stdin were not a terminal.
+var NonInteractive bool
+
+// Interactive reports whether kubectm may prompt: NonInteractive is not set
+// and stdin is a terminal.
+func Interactive() bool {
+    if NonInteractive {
+        return false
+    }
+    return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
 func SelectCredentials(creds []credentials.Credential) []credentials.Credential {
     if len(creds) == 1 {
         utils.InfoLogger.Printf("Only one set of credentials found, using it by default.")
@@ -38,4 +55,43 @@ func SelectCredentials(creds []credentials.Credential) []credentials.Credential
     }
 
     return selectedCreds
-}
\ No newline at end of file
+}
+
+// ConfirmPrune asks whether to remove the given stale contexts. It declines
+// without asking when kubectm is not interactive.
+func ConfirmPrune(stale []string) bool {
+    if !Interactive() {
+        utils.WarnLogger.Printf("%s Not interactive; leaving %d stale context(s) in place. Use --prune=auto to remove them.", utils.Iso8601Time(), len(stale))
+        return false
+    }
+
+    confirmed := false
+    prompt := &survey.Confirm{
+        Message: fmt.Sprintf("Remove %d context(s) whose cluster no longer exists (%s)?", len(stale), strings.Join(stale, ", ")),
+    }
+    if err := survey.AskOne(prompt, &confirmed); err != nil {
+        fmt.Println("Error during confirmation:", err)
+        return false
+    }
+    return confirmed
+}
+
+// ResolveConflict asks whether to take the upstream values of fields that
+// were edited locally and changed upstream. It keeps the local values without
+// asking when kubectm is not interactive.
+func ResolveConflict(conflict kubeconfig.Conflict) bool {
+    if !Interactive() {
+        utils.WarnLogger.Printf("%s Not interactive; keeping local edits to %s %s. Use --conflicts=prefer-remote to take upstream changes.", utils.Iso8601Time(), conflict.Kind, conflict.Name)
+        return false
+    }
+
+    takeUpstream := false
+    prompt := &survey.Confirm{
+        Message: fmt.Sprintf("Context %s: %s %s was edited locally and changed upstream (%s). Take the upstream values?", conflict.Context, conflict.Kind, conflict.Name, strings.Join(conflict.Fields, ", ")),
+    }
+    if err := survey.AskOne(prompt, &takeUpstream); err != nil {
+        fmt.Println("Error during confirmation:", err)
+        return false
+    }
+    return takeUpstream
+}